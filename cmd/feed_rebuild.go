@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"social-network/pkg/models"
+	"social-network/pkg/service"
+)
+
+const feedRebuildCommand = "feed-rebuild"
+
+// Пересборка лент из командной строки. Выполняется в текущем процессе,
+// прогресс пишется в лог; прерванную задачу можно продолжить с -resume
+func runFeedRebuild(args []string, feedRebuildService service.FeedRebuildService) error {
+	var request models.StartFeedRebuildRequest
+	flags := flag.NewFlagSet(feedRebuildCommand, flag.ExitOnError)
+	flags.IntVar(&request.ActiveDays, "active-days", 0, "только пользователи, активные за последние N дней; 0 - все")
+	flags.BoolVar(&request.Force, "force", false, "пересобрать и ленты, которые уже есть в кеше")
+	flags.BoolVar(&request.Resume, "resume", false, "продолжить последнюю незавершенную пересборку")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// При прерывании задача сохраняется как упавшая и сразу доступна для продолжения
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	job, err := feedRebuildService.Prepare(ctx, &request)
+	if err != nil {
+		return err
+	}
+
+	return feedRebuildService.Run(ctx, job)
+}
@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
+	"os"
+	"social-network/internal/avatar"
 	"social-network/internal/cache"
 	"social-network/internal/config"
 	"social-network/internal/feed"
 	"social-network/internal/handlers"
+	"social-network/internal/notify"
+	"social-network/internal/queue"
+	"social-network/internal/realtime"
+	"social-network/internal/security"
+	"social-network/internal/storage"
 	"social-network/pkg/database"
+	"social-network/pkg/models"
 	"social-network/pkg/repository"
 	"social-network/pkg/service"
 )
@@ -56,17 +65,112 @@ func main() {
 	profileRepository := repository.InitProfileRepository(routerDB)
 	friendShipRepository := repository.InitFriendShipRepository(routerDB)
 	postRepository := repository.InitPostRepository(routerDB)
+	privacyRepository := repository.InitPrivacyRepository(routerDB)
+	identityRepository := repository.InitIdentityRepository(routerDB)
+	passwordResetRepository := repository.InitPasswordResetRepository(routerDB)
+	auditRepository := repository.InitAuditRepository(routerDB)
+	twoFactorRepository := repository.InitTwoFactorRepository(routerDB)
+	sessionRepository := repository.InitSessionRepository(routerDB)
+	roleRepository := repository.InitRoleRepository(routerDB)
+	moderationRepository := repository.InitModerationRepository(routerDB)
+	outboxRepository := repository.InitOutboxRepository(routerDB)
+	engagementRepository := repository.InitEngagementRepository(routerDB)
+	feedRebuildRepository := repository.InitFeedRebuildRepository(routerDB)
+
+	// Действующие ограничения модераторов дублируются в Redis
+	moderationService := service.InitModerationService(moderationRepository, auditRepository)
+	err = moderationService.SyncCache(context.Background())
+	if err != nil {
+		log.Printf("Не удалось восстановить ограничения пользователей в кеше: %v", err)
+	}
+
+	// Инициализация кеша ленты. Посты авторов с большим числом друзей подмешиваются при чтении
+	feedCache := feed.NewFeedCache(config.FeedConfig.FanOutThreshold)
+	feedService := service.InitFeedService(config, feedCache, postRepository, friendShipRepository, moderationService,
+		service.InitChronologicalRanker(),
+		service.InitEngagementRanker(engagementRepository),
+		service.InitCloseFriendsRanker(engagementRepository),
+	)
+	feedRebuildService := service.InitFeedRebuildService(config, userRepository, feedRebuildRepository, feedService)
+
+	// Команда пересборки лент: main feed-rebuild [-active-days=N] [-force] [-resume]
+	if len(os.Args) > 1 && os.Args[1] == feedRebuildCommand {
+		if err := runFeedRebuild(os.Args[2:], feedRebuildService); err != nil {
+			log.Fatalf("Пересборка лент завершилась с ошибкой: %v", err)
+		}
+		return
+	}
+
+	// Read-through кеш анкет: промахи догружаются с реплики одним запросом
+	profileCache := cache.NewProfileCache(config.RedisConfig.ProfileCacheTTL, profileRepository.GetByUserIds)
+
+	notifier := notify.NewNotifier(config)
+	sessionService := service.InitSessionService(sessionRepository, userRepository)
+	go sessionService.RunCleanupWorker(context.Background())
+	roleService := service.InitRoleService(roleRepository, userRepository, auditRepository, sessionService)
+	err = roleService.EnsureAdmins(context.Background(), config.ServerConfig.AdminUserIds)
+	if err != nil {
+		log.Fatalf("Не удалось назначить администраторов: %v", err)
+	}
+	twoFactorService := service.InitTwoFactorService(config, twoFactorRepository, userRepository, auditRepository)
+	authService := service.InitAuthService(config, userRepository, profileRepository, identityRepository, passwordResetRepository, auditRepository, security.NewLoginLimiter(), notifier, twoFactorService, sessionService, roleService, moderationService)
+	identityService := service.InitIdentityService(identityRepository, notifier)
+	userService := service.InitProfileService(profileCache, profileRepository, privacyRepository, friendShipRepository, userRepository)
 
-	// Инициализация кеша ленты
-	feedCache := feed.NewFeedCache()
-	feedService := service.InitFeedService(feedCache, postRepository, friendShipRepository)
+	// Хранилище файлов и пул генерации миниатюр
+	blobStore, err := storage.NewLocalBlobStore(config.StorageConfig.MediaPath, config.StorageConfig.MediaBaseURL)
+	if err != nil {
+		log.Fatalf("Не удалось инициализировать хранилище файлов: %v", err)
+	}
+	thumbnailPool := avatar.NewThumbnailPool(config.StorageConfig.ThumbnailWorkers)
+	defer thumbnailPool.Close()
+	avatarService := service.InitAvatarService(config, blobStore, thumbnailPool, profileCache, profileRepository)
+
+	accountService := service.InitAccountService(config, userRepository, profileRepository, privacyRepository, friendShipRepository, postRepository, engagementRepository, identityRepository, sessionRepository, auditRepository, avatarService, profileCache)
+	go accountService.RunDeletionWorker(context.Background())
+
+	// Заявки в друзья и упоминания пишутся в журналы событий пользователей
+	notificationService := service.InitNotificationService(config, userRepository, moderationService)
 
-	authService := service.InitAuthService(config, userRepository, profileRepository)
-	userService := service.InitProfileService(profileRepository)
-	friendShipService := service.InitFriendShipService(userRepository, friendShipRepository, feedService)
-	postService := service.InitPostService(postRepository, userRepository, friendShipRepository, feedService)
+	// Очередь событий лент: повторные попытки с паузой, затем очередь недоставленных
+	broker, err := queue.NewBroker(config)
+	if err != nil {
+		log.Fatalf("Не удалось подключиться к очереди событий: %v", err)
+	}
+	defer broker.Close()
+	retryPolicy := queue.RetryPolicy{
+		MaxAttempts: config.QueueConfig.MaxAttempts,
+		Backoff:     config.QueueConfig.RetryBackoff,
+		MaxBackoff:  config.QueueConfig.MaxRetryBackoff,
+	}
+	// Повторы и отметки об обработке у каждого обработчика свои: сбой уведомлений
+	// не повторяет рассылку по лентам
+	queue.StartWorkers(context.Background(), broker, config.QueueConfig.Workers, queue.Sequence(
+		queue.Idempotent("feed", queue.Retrying(retryPolicy, feedService.HandleEvent)),
+		queue.Idempotent("notify", queue.Retrying(retryPolicy, notificationService.HandleEvent)),
+	))
+
+	// События постов и друзей пишутся в outbox вместе с изменением и публикуются в очередь отдельно
+	outboxRelay := service.InitOutboxRelay(config, outboxRepository, broker)
+	go outboxRelay.Run(context.Background())
+
+	friendShipService := service.InitFriendShipService(userRepository, friendShipRepository)
+	postService := service.InitPostService(postRepository, userRepository, engagementRepository, feedService, moderationService)
+
+	// Новые посты для клиентов WebSocket приходят через Redis pub/sub
+	hub := realtime.NewHub()
+	defer hub.Close()
+
+	// Прогрев лент недавно активных пользователей, например после очистки Redis.
+	// Прерванный прогрев продолжается; если его выполняет другой экземпляр, запуск пропускается
+	if days := config.FeedConfig.WarmUpActiveDays; days > 0 {
+		_, err = feedRebuildService.Start(context.Background(), &models.StartFeedRebuildRequest{ActiveDays: days, Resume: true})
+		if err != nil {
+			log.Printf("Прогрев лент не запущен: %v", err)
+		}
+	}
 
-	routes := handlers.InitRoutes(config, authService, userService, friendShipService, postService, routerDB)
+	routes := handlers.InitRoutes(config, authService, identityService, twoFactorService, sessionService, roleService, accountService, moderationService, userService, avatarService, friendShipService, postService, feedService, notificationService, feedRebuildService, hub, routerDB)
 	router := routes.Run()
 
 	server := &http.Server{
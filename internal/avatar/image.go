@@ -0,0 +1,126 @@
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path"
+	"strings"
+)
+
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+)
+
+var (
+	ErrImageTooLarge   = errors.New("Размер изображения превышает допустимый")
+	ErrImageMalformed  = errors.New("Файл не является корректным изображением")
+	ErrImageFormat     = errors.New("Поддерживаются только изображения JPEG и PNG")
+	ErrImageDimensions = errors.New("Разрешение изображения превышает допустимое")
+)
+
+// Исходное изображение аватара после проверки
+type Image struct {
+	// Оригинал, перекодированный из Image: метаданные загруженного файла (EXIF,
+	// в том числе геолокация) в него не попадают
+	Data   []byte
+	Format string
+	Image  image.Image
+}
+
+// Чтение и проверка загруженного изображения: размер файла, формат и разрешение
+func Decode(reader io.Reader, maxBytes int64, maxPixels int) (*Image, error) {
+	data, err := io.ReadAll(io.LimitReader(reader, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось прочитать изображение: %w", err)
+	}
+
+	if int64(len(data)) > maxBytes {
+		return nil, ErrImageTooLarge
+	}
+
+	// Проверяем разрешение до полного декодирования, чтобы не распаковывать "бомбы"
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err == image.ErrFormat {
+		return nil, ErrImageFormat
+	}
+	if err != nil {
+		return nil, ErrImageMalformed
+	}
+
+	if format != FormatJPEG && format != FormatPNG {
+		return nil, ErrImageFormat
+	}
+
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, ErrImageMalformed
+	}
+
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrImageDimensions
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrImageMalformed
+	}
+
+	data, err = encode(img, format)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось обработать изображение: %w", err)
+	}
+
+	return &Image{Data: data, Format: format, Image: img}, nil
+}
+
+// Расширение файла для формата
+func Extension(format string) string {
+	if format == FormatPNG {
+		return "png"
+	}
+
+	return "jpg"
+}
+
+// MIME-тип для формата
+func ContentType(format string) string {
+	if format == FormatPNG {
+		return "image/png"
+	}
+
+	return "image/jpeg"
+}
+
+func encode(img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+
+	if format == FormatPNG {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Ключ оригинала аватара в хранилище
+func OriginalKey(userId, avatarId, format string) string {
+	return fmt.Sprintf("avatars/%s/%s.%s", userId, avatarId, Extension(format))
+}
+
+// Ключ миниатюры, построенный по ключу оригинала
+func ThumbnailKey(originalKey string, size int) string {
+	ext := path.Ext(originalKey)
+
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(originalKey, ext), size, ext)
+}
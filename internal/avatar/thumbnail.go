@@ -0,0 +1,106 @@
+package avatar
+
+import (
+	"context"
+	"image"
+	"sync"
+
+	"golang.org/x/image/draw"
+)
+
+// Размеры миниатюр (сторона квадрата в пикселях)
+var ThumbnailSizes = []int{64, 256}
+
+type thumbnailJob struct {
+	src    image.Image
+	format string
+	size   int
+	result chan<- thumbnailResult
+}
+
+type thumbnailResult struct {
+	size int
+	data []byte
+	err  error
+}
+
+// Пул воркеров для генерации миниатюр
+type ThumbnailPool struct {
+	jobs chan thumbnailJob
+	wg   sync.WaitGroup
+}
+
+func NewThumbnailPool(workers int) *ThumbnailPool {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	pool := &ThumbnailPool{jobs: make(chan thumbnailJob)}
+	for i := 0; i < workers; i++ {
+		pool.wg.Add(1)
+		go pool.worker()
+	}
+
+	return pool
+}
+
+func (pool *ThumbnailPool) worker() {
+	defer pool.wg.Done()
+
+	for job := range pool.jobs {
+		data, err := encode(Thumbnail(job.src, job.size), job.format)
+		job.result <- thumbnailResult{size: job.size, data: data, err: err}
+	}
+}
+
+// Генерация миниатюр всех размеров. Возвращает закодированные изображения по размеру
+func (pool *ThumbnailPool) Generate(ctx context.Context, img *Image, sizes []int) (map[int][]byte, error) {
+	results := make(chan thumbnailResult, len(sizes))
+
+	for _, size := range sizes {
+		select {
+		case pool.jobs <- thumbnailJob{src: img.Image, format: img.Format, size: size, result: results}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	thumbnails := make(map[int][]byte, len(sizes))
+	for range sizes {
+		// Буфер results рассчитан на все задания, поэтому воркеры не блокируются при отмене
+		select {
+		case result := <-results:
+			if result.err != nil {
+				return nil, result.err
+			}
+			thumbnails[result.size] = result.data
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return thumbnails, nil
+}
+
+func (pool *ThumbnailPool) Close() {
+	close(pool.jobs)
+	pool.wg.Wait()
+}
+
+// Квадратная миниатюра: обрезка по центру и масштабирование фильтром Catmull-Rom
+func Thumbnail(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+
+	x0 := bounds.Min.X + (bounds.Dx()-side)/2
+	y0 := bounds.Min.Y + (bounds.Dy()-side)/2
+	crop := image.Rect(x0, y0, x0+side, y0+side)
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Src, nil)
+
+	return dst
+}
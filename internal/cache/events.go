@@ -0,0 +1,19 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+// Ключ-отметка об успешной обработке события очереди обработчиком handler
+func EventProcessedKey(handler, eventID string) string {
+	return fmt.Sprintf("event_processed:%s:%s", handler, eventID)
+}
+
+func MarkEventProcessed(handler, eventID string, ttl time.Duration) error {
+	return Set(EventProcessedKey(handler, eventID), 1, ttl)
+}
+
+func IsEventProcessed(handler, eventID string) (bool, error) {
+	return Exists(EventProcessedKey(handler, eventID))
+}
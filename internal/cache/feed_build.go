@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Удаление блокировки, только если она все еще принадлежит владельцу token
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// Ключ блокировки сборки ленты пользователя
+func FeedBuildLockKey(userID string) string {
+	return fmt.Sprintf("feed_build_lock:%s", userID)
+}
+
+// Ключ-отметка о полноте ленты пользователя: лента собрана из БД и содержит все
+// посты не старше нижней границы окна, записанной в значении
+func FeedCompleteKey(userID string) string {
+	return fmt.Sprintf("feed_complete:%s", userID)
+}
+
+// Ключ-отметка о свежести ленты пользователя: без нее лента отдается,
+// но пересобирается в фоне
+func FeedFreshKey(userID string) string {
+	return fmt.Sprintf("feed_fresh:%s", userID)
+}
+
+// Короткая блокировка с владельцем token. Истекает через ttl, если владелец
+// не снял ее сам (например, остановился)
+func AcquireLock(key, token string, ttl time.Duration) (bool, error) {
+	return SetNX(key, token, ttl)
+}
+
+func ReleaseLock(key, token string) error {
+	return releaseLockScript.Run(ctx, redisClient, []string{key}, token).Err()
+}
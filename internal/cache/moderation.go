@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+// Ключ с действующим ограничением пользователя (suspended, shadow_banned)
+func ModerationKey(userID string) string {
+	return fmt.Sprintf("moderation:%s", userID)
+}
+
+// Сохранение ограничения; ключ живет до окончания срока ограничения (ttl 0 - бессрочно)
+func SetModerationState(userID, state string, ttl time.Duration) error {
+	return Set(ModerationKey(userID), state, ttl)
+}
+
+func ClearModerationState(userID string) error {
+	return Del(ModerationKey(userID))
+}
+
+// Ключ-отметка о том, что в Redis записаны все действующие ограничения из БД.
+// Без нее (после очистки Redis) отсутствие ключа ограничения ничего не значит
+func ModerationSyncedKey() string {
+	return "moderation_synced"
+}
+
+func MarkModerationSynced() error {
+	return Set(ModerationSyncedKey(), 1, 0)
+}
+
+// Сброс отметки: следующее чтение заново загрузит ограничения из БД
+func ClearModerationSynced() error {
+	return Del(ModerationSyncedKey())
+}
+
+// Действующие ограничения пользователей; пользователи без ограничений в ответ не
+// попадают. synced - false, если кеш не заполнен и ограничения нужно читать из БД
+func GetModerationStates(userIDs []string) (states map[string]string, synced bool, err error) {
+	keys := make([]string, 0, len(userIDs)+1)
+	keys = append(keys, ModerationSyncedKey())
+	for _, userID := range userIDs {
+		keys = append(keys, ModerationKey(userID))
+	}
+
+	values, err := redisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if values[0] == nil {
+		return nil, false, nil
+	}
+
+	states = make(map[string]string)
+	for i, value := range values[1:] {
+		if state, ok := value.(string); ok {
+			states[userIDs[i]] = state
+		}
+	}
+
+	return states, true, nil
+}
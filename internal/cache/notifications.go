@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	notificationsLogSize = 1000               // Примерный размер журнала событий пользователя
+	notificationsTTL     = 7 * 24 * time.Hour // Журнал неактивного пользователя удаляется
+)
+
+// Ключ журнала событий пользователя (Redis stream)
+func NotificationsKey(userID string) string {
+	return fmt.Sprintf("notifications:%s", userID)
+}
+
+// Канал pub/sub, сообщающий о новых записях в журнале пользователя
+func NotificationsChannel(userID string) string {
+	return fmt.Sprintf("notifications_added:%s", userID)
+}
+
+// Ключ счетчика открытых потоков событий пользователя
+func StreamConnectionsKey(userID string) string {
+	return fmt.Sprintf("stream_connections:%s", userID)
+}
+
+// Добавление события в журнал пользователя в составе pipeline.
+// Подписчики узнают о новой записи через pub/sub
+func AddNotification(pipe redis.Pipeliner, userID, eventType string, data []byte) {
+	key := NotificationsKey(userID)
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		MaxLen: notificationsLogSize,
+		Approx: true,
+		Values: map[string]interface{}{"type": eventType, "data": data},
+	})
+	pipe.Expire(ctx, key, notificationsTTL)
+	pipe.Publish(ctx, NotificationsChannel(userID), eventType)
+}
+
+// Записи журнала начиная с id (включительно), не более count
+func GetNotificationsFrom(userID, id string, count int64) ([]redis.XMessage, error) {
+	return redisClient.XRangeN(ctx, NotificationsKey(userID), id, "+", count).Result()
+}
+
+// Идентификаторы первой и последней записи журнала; пустые, если журнал пуст
+func GetNotificationsBounds(userID string) (string, string, error) {
+	key := NotificationsKey(userID)
+	first, err := redisClient.XRangeN(ctx, key, "-", "+", 1).Result()
+	if err != nil || len(first) == 0 {
+		return "", "", err
+	}
+
+	last, err := redisClient.XRevRangeN(ctx, key, "+", "-", 1).Result()
+	if err != nil || len(last) == 0 {
+		return "", "", err
+	}
+
+	return first[0].ID, last[0].ID, nil
+}
+
+// Занимает место для потока событий, если открыто меньше limit. Счетчик истекает
+// через ttl без продления, чтобы потоки упавшего узла не занимали места навсегда
+func AcquireStreamConnection(userID string, limit int64, ttl time.Duration) (bool, error) {
+	key := StreamConnectionsKey(userID)
+	pipe := redisClient.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+
+	if count.Val() > limit {
+		return false, ReleaseStreamConnection(userID)
+	}
+
+	return true, nil
+}
+
+func ReleaseStreamConnection(userID string) error {
+	key := StreamConnectionsKey(userID)
+	count, err := redisClient.Decr(ctx, key).Result()
+	if err == nil && count <= 0 {
+		err = redisClient.Del(ctx, key).Err()
+	}
+
+	return err
+}
+
+func RefreshStreamConnections(userID string, ttl time.Duration) error {
+	return Expire(StreamConnectionsKey(userID), ttl)
+}
@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"log"
+	"social-network/pkg/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Повторное удаление ключа после инвалидации: реплика может отставать от мастера,
+// и промах сразу после изменения способен вернуть в кеш устаревшую анкету
+const profileInvalidateDelay = 2 * time.Second
+
+var ErrProfileNotFound = errors.New("Анкета не найдена")
+
+// Метрики кеша анкет, доступны по /debug/vars
+var (
+	profileCacheHits   = expvar.NewInt("profile_cache_hits")
+	profileCacheMisses = expvar.NewInt("profile_cache_misses")
+)
+
+// Загрузка анкет из БД для промахов кеша
+type ProfileLoader func(ctx context.Context, userIds []uuid.UUID) ([]*models.Profile, error)
+
+// Read-through кеш анкет пользователей
+type ProfileCache struct {
+	ttl    time.Duration
+	loader ProfileLoader
+}
+
+func NewProfileCache(ttl time.Duration, loader ProfileLoader) *ProfileCache {
+	return &ProfileCache{ttl: ttl, loader: loader}
+}
+
+// Анкета пользователя из кеша, при промахе - из БД
+func (profileCache *ProfileCache) Get(ctx context.Context, userId uuid.UUID) (*models.Profile, error) {
+	profiles, err := profileCache.GetMany(ctx, []uuid.UUID{userId})
+	if err != nil {
+		return nil, err
+	}
+
+	profile, ok := profiles[userId]
+	if !ok {
+		return nil, ErrProfileNotFound
+	}
+
+	return profile, nil
+}
+
+// Анкеты набора пользователей: одна команда MGET и один запрос в БД для всех промахов
+func (profileCache *ProfileCache) GetMany(ctx context.Context, userIds []uuid.UUID) (map[uuid.UUID]*models.Profile, error) {
+	result := make(map[uuid.UUID]*models.Profile, len(userIds))
+	if len(userIds) == 0 {
+		return result, nil
+	}
+
+	keys := make([]string, len(userIds))
+	for i, userId := range userIds {
+		keys[i] = ProfileKey(userId.String())
+	}
+
+	var missed []uuid.UUID
+	values, err := redisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		// Redis недоступен - читаем все из БД
+		log.Printf("Не удалось прочитать анкеты из кеша: %v", err)
+		values = make([]interface{}, len(keys))
+	}
+
+	for i, value := range values {
+		raw, ok := value.(string)
+		if !ok {
+			missed = append(missed, userIds[i])
+			continue
+		}
+
+		var profile models.Profile
+		if err := json.Unmarshal([]byte(raw), &profile); err != nil {
+			missed = append(missed, userIds[i])
+			continue
+		}
+
+		result[userIds[i]] = &profile
+	}
+
+	profileCacheHits.Add(int64(len(result)))
+	profileCacheMisses.Add(int64(len(missed)))
+
+	if len(missed) == 0 {
+		return result, nil
+	}
+
+	profiles, err := profileCache.loader(ctx, missed)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := redisClient.Pipeline()
+	for _, profile := range profiles {
+		profileJSON, err := json.Marshal(profile)
+		if err != nil {
+			continue
+		}
+		pipe.Set(ctx, ProfileKey(profile.UserId.String()), profileJSON, profileCache.ttl)
+		result[profile.UserId] = profile
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Не удалось сохранить анкеты в кеш: %v", err)
+	}
+
+	return result, nil
+}
+
+// Сброс закешированных анкет (изменение анкеты, удаление аккаунта)
+func (profileCache *ProfileCache) Invalidate(userIds ...uuid.UUID) error {
+	if len(userIds) == 0 {
+		return nil
+	}
+
+	keys := make([]string, len(userIds))
+	for i, userId := range userIds {
+		keys[i] = ProfileKey(userId.String())
+	}
+
+	time.AfterFunc(profileInvalidateDelay, func() {
+		if err := Del(keys...); err != nil {
+			log.Printf("Не удалось повторно сбросить кеш анкет: %v", err)
+		}
+	})
+
+	return Del(keys...)
+}
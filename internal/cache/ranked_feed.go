@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Ключ порядка ранжированной ленты пользователя в режиме mode, ранжированной в
+// момент rankedAt (UnixNano). Все страницы одного курсора читаются из этого списка
+func RankedFeedKey(userID, mode string, rankedAt int64) string {
+	return fmt.Sprintf("ranked_feed:%s:%s:%d", userID, mode, rankedAt)
+}
+
+// Сохранение порядка постов ранжированной ленты на ttl
+func SetRankedFeed(key string, postIDs []string, ttl time.Duration) error {
+	return Set(key, strings.Join(postIDs, ","), ttl)
+}
+
+// Порядок постов ранжированной ленты; found - false, если он не сохранен или истек
+func GetRankedFeed(key string) (postIDs []string, found bool, err error) {
+	value, err := Get(key)
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if value == "" {
+		return []string{}, true, nil
+	}
+
+	return strings.Split(value, ","), true, nil
+}
@@ -42,6 +42,11 @@ func GetClient() *redis.Client {
 	return redisClient
 }
 
+// Ключ множества авторов, посты которых подмешиваются в ленты при чтении
+func PullAuthorsKey() string {
+	return "pull_authors"
+}
+
 // Ключ для ленты пользователя
 func FeedKey(userID string) string {
 	return fmt.Sprintf("feed:%s", userID)
@@ -57,6 +62,21 @@ func UserPostsKey(userID string) string {
 	return fmt.Sprintf("user_posts:%s", userID)
 }
 
+// Канал pub/sub о новых постах в ленте пользователя
+func FeedPostedChannel(userID string) string {
+	return fmt.Sprintf("feed_posted:%s", userID)
+}
+
+// Канал pub/sub о новых постах автора, которому рассылка по лентам не делается
+func AuthorPostedChannel(authorID string) string {
+	return fmt.Sprintf("author_posted:%s", authorID)
+}
+
+// Ключ для анкеты пользователя
+func ProfileKey(userID string) string {
+	return fmt.Sprintf("profile:%s", userID)
+}
+
 // Ключ для друга
 func FriendsKey(userID string) string {
 	return fmt.Sprintf("friends:%s", userID)
@@ -66,6 +86,11 @@ func Set(key string, value interface{}, expiration time.Duration) error {
 	return redisClient.Set(ctx, key, value, expiration).Err()
 }
 
+// Установка значения, только если ключа нет; true, если значение установлено
+func SetNX(key string, value interface{}, expiration time.Duration) (bool, error) {
+	return redisClient.SetNX(ctx, key, value, expiration).Result()
+}
+
 func Get(key string) (string, error) {
 	return redisClient.Get(ctx, key).Result()
 }
@@ -89,6 +114,16 @@ func ZRevRange(key string, start, stop int64) ([]string, error) {
 	return redisClient.ZRevRange(ctx, key, start, stop).Result()
 }
 
+// Получение по диапазону оценок в порядке убывания вместе с оценками. Границы max и min
+// передаются в формате Redis: "(" перед значением делает границу исключающей
+func ZRevRangeByScoreWithScores(key, max, min string, count int64) ([]redis.Z, error) {
+	return redisClient.ZRevRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+		Max:   max,
+		Min:   min,
+		Count: count,
+	}).Result()
+}
+
 // Удаление элемента
 func ZRem(key string, members ...interface{}) error {
 	return redisClient.ZRem(ctx, key, members...).Err()
@@ -102,6 +137,10 @@ func ZRemRangeByRank(key string, start, stop int64) error {
 	return redisClient.ZRemRangeByRank(ctx, key, start, stop).Err()
 }
 
+func SMembers(key string) ([]string, error) {
+	return redisClient.SMembers(ctx, key).Result()
+}
+
 func Exists(key string) (bool, error) {
 	result, err := redisClient.Exists(ctx, key).Result()
 	return result > 0, err
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+// Ключ-отметка об отзыве сессии
+func SessionRevokedKey(sessionID string) string {
+	return fmt.Sprintf("session_revoked:%s", sessionID)
+}
+
+// Ключ-отметка о том, что сессия не отозвана (по данным БД)
+func SessionActiveKey(sessionID string) string {
+	return fmt.Sprintf("session_active:%s", sessionID)
+}
+
+// Ключ, ограничивающий частоту обновления времени последней активности сессии
+func SessionSeenKey(sessionID string) string {
+	return fmt.Sprintf("session_seen:%s", sessionID)
+}
+
+// Отметка об отзыве сессии. Хранится не дольше срока действия токена:
+// после этого токены сессии истекают сами
+func RevokeSession(sessionID string, tokenTTL time.Duration) error {
+	pipe := redisClient.TxPipeline()
+	pipe.Set(ctx, SessionRevokedKey(sessionID), 1, tokenTTL)
+	pipe.Del(ctx, SessionActiveKey(sessionID))
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+// Отметка о том, что сессия не отозвана, на время ttl
+func MarkSessionActive(sessionID string, ttl time.Duration) error {
+	return Set(SessionActiveKey(sessionID), 1, ttl)
+}
+
+// Состояние сессии из кеша. cached - false, если отметок нет (например, после
+// очистки Redis) и состояние нужно прочитать из БД
+func GetSessionRevoked(sessionID string) (revoked bool, cached bool, err error) {
+	pipe := redisClient.Pipeline()
+	revokedCmd := pipe.Exists(ctx, SessionRevokedKey(sessionID))
+	activeCmd := pipe.Exists(ctx, SessionActiveKey(sessionID))
+	if _, err = pipe.Exec(ctx); err != nil {
+		return false, false, err
+	}
+
+	if revokedCmd.Val() > 0 {
+		return true, true, nil
+	}
+
+	return false, activeCmd.Val() > 0, nil
+}
+
+// Возвращает true не чаще одного раза за interval для каждой сессии
+func ShouldTouchSession(sessionID string, interval time.Duration) (bool, error) {
+	return SetNX(SessionSeenKey(sessionID), 1, interval)
+}
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Ключ с моментом отзыва всех токенов пользователя (кеш users.tokens_revoked_at)
+func TokensRevokedKey(userID string) string {
+	return fmt.Sprintf("tokens_revoked:%s", userID)
+}
+
+// Кеширование момента отзыва токенов пользователя из БД на время ttl; нулевое
+// время - токены не отзывались
+func SetTokensRevokedAt(userID string, at time.Time, ttl time.Duration) error {
+	var seconds int64
+	if !at.IsZero() {
+		seconds = at.Unix()
+	}
+
+	return Set(TokensRevokedKey(userID), seconds, ttl)
+}
+
+// Момент отзыва токенов пользователя из кеша. cached - false, если значения в
+// кеше нет и его нужно прочитать из БД
+func GetTokensRevokedAt(userID string) (at time.Time, cached bool, err error) {
+	value, err := Get(TokensRevokedKey(userID))
+	if err == redis.Nil {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if seconds == 0 {
+		return time.Time{}, true, nil
+	}
+
+	return time.Unix(seconds, 0), true, nil
+}
@@ -3,8 +3,12 @@ package feed
 import (
 	"context"
 	"encoding/json"
+	"math"
 	"social-network/internal/cache"
 	"social-network/pkg/models"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -12,16 +16,18 @@ import (
 )
 
 const (
-	feedSize            = 1000           // Размер ленты
+	FeedSize            = 1000           // Размер ленты
 	feedExpiration      = 24 * time.Hour // Лента хранится 24 часа
 	postCacheExpiration = 24 * time.Hour // Посты храним 24 часа
 )
 
 type FeedCache struct {
+	// Число друзей, выше которого посты автора не рассылаются по лентам
+	fanOutThreshold int
 }
 
-func NewFeedCache() *FeedCache {
-	return &FeedCache{}
+func NewFeedCache(fanOutThreshold int) *FeedCache {
+	return &FeedCache{fanOutThreshold: fanOutThreshold}
 }
 
 // Добавление поста в ленту определенного пользователя userId
@@ -41,8 +47,9 @@ func (feed *FeedCache) AddPostIntoUserFeed(userId uuid.UUID, post *models.Post)
 		Member: post.Id.String(),
 	})
 
-	pipe.ZRemRangeByRank(context.Background(), feedKey, 0, -feedSize-1)
+	pipe.ZRemRangeByRank(context.Background(), feedKey, 0, -FeedSize-1)
 	pipe.Expire(context.Background(), feedKey, feedExpiration)
+	pipe.Expire(context.Background(), cache.FeedCompleteKey(userId.String()), feedExpiration)
 	pipe.Set(context.Background(), postKey, postJSON, postCacheExpiration)
 
 	pipe.ZAdd(context.Background(), authorKey, &redis.Z{
@@ -62,40 +69,226 @@ func (feed *FeedCache) DeletePostFromFeed(userId uuid.UUID, post *models.Post) e
 	return cache.ZRem(feedKey, post.Id.String())
 }
 
-// Возвращаем ленту пользователя из кеша
-func (feed *FeedCache) GetFeedByUserId(userId uuid.UUID, limit, offset int) ([]*models.Post, error) {
-	feedUserKey := cache.FeedKey(userId.String())
-	// Получаем все id постов в ленте конкретного пользователя
-	postIds, err := cache.ZRevRange(feedUserKey, int64(offset), int64(offset+limit-1))
+// Страница ленты из кеша
+type CachedFeedPage struct {
+	// Позиции постов страницы в порядке ленты. Если их меньше запрошенного, окно
+	// ленты в кеше закончилось и остаток страницы нужно читать из БД после последней
+	Positions []models.FeedCursor
+	// Содержимое постов страницы, найденное в кеше; отсутствующие читаются из БД
+	Posts map[uuid.UUID]*models.Post
+}
+
+// Возвращаем из кеша страницу ленты пользователя, начиная строго после курсора.
+// Посты авторов pullAuthorIds берутся из их списков постов и подмешиваются к ленте.
+// Оценка поста - created_at в наносекундах, в пределах одной оценки Redis
+// упорядочивает id лексикографически, что совпадает с порядком id в БД.
+// Кеш достоверен только для собранной ленты и только до нижней границы ее окна:
+// более старые посты (и вся лента, если она не собрана) читаются из БД
+func (feed *FeedCache) GetFeedByUserId(userId uuid.UUID, pullAuthorIds []uuid.UUID, cursor *models.FeedCursor, limit int) (*CachedFeedPage, error) {
+	page := &CachedFeedPage{Posts: make(map[uuid.UUID]*models.Post)}
+	floor, complete, err := windowFloor(userId)
+	if err != nil || !complete {
+		return page, err
+	}
+
+	members, err := pageMembers(cache.FeedKey(userId.String()), cursor, limit)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(postIds) <= 0 {
-		return nil, nil
-	}
+	if len(pullAuthorIds) > 0 {
+		for _, authorId := range pullAuthorIds {
+			authorMembers, err := pageMembers(cache.UserPostsKey(authorId.String()), cursor, limit)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, authorMembers...)
+		}
 
-	var posts []*models.Post
-	for _, postId := range postIds {
-		postKey := cache.PostKey(postId)
-		postJSON, err := cache.Get(postKey)
-		if err != nil {
-			if err == redis.Nil {
-				continue
+		// Пост автора мог попасть в ленту до того, как рассылка для него была отключена
+		sort.Slice(members, func(i, j int) bool {
+			return memberAfter(members[j], members[i])
+		})
+		unique := members[:0]
+		for i, member := range members {
+			if i == 0 || member.Member != members[i-1].Member {
+				unique = append(unique, member)
 			}
+		}
+		members = unique
+	}
 
+	// Посты ниже границы окна (например, пришедшие с опозданием) в кеше неполны
+	for len(members) > 0 && memberAfter(members[len(members)-1], floor) {
+		members = members[:len(members)-1]
+	}
+	if len(members) > limit {
+		members = members[:limit]
+	}
+
+	if len(members) <= 0 {
+		return page, nil
+	}
+
+	postKeys := make([]string, 0, len(members))
+	for _, member := range members {
+		postId, err := uuid.Parse(member.Member.(string))
+		if err != nil {
 			return nil, err
 		}
+		page.Positions = append(page.Positions, models.FeedCursor{CreatedAt: scoreTime(member.Score), Id: postId})
+		postKeys = append(postKeys, cache.PostKey(postId.String()))
+	}
+
+	values, err := cache.GetClient().MGet(context.Background(), postKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range values {
+		postJSON, ok := value.(string)
+		if !ok {
+			// Пост вытеснен из кеша
+			continue
+		}
 
 		var post models.Post
 		if err := json.Unmarshal([]byte(postJSON), &post); err != nil {
 			return nil, err
 		}
+		page.Posts[post.Id] = &post
+	}
+
+	return page, nil
+}
+
+// Нижняя граница окна собранной ленты: самый старый пост, начиная с которого
+// кеш содержит все посты ленты. Граница поднимается, когда старые посты
+// вытесняются из окна новыми. complete - false, если лента не собрана
+func windowFloor(userId uuid.UUID) (redis.Z, bool, error) {
+	floor := redis.Z{Score: math.Inf(-1), Member: ""}
+	value, err := cache.Get(cache.FeedCompleteKey(userId.String()))
+	if err == redis.Nil {
+		return floor, false, nil
+	}
+	if err != nil {
+		return floor, false, err
+	}
+
+	// Значение - "<оценка>:<id>" самого старого поста окна или "-inf"
+	if score, member, found := strings.Cut(value, ":"); found {
+		floor.Score, err = strconv.ParseFloat(score, 64)
+		if err != nil {
+			return floor, false, err
+		}
+		floor.Member = member
+	}
+
+	oldest, err := cache.GetClient().ZRangeWithScores(context.Background(), cache.FeedKey(userId.String()), 0, 0).Result()
+	if err != nil {
+		return floor, false, err
+	}
+	if len(oldest) > 0 && memberAfter(floor, oldest[0]) {
+		floor = oldest[0]
+	}
+
+	return floor, true, nil
+}
+
+// Идет ли элемент a после b в порядке ленты (по оценке и id по убыванию)
+func memberAfter(a, b redis.Z) bool {
+	if a.Score != b.Score {
+		return a.Score < b.Score
+	}
+
+	return a.Member.(string) < b.Member.(string)
+}
+
+// Время публикации по оценке поста. Точности float64 хватает для микросекунд,
+// с которыми время хранится в БД
+func scoreTime(score float64) time.Time {
+	return time.Unix(0, int64(score)).UTC().Round(time.Microsecond)
+}
+
+// Не более limit элементов отсортированного множества key, идущих строго после курсора
+func pageMembers(key string, cursor *models.FeedCursor, limit int) ([]redis.Z, error) {
+	max := "+inf"
+	var members []redis.Z
+	if cursor != nil {
+		score := strconv.FormatFloat(float64(cursor.CreatedAt.UnixNano()), 'f', -1, 64)
+
+		// Посты с тем же временем, что и у курсора, но идущие после него
+		sameScore, err := cache.ZRevRangeByScoreWithScores(key, score, score, 0)
+		if err != nil {
+			return nil, err
+		}
+		cursorId := cursor.Id.String()
+		for _, member := range sameScore {
+			if member.Member.(string) < cursorId && len(members) < limit {
+				members = append(members, member)
+			}
+		}
 
-		posts = append(posts, &post)
+		max = "(" + score
 	}
 
-	return posts, nil
+	if len(members) < limit {
+		older, err := cache.ZRevRangeByScoreWithScores(key, max, "-inf", int64(limit-len(members)))
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, older...)
+	}
+
+	return members, nil
+}
+
+// Рассылка поста по лентам друзей. Если друзей больше порога, пост остается только
+// в списке постов автора, а сам автор помечается для подмешивания при чтении
+func (feed *FeedCache) FanOut(post *models.Post, friendIds []uuid.UUID) error {
+	if len(friendIds) > feed.fanOutThreshold {
+		postJSON, err := json.Marshal(post)
+		if err != nil {
+			return err
+		}
+
+		pipe := cache.GetClient().Pipeline()
+		pipe.SAdd(context.Background(), cache.PullAuthorsKey(), post.UserId.String())
+		pipe.Publish(context.Background(), cache.AuthorPostedChannel(post.UserId.String()), postJSON)
+		_, err = pipe.Exec(context.Background())
+
+		return err
+	}
+
+	return feed.AddPostToFriendFeeds(post.UserId, post, friendIds)
+}
+
+// Авторы из числа friendIds, посты которых не рассылаются и подмешиваются при чтении
+func (feed *FeedCache) GetPullAuthors(friendIds []uuid.UUID) ([]uuid.UUID, error) {
+	members, err := cache.SMembers(cache.PullAuthorsKey())
+	if err != nil || len(members) == 0 {
+		return nil, err
+	}
+
+	pullAuthors := make(map[string]bool, len(members))
+	for _, member := range members {
+		pullAuthors[member] = true
+	}
+
+	var authorIds []uuid.UUID
+	for _, friendId := range friendIds {
+		if pullAuthors[friendId.String()] {
+			authorIds = append(authorIds, friendId)
+		}
+	}
+
+	return authorIds, nil
+}
+
+// Есть ли авторы, посты которых подмешиваются при чтении
+func (feed *FeedCache) HasPullAuthors() (bool, error) {
+	count, err := cache.GetClient().SCard(context.Background(), cache.PullAuthorsKey()).Result()
+
+	return count > 0, err
 }
 
 // Добавление поста в ленту друзей
@@ -121,8 +314,16 @@ func (feed *FeedCache) AddPostToFriendFeeds(userId uuid.UUID, post *models.Post,
 			Score:  float64(post.CreatedAt.UnixNano()),
 			Member: post.Id.String(),
 		})
-		pipe.ZRemRangeByRank(context.Background(), feedKey, 0, -feedSize-1)
+		pipe.ZRemRangeByRank(context.Background(), feedKey, 0, -FeedSize-1)
 		pipe.Expire(context.Background(), feedKey, feedExpiration)
+		pipe.Expire(context.Background(), cache.FeedCompleteKey(friendID.String()), feedExpiration)
+	}
+
+	// Уведомляем друзей после записи в ленты, чтобы пост уже был в ленте: подключенных
+	// по WebSocket - через pub/sub, а в журнал событий - для потока SSE
+	for _, friendID := range friendIds {
+		pipe.Publish(context.Background(), cache.FeedPostedChannel(friendID.String()), postJSON)
+		cache.AddNotification(pipe, friendID.String(), models.NotificationFeedPost, postJSON)
 	}
 
 	authorPostKey := cache.UserPostsKey(post.UserId.String())
@@ -137,80 +338,93 @@ func (feed *FeedCache) AddPostToFriendFeeds(userId uuid.UUID, post *models.Post,
 	return err
 }
 
-// Обновление собственной ленты при добавлении/удалении друга
-func (feed *FeedCache) UpdateUserFeedByAddedFriend(userId uuid.UUID, friendId uuid.UUID, isFriend bool) error {
-	friendFeedKey := cache.FeedKey(friendId.String())
-	postIds, err := cache.ZRange(friendFeedKey, 0, -1)
-	if err != nil {
-		return err
+// Собрана ли лента пользователя
+func (feed *FeedCache) IsMaterialized(userId uuid.UUID) (bool, error) {
+	return cache.Exists(cache.FeedCompleteKey(userId.String()))
+}
+
+// Прогрев кеша: лента пользователя заменяется окном из последних FeedSize постов
+// posts, прочитанных из БД в момент loadedAt, и отмечается собранной. Если постов
+// меньше размера ленты, окно содержит всю ленту и нижней границы нет. Лента не
+// удаляется целиком: посты новее loadedAt разосланы в нее после чтения из БД и
+// сохраняются, а остальные посты не из окна (удаленные, посты бывших друзей) убираются
+func (feed *FeedCache) WarmUpCache(userId uuid.UUID, posts []*models.Post, loadedAt time.Time) error {
+	window := make([]redis.Z, 0, len(posts))
+	for _, post := range posts {
+		window = append(window, redis.Z{Score: float64(post.CreatedAt.UnixNano()), Member: post.Id.String()})
 	}
-	if len(postIds) <= 0 {
-		return nil
+	sort.Slice(window, func(i, j int) bool {
+		return memberAfter(window[j], window[i])
+	})
+	if len(window) > FeedSize {
+		window = window[:FeedSize]
 	}
 
-	pipe := cache.GetClient().Pipeline()
-	feedKey := cache.FeedKey(userId.String())
-	if isFriend {
-		for _, postId := range postIds {
-			postKey := cache.PostKey(postId)
-			postJSON, err := cache.GetClient().Get(context.Background(), postKey).Result()
-			if err != nil && err != redis.Nil {
-				continue
-			}
+	floor := "-inf"
+	if len(window) == FeedSize {
+		oldest := window[len(window)-1]
+		floor = strconv.FormatFloat(oldest.Score, 'f', -1, 64) + ":" + oldest.Member.(string)
+	}
 
-			if postJSON == "" {
-				continue
-			}
+	feedKey := cache.FeedKey(userId.String())
+	cached, err := cache.GetClient().ZRangeWithScores(context.Background(), feedKey, 0, -1).Result()
+	if err != nil {
+		return err
+	}
 
-			var post models.Post
-			err = json.Unmarshal([]byte(postJSON), &post)
-			if err != nil {
-				continue
-			}
+	inWindow := make(map[string]bool, len(window))
+	for _, member := range window {
+		inWindow[member.Member.(string)] = true
+	}
+	loadedScore := float64(loadedAt.UnixNano())
+	var stale []interface{}
+	for _, member := range cached {
+		if inWindow[member.Member.(string)] || member.Score > loadedScore {
+			continue
+		}
+		stale = append(stale, member.Member)
+	}
 
-			pipe.ZAdd(context.Background(), feedKey, &redis.Z{
-				Score:  float64(post.CreatedAt.UnixNano()),
-				Member: post.Id.String(),
-			})
+	pipe := cache.GetClient().TxPipeline()
+	if len(stale) > 0 {
+		pipe.ZRem(context.Background(), feedKey, stale...)
+	}
+	for _, post := range posts {
+		if !inWindow[post.Id.String()] {
+			continue
 		}
-		pipe.ZRemRangeByRank(context.Background(), feedKey, 0, -feedSize-1)
-	} else {
-		for _, postId := range postIds {
-			pipe.ZRem(context.Background(), feedKey, postId)
+
+		postJSON, err := json.Marshal(post)
+		if err != nil {
+			return err
 		}
+		pipe.Set(context.Background(), cache.PostKey(post.Id.String()), postJSON, postCacheExpiration)
 	}
-
+	for i := range window {
+		pipe.ZAdd(context.Background(), feedKey, &window[i])
+	}
+	pipe.ZRemRangeByRank(context.Background(), feedKey, 0, -FeedSize-1)
 	pipe.Expire(context.Background(), feedKey, feedExpiration)
+	pipe.Set(context.Background(), cache.FeedCompleteKey(userId.String()), floor, feedExpiration)
 	_, err = pipe.Exec(context.Background())
 
 	return err
 }
 
-// Прогрев кеша
-func (feed *FeedCache) WarmUpCache(userId uuid.UUID, posts []*models.Post) error {
-	if len(posts) <= 0 {
+// Сохранение содержимого постов, прочитанных из БД
+func (feed *FeedCache) CachePosts(posts []*models.Post) error {
+	if len(posts) == 0 {
 		return nil
 	}
 
-	feedKey := cache.FeedKey(userId.String())
 	pipe := cache.GetClient().Pipeline()
-
 	for _, post := range posts {
-		postKey := cache.PostKey(post.Id.String())
 		postJSON, err := json.Marshal(post)
 		if err != nil {
-			continue
+			return err
 		}
-		pipe.Set(context.Background(), postKey, postJSON, postCacheExpiration)
-
-		// Пост в ленту пользователя
-		pipe.ZAdd(context.Background(), feedKey, &redis.Z{
-			Score:  float64(post.CreatedAt.UnixNano()),
-			Member: post.Id.String(),
-		})
+		pipe.Set(context.Background(), cache.PostKey(post.Id.String()), postJSON, postCacheExpiration)
 	}
-	pipe.ZRemRangeByRank(context.Background(), feedKey, 0, -feedSize-1)
-	pipe.Expire(context.Background(), feedKey, feedExpiration)
 	_, err := pipe.Exec(context.Background())
 
 	return err
@@ -223,7 +437,47 @@ func (feed *FeedCache) GetInfoByUserFeed(userId uuid.UUID) (int64, error) {
 	return cache.ZCard(feedKey)
 }
 
-func (feed *FeedCache) DeletePost(postId uuid.UUID) error {
-	postKey := cache.PostKey(postId.String())
-	return cache.Del(postKey)
+// Удаление из кеша всех данных удаленного пользователя: его ленты, списка и содержимого
+// постов, а также его постов в лентах друзей
+func (feed *FeedCache) PurgeUser(userId uuid.UUID, postIds []uuid.UUID, friendIds []uuid.UUID) error {
+	authorKey := cache.UserPostsKey(userId.String())
+
+	// В кеше могут быть посты, которых уже нет в БД
+	cachedIds, err := cache.ZRange(authorKey, 0, -1)
+	if err != nil {
+		return err
+	}
+
+	members := make([]interface{}, 0, len(postIds)+len(cachedIds))
+	keys := []string{cache.FeedKey(userId.String()), cache.FeedCompleteKey(userId.String()), cache.FeedFreshKey(userId.String()), authorKey}
+	for _, postId := range postIds {
+		members = append(members, postId.String())
+		keys = append(keys, cache.PostKey(postId.String()))
+	}
+	for _, postId := range cachedIds {
+		members = append(members, postId)
+		keys = append(keys, cache.PostKey(postId))
+	}
+
+	pipe := cache.GetClient().Pipeline()
+	if len(members) > 0 {
+		for _, friendId := range friendIds {
+			pipe.ZRem(context.Background(), cache.FeedKey(friendId.String()), members...)
+		}
+	}
+	pipe.Del(context.Background(), keys...)
+	pipe.SRem(context.Background(), cache.PullAuthorsKey(), userId.String())
+	_, err = pipe.Exec(context.Background())
+
+	return err
+}
+
+// Удаление содержимого поста и поста из списка постов автора
+func (feed *FeedCache) DeletePost(post *models.Post) error {
+	pipe := cache.GetClient().Pipeline()
+	pipe.Del(context.Background(), cache.PostKey(post.Id.String()))
+	pipe.ZRem(context.Background(), cache.UserPostsKey(post.UserId.String()), post.Id.String())
+	_, err := pipe.Exec(context.Background())
+
+	return err
 }
@@ -0,0 +1,143 @@
+package feed
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"social-network/internal/cache"
+	"social-network/internal/config"
+	"social-network/pkg/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+)
+
+const benchThreshold = 1000
+
+// Запуск Redis в памяти и подключение к нему пакета cache
+func startRedis(b *testing.B) {
+	b.Helper()
+
+	server := miniredis.RunT(b)
+	port, err := strconv.Atoi(server.Port())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	cnf := &config.Config{RedisConfig: config.RedisConfig{RedisHost: server.Host(), RedisPort: port}}
+	if err = cache.InitRedis(cnf); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { _ = cache.Close() })
+}
+
+func newPost(authorId uuid.UUID, createdAt time.Time) *models.Post {
+	return &models.Post{
+		Id:        uuid.New(),
+		UserId:    authorId,
+		Title:     "title",
+		Content:   "content",
+		CreatedAt: createdAt,
+	}
+}
+
+func newIds(count int) []uuid.UUID {
+	ids := make([]uuid.UUID, count)
+	for i := range ids {
+		ids[i] = uuid.New()
+	}
+
+	return ids
+}
+
+// Стоимость публикации поста: рассылка по лентам друзей ниже порога
+// и запись только в список постов автора выше порога
+func BenchmarkPublishPost(b *testing.B) {
+	cases := []struct {
+		name      string
+		friends   int
+		threshold int
+	}{
+		{"below_threshold/push/friends=100", 100, benchThreshold},
+		{"above_threshold/pull/friends=5000", 5000, benchThreshold},
+		{"above_threshold/push_without_limit/friends=5000", 5000, math.MaxInt},
+	}
+
+	for _, tc := range cases {
+		b.Run(tc.name, func(b *testing.B) {
+			startRedis(b)
+			feed := NewFeedCache(tc.threshold)
+			authorId := uuid.New()
+			friendIds := newIds(tc.friends)
+			start := time.Now()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				post := newPost(authorId, start.Add(time.Duration(i)*time.Microsecond))
+				if err := feed.AddPostIntoUserFeed(authorId, post); err != nil {
+					b.Fatal(err)
+				}
+				if err := feed.FanOut(post, friendIds); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// Стоимость чтения страницы ленты: только своя лента (все авторы ниже порога)
+// и своя лента с подмешиванием постов авторов выше порога
+func BenchmarkReadFeed(b *testing.B) {
+	const (
+		pageSize       = 20
+		postsPerAuthor = 200
+	)
+
+	for _, pullAuthors := range []int{0, 1, 10} {
+		name := fmt.Sprintf("below_threshold/pull_authors=%d", pullAuthors)
+		if pullAuthors > 0 {
+			name = fmt.Sprintf("above_threshold/pull_authors=%d", pullAuthors)
+		}
+
+		b.Run(name, func(b *testing.B) {
+			startRedis(b)
+			feed := NewFeedCache(benchThreshold)
+			readerId := uuid.New()
+			start := time.Now()
+
+			// Лента читателя заполнена постами друзей ниже порога
+			var posts []*models.Post
+			for i := 0; i < FeedSize; i++ {
+				posts = append(posts, newPost(uuid.New(), start.Add(time.Duration(i)*time.Microsecond)))
+			}
+			if err := feed.WarmUpCache(readerId, posts, time.Now()); err != nil {
+				b.Fatal(err)
+			}
+
+			// Посты авторов выше порога есть только в их списках постов
+			authorIds := newIds(pullAuthors)
+			for _, authorId := range authorIds {
+				for i := 0; i < postsPerAuthor; i++ {
+					post := newPost(authorId, start.Add(time.Duration(i)*time.Millisecond))
+					if err := feed.AddPostIntoUserFeed(authorId, post); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				page, err := feed.GetFeedByUserId(readerId, authorIds, nil, pageSize)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(page.Positions) != pageSize {
+					b.Fatalf("получено %d постов вместо %d", len(page.Positions), pageSize)
+				}
+			}
+		})
+	}
+}
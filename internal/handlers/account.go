@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"social-network/internal/config"
+	"social-network/pkg/models"
+	"social-network/pkg/service"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AccountHandler interface {
+	ExportData(w http.ResponseWriter, r *http.Request)
+	ScheduleDeletion(w http.ResponseWriter, r *http.Request)
+	CancelDeletion(w http.ResponseWriter, r *http.Request)
+}
+
+type accountHandler struct {
+	config         *config.Config
+	accountService service.AccountService
+}
+
+func InitAccountHandler(config *config.Config, accountService service.AccountService) AccountHandler {
+	return &accountHandler{config: config, accountService: accountService}
+}
+
+// Выгрузка персональных данных zip-архивом
+func (handler *accountHandler) ExportData(w http.ResponseWriter, r *http.Request) {
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	fileName := fmt.Sprintf("export-%s-%s.zip", currentUserId, time.Now().UTC().Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Архив пишется в ответ потоком: после начала записи сменить статус уже нельзя
+	err = handler.accountService.Export(r.Context(), currentUserId, w)
+	if err != nil {
+		log.Printf("Не удалось выгрузить данные пользователя %s: %v", currentUserId, err)
+	}
+}
+
+func (handler *accountHandler) ScheduleDeletion(w http.ResponseWriter, r *http.Request) {
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	var request models.DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		models.SendErrorResponse(w, "Невалидные данные", http.StatusBadRequest)
+		return
+	}
+
+	deletionAt, err := handler.accountService.ScheduleDeletion(r.Context(), currentUserId, request.Password, clientIP(handler.config, r))
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(models.DeleteAccountResponse{DeletionScheduledAt: deletionAt})
+}
+
+func (handler *accountHandler) CancelDeletion(w http.ResponseWriter, r *http.Request) {
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	err = handler.accountService.CancelDeletion(r.Context(), currentUserId, clientIP(handler.config, r))
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Удаление аккаунта отменено"})
+}
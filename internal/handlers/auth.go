@@ -2,22 +2,37 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
+	"math"
 	"net/http"
+	"social-network/internal/config"
+	"social-network/internal/security"
 	"social-network/pkg/models"
+	"social-network/pkg/repository"
 	"social-network/pkg/service"
+	"strconv"
+
+	"github.com/google/uuid"
 )
 
 type AuthHandler interface {
 	UserRegister(w http.ResponseWriter, r *http.Request)
 	Login(w http.ResponseWriter, r *http.Request)
+	LoginTwoFactor(w http.ResponseWriter, r *http.Request)
+	ChangePassword(w http.ResponseWriter, r *http.Request)
+	RefreshToken(w http.ResponseWriter, r *http.Request)
+	ForgotPassword(w http.ResponseWriter, r *http.Request)
+	ResetPassword(w http.ResponseWriter, r *http.Request)
 }
 
 type authHandler struct {
+	config      *config.Config
 	authService service.AuthService
 }
 
-func InitAuthHandler(service service.AuthService) AuthHandler {
-	return &authHandler{authService: service}
+func InitAuthHandler(config *config.Config, service service.AuthService) AuthHandler {
+	return &authHandler{config: config, authService: service}
 }
 
 func (authHandler *authHandler) UserRegister(w http.ResponseWriter, r *http.Request) {
@@ -60,9 +75,70 @@ func (authHandler *authHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, err := authHandler.authService.Login(r.Context(), request.Id, request.Password)
+	login := request.Login
+	if login == "" {
+		login = request.Username
+	}
+	if login == "" {
+		login = request.Id
+	}
+
+	response, err := authHandler.authService.Login(r.Context(), login, request.Password, clientIP(authHandler.config, r), r.UserAgent())
+
+	var tooManyAttempts *security.TooManyAttemptsError
+	if errors.As(err, &tooManyAttempts) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(tooManyAttempts.RetryAfter.Seconds()))))
+		models.SendErrorResponse(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	var suspended *service.SuspendedError
+	if errors.As(err, &suspended) {
+		models.SendErrorResponse(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		models.SendErrorResponse(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка входа: %v", err)
+		models.SendErrorResponse(w, "Не удалось выполнить вход", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Второй шаг входа при включенной двухфакторной аутентификации
+func (authHandler *authHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		models.SendErrorResponse(w, "Метод не найден", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request models.TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		models.SendErrorResponse(w, "Невалидные данные", http.StatusBadRequest)
+		return
+	}
+
+	response, err := authHandler.authService.CompleteTwoFactorLogin(r.Context(), request.ChallengeToken, request.Code, clientIP(authHandler.config, r), r.UserAgent())
+
+	var tooManyAttempts *security.TooManyAttemptsError
+	if errors.As(err, &tooManyAttempts) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(tooManyAttempts.RetryAfter.Seconds()))))
+		models.SendErrorResponse(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	var suspended *service.SuspendedError
+	if errors.As(err, &suspended) {
+		models.SendErrorResponse(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
-		models.SendErrorResponse(w, "Пользователь не найден", http.StatusNotFound)
+		models.SendErrorResponse(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
 
@@ -70,3 +146,120 @@ func (authHandler *authHandler) Login(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+func (authHandler *authHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		models.SendErrorResponse(w, "Метод не найден", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	// Для токенов, выпущенных до появления сессий, заголовка нет - uuid.Nil
+	currentSessionId, _ := uuid.Parse(r.Header.Get("X-Session-ID"))
+
+	var request models.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		models.SendErrorResponse(w, "Невалидные данные", http.StatusBadRequest)
+		return
+	}
+
+	response, err := authHandler.authService.ChangePassword(r.Context(), currentUserId, currentSessionId, request.OldPassword, request.NewPassword)
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Новый токен для текущей сессии; в него попадают актуальные роли пользователя
+func (authHandler *authHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+	currentSessionId, _ := uuid.Parse(r.Header.Get("X-Session-ID"))
+
+	response, err := authHandler.authService.RefreshToken(r.Context(), currentUserId, currentSessionId)
+	if errors.Is(err, repository.ErrSessionEnded) {
+		models.SendErrorResponse(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Запрос сброса пароля. Ответ одинаков для существующих и несуществующих аккаунтов
+func (authHandler *authHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		models.SendErrorResponse(w, "Метод не найден", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request models.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		models.SendErrorResponse(w, "Невалидные данные", http.StatusBadRequest)
+		return
+	}
+
+	err := authHandler.authService.RequestPasswordReset(r.Context(), request.Login, clientIP(authHandler.config, r))
+
+	var tooManyRequests *security.TooManyRequestsError
+	if errors.As(err, &tooManyRequests) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(tooManyRequests.RetryAfter.Seconds()))))
+		models.SendErrorResponse(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		models.SendErrorResponse(w, "Не удалось отправить токен сброса пароля", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Если аккаунт существует, на указанный адрес отправлен токен для сброса пароля"})
+}
+
+func (authHandler *authHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		models.SendErrorResponse(w, "Метод не найден", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request models.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		models.SendErrorResponse(w, "Невалидные данные", http.StatusBadRequest)
+		return
+	}
+
+	err := authHandler.authService.ResetPassword(r.Context(), request.Token, request.NewPassword, clientIP(authHandler.config, r))
+
+	var tooManyAttempts *security.TooManyAttemptsError
+	if errors.As(err, &tooManyAttempts) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(tooManyAttempts.RetryAfter.Seconds()))))
+		models.SendErrorResponse(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Пароль успешно изменен"})
+}
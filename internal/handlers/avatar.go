@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"social-network/internal/avatar"
+	"social-network/internal/config"
+	"social-network/internal/storage"
+	"social-network/pkg/models"
+	"social-network/pkg/service"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type AvatarHandler interface {
+	UploadAvatar(w http.ResponseWriter, r *http.Request)
+	DeleteAvatar(w http.ResponseWriter, r *http.Request)
+	GetMedia(w http.ResponseWriter, r *http.Request)
+}
+
+type avatarHandler struct {
+	config        *config.Config
+	avatarService service.AvatarService
+}
+
+func InitAvatarHandler(config *config.Config, avatarService service.AvatarService) AvatarHandler {
+	return &avatarHandler{config: config, avatarService: avatarService}
+}
+
+// Загрузка аватара: multipart/form-data, файл в поле "avatar"
+func (handler *avatarHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		models.SendErrorResponse(w, "Метод не найден", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	// Запас в 1 МБ на служебные части multipart-запроса
+	r.Body = http.MaxBytesReader(w, r.Body, handler.config.StorageConfig.AvatarMaxBytes+1<<20)
+
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			models.SendErrorResponse(w, avatar.ErrImageTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		models.SendErrorResponse(w, "Файл изображения не передан", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	response, err := handler.avatarService.Upload(r.Context(), currentUserId, file)
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), avatarErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (handler *avatarHandler) DeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		models.SendErrorResponse(w, "Метод не найден", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	err = handler.avatarService.Delete(r.Context(), currentUserId)
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Аватар успешно удален"})
+}
+
+// Отдача файлов из хранилища (оригиналы и миниатюры аватаров)
+func (handler *avatarHandler) GetMedia(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+
+	file, contentType, err := handler.avatarService.Open(r.Context(), key)
+	if errors.Is(err, storage.ErrBlobNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Не удалось прочитать файл", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	// Ключи файлов неизменяемы: новый аватар получает новый ключ
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	io.Copy(w, file)
+}
+
+func avatarErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, avatar.ErrImageTooLarge), errors.Is(err, avatar.ErrImageDimensions):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, avatar.ErrImageFormat):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, avatar.ErrImageMalformed):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
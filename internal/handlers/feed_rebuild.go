@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"social-network/pkg/models"
+	"social-network/pkg/repository"
+	"social-network/pkg/service"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type FeedRebuildHandler interface {
+	Start(w http.ResponseWriter, r *http.Request)
+	GetLatest(w http.ResponseWriter, r *http.Request)
+	GetJob(w http.ResponseWriter, r *http.Request)
+}
+
+type feedRebuildHandler struct {
+	feedRebuildService service.FeedRebuildService
+}
+
+func InitFeedRebuildHandler(feedRebuildService service.FeedRebuildService) FeedRebuildHandler {
+	return &feedRebuildHandler{feedRebuildService: feedRebuildService}
+}
+
+// Запуск пересборки лент в фоне. Тело запроса необязательно: по умолчанию
+// прогреваются отсутствующие в кеше ленты всех пользователей
+func (handler *feedRebuildHandler) Start(w http.ResponseWriter, r *http.Request) {
+	var request models.StartFeedRebuildRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		models.SendErrorResponse(w, "Невалидные данные", http.StatusBadRequest)
+		return
+	}
+
+	if request.ActiveDays < 0 {
+		models.SendErrorResponse(w, "Некорректное число дней активности", http.StatusBadRequest)
+		return
+	}
+
+	job, err := handler.feedRebuildService.Start(r.Context(), &request)
+	if errors.Is(err, repository.ErrFeedRebuildRunning) {
+		models.SendErrorResponse(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// Прогресс последней задачи пересборки
+func (handler *feedRebuildHandler) GetLatest(w http.ResponseWriter, r *http.Request) {
+	job, err := handler.feedRebuildService.GetLatest(r.Context())
+	handler.sendJob(w, job, err)
+}
+
+func (handler *feedRebuildHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	jobId, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор задачи указан некорректно", http.StatusBadRequest)
+		return
+	}
+
+	job, err := handler.feedRebuildService.GetJob(r.Context(), jobId)
+	handler.sendJob(w, job, err)
+}
+
+func (handler *feedRebuildHandler) sendJob(w http.ResponseWriter, job *models.FeedRebuildJob, err error) {
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if job == nil {
+		models.SendErrorResponse(w, "Задача пересборки лент не найдена", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(job)
+}
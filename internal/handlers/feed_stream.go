@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"social-network/internal/cache"
+	"social-network/internal/config"
+	"social-network/internal/realtime"
+	"social-network/pkg/models"
+	"social-network/pkg/service"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	streamWriteWait    = 10 * time.Second     // Время на отправку сообщения клиенту
+	streamPongWait     = 60 * time.Second     // Время ожидания ответа на heartbeat
+	streamPingInterval = 30 * time.Second     // Периодичность heartbeat
+	streamResumeLimit  = 100                  // Сколько пропущенных постов досылается при переподключении
+	streamSentLimit    = 1000                 // Сколько id отправленных постов помнит соединение для отсева повторов
+	streamReadLimit    = 512                  // Максимальный размер сообщения от клиента
+	streamMessagePost  = "post"               // Тип сообщения с новым постом
+	streamCloseLagging = "Клиент не успевает" // Причина закрытия медленного соединения
+)
+
+type FeedStreamHandler interface {
+	Posted(w http.ResponseWriter, r *http.Request)
+}
+
+type feedStreamHandler struct {
+	feedService service.FeedService
+	hub         *realtime.Hub
+	authorizer  *streamAuthorizer
+	upgrader    websocket.Upgrader
+}
+
+// Сообщение клиенту WebSocket
+type feedStreamMessage struct {
+	Type string       `json:"type"`
+	Post *models.Post `json:"post"`
+}
+
+func InitFeedStreamHandler(config *config.Config, sessionService service.SessionService, moderationService service.ModerationService, feedService service.FeedService, hub *realtime.Hub) FeedStreamHandler {
+	return &feedStreamHandler{
+		feedService: feedService,
+		hub:         hub,
+		authorizer:  &streamAuthorizer{config: config, sessionService: sessionService, moderationService: moderationService},
+	}
+}
+
+// Новые посты друзей в реальном времени. При переподключении клиент передает
+// last_post_id - последний полученный пост, и ему досылаются пропущенные.
+// Авторизация повторно проверяется на каждом heartbeat: после завершения сессии,
+// отзыва или истечения токена и блокировки соединение закрывается
+func (handler *feedStreamHandler) Posted(w http.ResponseWriter, r *http.Request) {
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		http.Error(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	var lastPostId uuid.UUID
+	if value := r.URL.Query().Get("last_post_id"); value != "" {
+		lastPostId, err = uuid.Parse(value)
+		if err != nil {
+			models.SendErrorResponse(w, "Некорректный last_post_id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	authorIds, err := handler.feedService.GetPullAuthors(r.Context(), currentUserId)
+	if err != nil {
+		log.Printf("Не удалось получить авторов без рассылки для %s: %v", currentUserId, err)
+	}
+
+	// Подписка на посты в ленте и на посты авторов, которые в ленты не рассылаются.
+	// Оформляется до выборки пропущенных постов, чтобы между ними ничего не потерять
+	channels := []string{cache.FeedPostedChannel(currentUserId.String())}
+	for _, authorId := range authorIds {
+		channels = append(channels, cache.AuthorPostedChannel(authorId.String()))
+	}
+	subscription, err := handler.hub.Subscribe(channels...)
+	if err != nil {
+		http.Error(w, "Не удалось подписаться на новые посты", http.StatusInternalServerError)
+		return
+	}
+	defer subscription.Close()
+
+	conn, err := handler.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Чтение нужно для обработки pong и закрытия соединения клиентом
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadLimit(streamReadLimit)
+		conn.SetReadDeadline(time.Now().Add(streamPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(streamPongWait))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	sent := newRecentIds(streamSentLimit)
+	send := func(post *models.Post) error {
+		if !sent.add(post.Id) {
+			return nil
+		}
+		conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+
+		return conn.WriteJSON(&feedStreamMessage{Type: streamMessagePost, Post: post})
+	}
+
+	if lastPostId != uuid.Nil {
+		for _, post := range handler.missedPosts(r, currentUserId, lastPostId) {
+			if err = send(post); err != nil {
+				return
+			}
+		}
+	}
+
+	ticker := time.NewTicker(streamPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-subscription.Overflow():
+			conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, streamCloseLagging))
+			return
+		case message := <-subscription.Messages():
+			var post models.Post
+			if err = json.Unmarshal([]byte(message.Payload), &post); err != nil {
+				log.Printf("Некорректный пост в канале %s: %v", message.Channel, err)
+				continue
+			}
+			if err = send(&post); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if failure := handler.authorizer.check(r, currentUserId); failure != nil {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, failure.message))
+				return
+			}
+			if err = conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Посты ленты новее lastPostId от старых к новым. Если пост не найден среди
+// последних streamResumeLimit, досылаются все они
+func (handler *feedStreamHandler) missedPosts(r *http.Request, userId, lastPostId uuid.UUID) []*models.Post {
+	posts, _, err := handler.feedService.GetFeed(r.Context(), userId, nil, streamResumeLimit)
+	if err != nil {
+		log.Printf("Не удалось получить пропущенные посты для %s: %v", userId, err)
+		return nil
+	}
+
+	missed := make([]*models.Post, 0, len(posts))
+	for _, post := range posts {
+		if post.Id == lastPostId {
+			break
+		}
+		missed = append(missed, post)
+	}
+
+	for i, j := 0, len(missed)-1; i < j; i, j = i+1, j-1 {
+		missed[i], missed[j] = missed[j], missed[i]
+	}
+
+	return missed
+}
+
+// Id последних отправленных постов: повтор отсеивается, если пост среди limit
+// последних. Размер не растет на долгоживущих соединениях
+type recentIds struct {
+	limit int
+	order []uuid.UUID
+	next  int
+	seen  map[uuid.UUID]bool
+}
+
+func newRecentIds(limit int) *recentIds {
+	return &recentIds{limit: limit, order: make([]uuid.UUID, 0, limit), seen: make(map[uuid.UUID]bool, limit)}
+}
+
+// Добавление id; false, если он уже среди последних
+func (recent *recentIds) add(id uuid.UUID) bool {
+	if recent.seen[id] {
+		return false
+	}
+
+	if len(recent.order) < recent.limit {
+		recent.order = append(recent.order, id)
+	} else {
+		delete(recent.seen, recent.order[recent.next])
+		recent.order[recent.next] = id
+		recent.next = (recent.next + 1) % recent.limit
+	}
+	recent.seen[id] = true
+
+	return true
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// Повторы отсеиваются среди последних id, а старые id вытесняются
+func TestRecentIdsBounded(t *testing.T) {
+	recent := newRecentIds(2)
+	first, second, third := uuid.New(), uuid.New(), uuid.New()
+
+	if !recent.add(first) || !recent.add(second) {
+		t.Fatal("новые id не добавлены")
+	}
+	if recent.add(second) {
+		t.Error("повтор не отсеян")
+	}
+	if !recent.add(third) {
+		t.Fatal("новый id не добавлен")
+	}
+	if len(recent.seen) != 2 {
+		t.Errorf("запомнено %d id вместо 2", len(recent.seen))
+	}
+	if !recent.add(first) {
+		t.Error("вытесненный id считается отправленным")
+	}
+}
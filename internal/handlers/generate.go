@@ -6,7 +6,6 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"social-network/pkg/models"
@@ -39,8 +38,8 @@ func (handler *generateHandler) GenerateData(w http.ResponseWriter, r *http.Requ
 	//maxPostCount := 70
 	//maxFriendCount := 20
 	userIds, err := handler.generateUsers(r.Context())
-	if err == nil {
-		log.Fatalf(err.Error())
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"social-network/internal/security"
+	"social-network/pkg/models"
+	"social-network/pkg/repository"
+	"social-network/pkg/service"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type IdentityHandler interface {
+	AddIdentity(w http.ResponseWriter, r *http.Request)
+	ResendCode(w http.ResponseWriter, r *http.Request)
+	VerifyIdentity(w http.ResponseWriter, r *http.Request)
+	GetIdentities(w http.ResponseWriter, r *http.Request)
+	DeleteIdentity(w http.ResponseWriter, r *http.Request)
+}
+
+type identityHandler struct {
+	identityService service.IdentityService
+}
+
+func InitIdentityHandler(identityService service.IdentityService) IdentityHandler {
+	return &identityHandler{identityService: identityService}
+}
+
+func (handler *identityHandler) AddIdentity(w http.ResponseWriter, r *http.Request) {
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	var request models.AddIdentityRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		models.SendErrorResponse(w, "Невалидные данные", http.StatusBadRequest)
+		return
+	}
+
+	identity, err := handler.identityService.AddIdentity(r.Context(), currentUserId, &request)
+	if sendVerificationLimitError(w, err) {
+		return
+	}
+	if errors.Is(err, repository.ErrIdentityExists) || errors.Is(err, repository.ErrIdentityTaken) {
+		models.SendErrorResponse(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toIdentityResponse(identity))
+}
+
+func (handler *identityHandler) ResendCode(w http.ResponseWriter, r *http.Request) {
+	currentUserId, identityId, ok := parseIdentityRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := handler.identityService.ResendCode(r.Context(), currentUserId, identityId)
+	if sendVerificationLimitError(w, err) {
+		return
+	}
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Код подтверждения отправлен"})
+}
+
+func (handler *identityHandler) VerifyIdentity(w http.ResponseWriter, r *http.Request) {
+	currentUserId, identityId, ok := parseIdentityRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var request models.VerifyIdentityRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		models.SendErrorResponse(w, "Невалидные данные", http.StatusBadRequest)
+		return
+	}
+
+	err := handler.identityService.Verify(r.Context(), currentUserId, identityId, request.Code)
+	if sendVerificationLimitError(w, err) {
+		return
+	}
+	if errors.Is(err, repository.ErrIdentityTaken) {
+		models.SendErrorResponse(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Идентификатор подтвержден"})
+}
+
+func (handler *identityHandler) GetIdentities(w http.ResponseWriter, r *http.Request) {
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	identities, err := handler.identityService.GetIdentities(r.Context(), currentUserId)
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]models.IdentityResponse, 0, len(identities))
+	for _, identity := range identities {
+		response = append(response, toIdentityResponse(identity))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (handler *identityHandler) DeleteIdentity(w http.ResponseWriter, r *http.Request) {
+	currentUserId, identityId, ok := parseIdentityRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := handler.identityService.DeleteIdentity(r.Context(), currentUserId, identityId)
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Идентификатор удален"})
+}
+
+// Текущий пользователь и id идентификатора из пути запроса
+func parseIdentityRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	identityId, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор указан некорректно", http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return currentUserId, identityId, true
+}
+
+// Ответ 429, если исчерпаны лимиты отправки или проверки кодов подтверждения
+func sendVerificationLimitError(w http.ResponseWriter, err error) bool {
+	var tooManyRequests *security.TooManyRequestsError
+	if errors.As(err, &tooManyRequests) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(tooManyRequests.RetryAfter.Seconds()))))
+	} else if !errors.Is(err, repository.ErrVerificationSendLimit) && !errors.Is(err, repository.ErrVerificationAttemptsExceeded) {
+		return false
+	}
+
+	models.SendErrorResponse(w, err.Error(), http.StatusTooManyRequests)
+
+	return true
+}
+
+func toIdentityResponse(identity *models.LoginIdentity) models.IdentityResponse {
+	return models.IdentityResponse{
+		Id:       identity.Id.String(),
+		Kind:     identity.Kind,
+		Value:    identity.Value,
+		Verified: identity.IsVerified(),
+	}
+}
@@ -1,32 +1,155 @@
 package handlers
 
 import (
+	"net"
 	"net/http"
 	"social-network/internal/config"
 	"social-network/pkg/models"
+	"social-network/pkg/service"
 	"social-network/pkg/utils"
 	"strings"
+
+	"github.com/google/uuid"
 )
 
-func AuthMiddleware(config *config.Config, next http.HandlerFunc) http.HandlerFunc {
+func AuthMiddleware(config *config.Config, sessionService service.SessionService, moderationService service.ModerationService, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			models.SendErrorResponse(w, "Токен не найден", http.StatusUnauthorized)
+		claims, failure := authorize(config, sessionService, moderationService, r)
+		if failure != nil {
+			failure.write(w)
 			return
 		}
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		claims, err := utils.ValidateToken(tokenString, config)
-		if err != nil {
-			http.Error(w, "Токен не валидный", http.StatusUnauthorized)
+		if claims.SessionID != uuid.Nil {
+			sessionService.Touch(claims.SessionID, clientIP(config, r))
+			r.Header.Set("X-Session-ID", claims.SessionID.String())
+		} else {
+			r.Header.Del("X-Session-ID")
+		}
+
+		// Добавляем user_id и роли в контекст запроса
+		r.Header.Set("X-User-ID", claims.UserID.String())
+		r.Header.Set("X-User-Roles", strings.Join(claims.Roles, ","))
 
+		next(w, r)
+	}
+}
+
+// Причина отказа в доступе
+type authFailure struct {
+	status  int
+	message string
+	plain   bool // Ответ текстом, а не JSON
+}
+
+func (failure *authFailure) write(w http.ResponseWriter) {
+	if failure.plain {
+		http.Error(w, failure.message, failure.status)
+		return
+	}
+
+	models.SendErrorResponse(w, failure.message, failure.status)
+}
+
+// Проверка токена из заголовка Authorization: подпись и срок действия, отзыв токенов
+// пользователя и сессии, блокировка модератором. Долгоживущие потоки повторяют ее
+// на каждом heartbeat
+func authorize(config *config.Config, sessionService service.SessionService, moderationService service.ModerationService, r *http.Request) (*utils.Claims, *authFailure) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, &authFailure{status: http.StatusUnauthorized, message: "Токен не найден"}
+	}
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+
+	claims, err := utils.ValidateToken(tokenString, config)
+	if err != nil {
+		return nil, &authFailure{status: http.StatusUnauthorized, message: "Токен не валидный", plain: true}
+	}
+
+	// Токены, выпущенные до смены или сброса пароля, отозваны
+	if claims.IssuedAt != nil && sessionService.IsTokenRevoked(r.Context(), claims.UserID, claims.IssuedAt.Time) {
+		return nil, &authFailure{status: http.StatusUnauthorized, message: "Токен отозван", plain: true}
+	}
+
+	// Токены завершенной сессии не принимаются
+	if claims.SessionID != uuid.Nil && sessionService.IsRevoked(r.Context(), claims.SessionID) {
+		return nil, &authFailure{status: http.StatusUnauthorized, message: "Сессия завершена", plain: true}
+	}
+
+	// Заблокированным модератором пользователям доступ запрещен
+	if moderationService.GetState(claims.UserID) == models.ModerationSuspended {
+		return nil, &authFailure{status: http.StatusForbidden, message: "Аккаунт заблокирован"}
+	}
+
+	return claims, nil
+}
+
+// Повторная проверка авторизации открытого потока: после подключения сессия может
+// быть завершена, токен отозван или истечь, а пользователь заблокирован
+type streamAuthorizer struct {
+	config            *config.Config
+	sessionService    service.SessionService
+	moderationService service.ModerationService
+}
+
+// Причина закрыть поток пользователя userId или nil, если доступ сохраняется
+func (authorizer *streamAuthorizer) check(r *http.Request, userId uuid.UUID) *authFailure {
+	claims, failure := authorize(authorizer.config, authorizer.sessionService, authorizer.moderationService, r)
+	if failure != nil {
+		return failure
+	}
+	if claims.UserID != userId {
+		return &authFailure{status: http.StatusUnauthorized, message: "Токен не валидный", plain: true}
+	}
+
+	return nil
+}
+
+// Необязательная авторизация: при наличии токена проверяет его и передает X-User-ID,
+// без токена пропускает запрос как анонимный
+func OptionalAuthMiddleware(config *config.Config, sessionService service.SessionService, moderationService service.ModerationService, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Заголовок от клиента не должен подменять личность зрителя
+		r.Header.Del("X-User-ID")
+		r.Header.Del("X-Session-ID")
+		r.Header.Del("X-User-Roles")
+
+		if r.Header.Get("Authorization") == "" {
+			next(w, r)
 			return
 		}
 
-		// Добавляем user_id в контекст запроса
-		r.Header.Set("X-User-ID", claims.UserID.String())
+		AuthMiddleware(config, sessionService, moderationService, next)(w, r)
+	}
+}
+
+// Доступ только для пользователей с ролью role (администратору доступно все).
+// Используется внутри AuthMiddleware, роли берутся из токена: при снятии роли токены
+// пользователя отзываются, поэтому устаревшие роли не принимаются
+func RequireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roles := strings.Split(r.Header.Get("X-User-Roles"), ",")
+		if !models.HasRole(roles, role) {
+			models.SendErrorResponse(w, "Недостаточно прав", http.StatusForbidden)
+			return
+		}
 
 		next(w, r)
 	}
 }
+
+// IP-адрес клиента. X-Forwarded-For учитывается только при работе за доверенным прокси
+func clientIP(config *config.Config, r *http.Request) string {
+	if config.ServerConfig.TrustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"social-network/internal/cache"
+	"social-network/internal/config"
+	"social-network/pkg/models"
+	"social-network/pkg/repository"
+	"social-network/pkg/service"
+	"social-network/pkg/utils"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+)
+
+// Сессии в памяти вместо таблицы sessions
+type memorySessionRepository struct {
+	revoked map[uuid.UUID]bool
+}
+
+func (repository *memorySessionRepository) Create(ctx context.Context, session *models.Session) error {
+	repository.revoked[session.Id] = false
+	return nil
+}
+
+func (repository *memorySessionRepository) GetActiveByUserId(ctx context.Context, userId uuid.UUID) ([]*models.Session, error) {
+	return nil, nil
+}
+
+func (repository *memorySessionRepository) Revoke(ctx context.Context, userId, sessionId uuid.UUID) error {
+	repository.revoked[sessionId] = true
+	return nil
+}
+
+func (repository *memorySessionRepository) RevokeAll(ctx context.Context, userId, exceptSessionId uuid.UUID) ([]uuid.UUID, error) {
+	return nil, nil
+}
+
+func (repository *memorySessionRepository) Touch(ctx context.Context, sessionId uuid.UUID, ip string, at time.Time) error {
+	return nil
+}
+
+func (repository *memorySessionRepository) IsRevoked(ctx context.Context, sessionId uuid.UUID) (bool, error) {
+	revoked, ok := repository.revoked[sessionId]
+
+	return revoked || !ok, nil
+}
+
+func (repository *memorySessionRepository) Extend(ctx context.Context, sessionId uuid.UUID, expiresAt time.Time) error {
+	return nil
+}
+
+func (repository *memorySessionRepository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+// Пользователи в памяти: нужны только моменты отзыва токенов
+type memoryUserRepository struct {
+	repository.UserRepository
+	tokensRevokedAt map[uuid.UUID]time.Time
+}
+
+func (repository *memoryUserRepository) RevokeTokens(ctx context.Context, userId uuid.UUID, at time.Time) error {
+	repository.tokensRevokedAt[userId] = at
+	return nil
+}
+
+func (repository *memoryUserRepository) GetTokensRevokedAt(ctx context.Context, userId uuid.UUID) (time.Time, error) {
+	return repository.tokensRevokedAt[userId], nil
+}
+
+// Модерация без ограничений
+type activeModerationService struct {
+	service.ModerationService
+}
+
+func (service *activeModerationService) GetState(userId uuid.UUID) models.ModerationState {
+	return models.ModerationActive
+}
+
+func startRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	port, err := strconv.Atoi(server.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cnf := &config.Config{RedisConfig: config.RedisConfig{RedisHost: server.Host(), RedisPort: port}}
+	if err = cache.InitRedis(cnf); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = cache.Close() })
+
+	return server
+}
+
+// Отозванная сессия не принимается и после потери отметки об отзыве в Redis
+func TestAuthMiddlewareRevokedSessionAfterRedisFlush(t *testing.T) {
+	server := startRedis(t)
+	cnf := &config.Config{ServerConfig: config.ServerConfig{JwtSecret: "secret"}}
+	sessionRepository := &memorySessionRepository{revoked: make(map[uuid.UUID]bool)}
+	userRepository := &memoryUserRepository{tokensRevokedAt: make(map[uuid.UUID]time.Time)}
+	sessionService := service.InitSessionService(sessionRepository, userRepository)
+	ctx := context.Background()
+	userId := uuid.New()
+
+	revoked, err := sessionService.Create(ctx, userId, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	active, err := sessionService.Create(ctx, userId, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sessionService.Revoke(ctx, userId, revoked.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := AuthMiddleware(cnf, sessionService, &activeModerationService{}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	status := func(sessionId uuid.UUID) int {
+		token, err := utils.GenerateToken(userId, sessionId, nil, cnf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		request := httptest.NewRequest(http.MethodGet, "/user/me", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		handler(recorder, request)
+
+		return recorder.Code
+	}
+
+	check := func(stage string) {
+		t.Helper()
+		if code := status(revoked.Id); code != http.StatusUnauthorized {
+			t.Errorf("%s: отозванная сессия получила %d вместо 401", stage, code)
+		}
+		if code := status(active.Id); code != http.StatusOK {
+			t.Errorf("%s: действующая сессия получила %d вместо 200", stage, code)
+		}
+	}
+
+	check("отметка в Redis")
+
+	server.FlushAll()
+	check("после очистки Redis")
+
+	server.Close()
+	check("Redis недоступен")
+}
+
+// Токены, выпущенные до смены или сброса пароля, не принимаются и после потери
+// отметки об отзыве в Redis
+func TestAuthMiddlewareRevokedTokensAfterRedisFlush(t *testing.T) {
+	server := startRedis(t)
+	cnf := &config.Config{ServerConfig: config.ServerConfig{JwtSecret: "secret"}}
+	sessionRepository := &memorySessionRepository{revoked: make(map[uuid.UUID]bool)}
+	userRepository := &memoryUserRepository{tokensRevokedAt: make(map[uuid.UUID]time.Time)}
+	sessionService := service.InitSessionService(sessionRepository, userRepository)
+	userId := uuid.New()
+
+	// Токен выпущен до отзыва: время выпуска хранится с точностью до секунды
+	token, err := utils.GenerateToken(userId, uuid.Nil, nil, cnf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+	if err = sessionService.RevokeTokens(context.Background(), userId); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := AuthMiddleware(cnf, sessionService, &activeModerationService{}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	check := func(stage string) {
+		t.Helper()
+		request := httptest.NewRequest(http.MethodGet, "/user/me", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		handler(recorder, request)
+
+		if recorder.Code != http.StatusUnauthorized {
+			t.Errorf("%s: отозванный токен получил %d вместо 401", stage, recorder.Code)
+		}
+	}
+
+	check("отметка в Redis")
+
+	server.FlushAll()
+	check("после очистки Redis")
+
+	server.Close()
+	check("Redis недоступен")
+}
+
+// Поток, открытый с действующей сессией, закрывается после ее завершения
+func TestStreamAuthorizerRevokedSession(t *testing.T) {
+	startRedis(t)
+	cnf := &config.Config{ServerConfig: config.ServerConfig{JwtSecret: "secret"}}
+	sessionRepository := &memorySessionRepository{revoked: make(map[uuid.UUID]bool)}
+	userRepository := &memoryUserRepository{tokensRevokedAt: make(map[uuid.UUID]time.Time)}
+	sessionService := service.InitSessionService(sessionRepository, userRepository)
+	ctx := context.Background()
+	userId := uuid.New()
+
+	session, err := sessionService.Create(ctx, userId, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := utils.GenerateToken(userId, session.Id, nil, cnf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorizer := &streamAuthorizer{config: cnf, sessionService: sessionService, moderationService: &activeModerationService{}}
+	request := httptest.NewRequest(http.MethodGet, "/post/feed/posted", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	if failure := authorizer.check(request, userId); failure != nil {
+		t.Fatalf("действующая сессия: %s", failure.message)
+	}
+	if failure := authorizer.check(request, uuid.New()); failure == nil {
+		t.Error("токен принят для потока другого пользователя")
+	}
+
+	if err = sessionService.Revoke(ctx, userId, session.Id); err != nil {
+		t.Fatal(err)
+	}
+	if failure := authorizer.check(request, userId); failure == nil || failure.status != http.StatusUnauthorized {
+		t.Errorf("завершенная сессия: %v", failure)
+	}
+}
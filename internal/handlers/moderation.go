@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"social-network/internal/config"
+	"social-network/pkg/models"
+	"social-network/pkg/service"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type ModerationHandler interface {
+	GetModeration(w http.ResponseWriter, r *http.Request)
+	SetState(w http.ResponseWriter, r *http.Request)
+}
+
+type moderationHandler struct {
+	config            *config.Config
+	moderationService service.ModerationService
+}
+
+func InitModerationHandler(config *config.Config, moderationService service.ModerationService) ModerationHandler {
+	return &moderationHandler{config: config, moderationService: moderationService}
+}
+
+// Текущее состояние пользователя и история изменений
+func (handler *moderationHandler) GetModeration(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор пользователя указан некорректно", http.StatusBadRequest)
+		return
+	}
+
+	response, err := handler.moderationService.GetModeration(r.Context(), userId)
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Блокировка, теневой бан или снятие ограничений
+func (handler *moderationHandler) SetState(w http.ResponseWriter, r *http.Request) {
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	userId, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор пользователя указан некорректно", http.StatusBadRequest)
+		return
+	}
+
+	var request models.ModerationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		models.SendErrorResponse(w, "Невалидные данные", http.StatusBadRequest)
+		return
+	}
+
+	action, err := handler.moderationService.SetState(r.Context(), currentUserId, userId, &request, clientIP(handler.config, r))
+	if errors.Is(err, service.ErrCannotModerateSelf) {
+		models.SendErrorResponse(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(action)
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"social-network/internal/cache"
+	"social-network/internal/config"
+	"social-network/internal/realtime"
+	"social-network/pkg/models"
+	"social-network/pkg/service"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const sseHeartbeatInterval = 15 * time.Second // Периодичность комментария-heartbeat
+
+type NotificationStreamHandler interface {
+	Stream(w http.ResponseWriter, r *http.Request)
+}
+
+type notificationStreamHandler struct {
+	notificationService service.NotificationService
+	feedService         service.FeedService
+	hub                 *realtime.Hub
+	authorizer          *streamAuthorizer
+}
+
+func InitNotificationStreamHandler(config *config.Config, sessionService service.SessionService, moderationService service.ModerationService, notificationService service.NotificationService, feedService service.FeedService, hub *realtime.Hub) NotificationStreamHandler {
+	return &notificationStreamHandler{
+		notificationService: notificationService,
+		feedService:         feedService,
+		hub:                 hub,
+		authorizer:          &streamAuthorizer{config: config, sessionService: sessionService, moderationService: moderationService},
+	}
+}
+
+// Поток событий пользователя (Server-Sent Events): новые посты в ленте, заявки
+// в друзья и упоминания. Клиент возобновляет поток заголовком Last-Event-ID
+// (или параметром last_event_id при первом подключении). Авторизация повторно
+// проверяется на каждом heartbeat, при отказе поток закрывается
+func (handler *notificationStreamHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		http.Error(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Потоковая передача не поддерживается", http.StatusInternalServerError)
+		return
+	}
+
+	lastId := r.Header.Get("Last-Event-ID")
+	if lastId == "" {
+		lastId = r.URL.Query().Get("last_event_id")
+	}
+
+	err = handler.notificationService.AcquireStream(currentUserId)
+	if errors.Is(err, service.ErrTooManyStreams) {
+		models.SendErrorResponse(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Не удалось открыть поток событий", http.StatusServiceUnavailable)
+		return
+	}
+	defer handler.notificationService.ReleaseStream(currentUserId)
+
+	authorIds, err := handler.feedService.GetPullAuthors(r.Context(), currentUserId)
+	if err != nil {
+		log.Printf("Не удалось получить авторов без рассылки для %s: %v", currentUserId, err)
+	}
+
+	// Подписка оформляется до чтения журнала, чтобы между ними ничего не потерять.
+	// Посты авторов без рассылки не попадают в журнал и приходят только в реальном времени
+	notificationsChannel := cache.NotificationsChannel(currentUserId.String())
+	channels := []string{notificationsChannel}
+	for _, authorId := range authorIds {
+		channels = append(channels, cache.AuthorPostedChannel(authorId.String()))
+	}
+	subscription, err := handler.hub.Subscribe(channels...)
+	if err != nil {
+		http.Error(w, "Не удалось подписаться на события", http.StatusInternalServerError)
+		return
+	}
+	defer subscription.Close()
+
+	// Без Last-Event-ID поток начинается с новых событий
+	if lastId == "" {
+		lastId, err = handler.notificationService.GetLastId(currentUserId)
+		if err != nil {
+			http.Error(w, "Не удалось открыть поток событий", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	// Пропущенные события проверяются до отправки заголовков, чтобы ответить 400 на неверный id
+	missed, err := handler.notificationService.GetAfter(currentUserId, lastId)
+	if errors.Is(err, service.ErrInvalidEventId) {
+		models.SendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Не удалось получить события", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Отключение буферизации ответа в nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(notifications []*models.Notification) error {
+		for _, notification := range notifications {
+			if err := writeSSEEvent(w, notification.Id, notification.Type, notification.Data); err != nil {
+				return err
+			}
+			lastId = notification.Id
+		}
+		flusher.Flush()
+
+		return nil
+	}
+
+	if err = send(missed); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(sseHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-subscription.Overflow():
+			// Клиент переподключится с Last-Event-ID и получит пропущенное
+			return
+		case message := <-subscription.Messages():
+			if message.Channel != notificationsChannel {
+				// Пост автора без рассылки: вне журнала, поэтому без id
+				if err = writeSSEEvent(w, "", models.NotificationFeedPost, json.RawMessage(message.Payload)); err != nil {
+					return
+				}
+				flusher.Flush()
+				continue
+			}
+
+			notifications, err := handler.notificationService.GetAfter(currentUserId, lastId)
+			if err != nil {
+				log.Printf("Не удалось получить события для %s: %v", currentUserId, err)
+				continue
+			}
+			if err = send(notifications); err != nil {
+				return
+			}
+		case <-ticker.C:
+			// Переподключение клиента после закрытия получит ответ 401 или 403
+			if failure := handler.authorizer.check(r, currentUserId); failure != nil {
+				return
+			}
+			handler.notificationService.RefreshStream(currentUserId)
+			if _, err = fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// Запись события в формате text/event-stream; данные - JSON в одну строку
+func writeSSEEvent(w http.ResponseWriter, id, eventType string, data json.RawMessage) error {
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, data)
+
+	return err
+}
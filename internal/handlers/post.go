@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"social-network/pkg/models"
 	"social-network/pkg/service"
@@ -11,12 +12,22 @@ import (
 	"github.com/gorilla/mux"
 )
 
+const (
+	defaultFeedLimit = 20  // Размер страницы ленты по умолчанию
+	maxFeedLimit     = 100 // Максимальный размер страницы ленты
+	maxCommentsLimit = 100 // Максимальный размер страницы комментариев
+)
+
 type PostHandler interface {
 	AddPost(w http.ResponseWriter, r *http.Request)
 	GetPost(w http.ResponseWriter, r *http.Request)
 	DeletePost(w http.ResponseWriter, r *http.Request)
 	GetFeed(w http.ResponseWriter, r *http.Request)
 	GetFeedCount(w http.ResponseWriter, r *http.Request)
+	AddReaction(w http.ResponseWriter, r *http.Request)
+	DeleteReaction(w http.ResponseWriter, r *http.Request)
+	AddComment(w http.ResponseWriter, r *http.Request)
+	GetComments(w http.ResponseWriter, r *http.Request)
 }
 
 type postHandler struct {
@@ -68,8 +79,10 @@ func (handler *postHandler) GetPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	currentUserId, _ := uuid.Parse(r.Header.Get("X-User-ID"))
+
 	var post *models.Post
-	post, err = handler.postService.GetById(r.Context(), postId)
+	post, err = handler.postService.GetById(r.Context(), currentUserId, postId)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -123,27 +136,34 @@ func (handler *postHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
 	}
 
 	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
-
-	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
 	if err != nil {
-		http.Error(w, "Не задан лимит", http.StatusBadRequest)
+		http.Error(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
 		return
 	}
 
-	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
-	if err != nil {
-		http.Error(w, "Не задан offset", http.StatusBadRequest)
-		return
+	limit := defaultFeedLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxFeedLimit {
+			http.Error(w, "Некорректный лимит", http.StatusBadRequest)
+			return
+		}
 	}
 
-	posts, err := handler.postService.GetFeed(r.Context(), currentUserId, limit, offset)
+	// Режим ранжирования: chronological (по умолчанию), engagement, close_friends
+	mode := r.URL.Query().Get("mode")
+	feed, err := handler.postService.GetFeed(r.Context(), currentUserId, mode, r.URL.Query().Get("cursor"), limit)
+	if errors.Is(err, models.ErrInvalidFeedCursor) || errors.Is(err, models.ErrUnknownFeedMode) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(posts)
+	json.NewEncoder(w).Encode(feed)
 }
 
 func (handler *postHandler) GetFeedCount(w http.ResponseWriter, r *http.Request) {
@@ -158,3 +178,142 @@ func (handler *postHandler) GetFeedCount(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
 }
+
+func (handler *postHandler) AddReaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Метод не найден", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		http.Error(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	postId, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Id-поста не найден", http.StatusBadRequest)
+		return
+	}
+
+	if err = handler.postService.AddReaction(r.Context(), currentUserId, postId); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Реакция добавлена"})
+}
+
+func (handler *postHandler) DeleteReaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Метод не найден", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		http.Error(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	postId, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Id-поста не найден", http.StatusBadRequest)
+		return
+	}
+
+	if err = handler.postService.DeleteReaction(r.Context(), currentUserId, postId); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Реакция удалена"})
+}
+
+func (handler *postHandler) AddComment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не найден", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var commentRequest models.CreateCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&commentRequest); err != nil {
+		models.SendErrorResponse(w, "Невалидные данные", http.StatusBadRequest)
+		return
+	}
+
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		http.Error(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	postId, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Id-поста не найден", http.StatusBadRequest)
+		return
+	}
+
+	comment, err := handler.postService.AddComment(r.Context(), currentUserId, postId, &commentRequest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(comment)
+}
+
+func (handler *postHandler) GetComments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не найден", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		http.Error(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	postId, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Id-поста не найден", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultFeedLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxCommentsLimit {
+			http.Error(w, "Некорректный лимит", http.StatusBadRequest)
+			return
+		}
+	}
+
+	offset := 0
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			http.Error(w, "Некорректное смещение", http.StatusBadRequest)
+			return
+		}
+	}
+
+	comments, err := handler.postService.GetComments(r.Context(), currentUserId, postId, limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if comments == nil {
+		comments = []*models.Comment{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comments)
+}
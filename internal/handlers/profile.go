@@ -1,9 +1,16 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"social-network/pkg/models"
+	"social-network/pkg/repository"
 	"social-network/pkg/service"
+	"strconv"
+	"strings"
+	"time"
 
 	"encoding/json"
 
@@ -13,15 +20,22 @@ import (
 
 type ProfileHandler interface {
 	GetProfile(w http.ResponseWriter, r *http.Request)
+	GetProfiles(w http.ResponseWriter, r *http.Request)
+	GetProfileByUsername(w http.ResponseWriter, r *http.Request)
+	ChangeUsername(w http.ResponseWriter, r *http.Request)
 	SearchProfile(w http.ResponseWriter, r *http.Request)
+	UpdateProfile(w http.ResponseWriter, r *http.Request)
+	GetPrivacy(w http.ResponseWriter, r *http.Request)
+	UpdatePrivacy(w http.ResponseWriter, r *http.Request)
 }
 
 type profileHandler struct {
 	profileService service.ProfileService
+	avatarService  service.AvatarService
 }
 
-func InitUserHandler(service service.ProfileService) ProfileHandler {
-	return &profileHandler{profileService: service}
+func InitUserHandler(service service.ProfileService, avatarService service.AvatarService) ProfileHandler {
+	return &profileHandler{profileService: service, avatarService: avatarService}
 }
 
 func (handler *profileHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
@@ -33,7 +47,10 @@ func (handler *profileHandler) GetProfile(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	profile, err := handler.profileService.GetById(r.Context(), userId)
+	// Зритель определяется необязательной авторизацией; аноним - uuid.Nil
+	viewerId, _ := uuid.Parse(r.Header.Get("X-User-ID"))
+
+	profile, err := handler.profileService.GetById(r.Context(), viewerId, userId)
 
 	if err != nil {
 		models.SendSuccessResponse(w, "Анкета не найдена", http.StatusNotFound)
@@ -41,15 +58,119 @@ func (handler *profileHandler) GetProfile(w http.ResponseWriter, r *http.Request
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", profileETag(profile.UpdatedAt))
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(models.ProfileResponse{
-		FirstName: profile.FirstName,
-		LastName:  profile.LastName,
-		Gender:    profile.Gender,
-		Birthdate: profile.Birthdate.Format("2006-01-02 15:04:05"),
-		Biography: profile.Biography,
-		City:      profile.City,
-	})
+	json.NewEncoder(w).Encode(handler.toProfileResponse(profile))
+}
+
+// Пакетное получение анкет (POST /user/batch). Ответ - объект user_id -> анкета
+func (handler *profileHandler) GetProfiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		models.SendErrorResponse(w, "Метод не найден", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request models.BatchProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		models.SendErrorResponse(w, "Невалидные данные", http.StatusBadRequest)
+		return
+	}
+
+	if len(request.UserIds) > service.MaxBatchProfiles {
+		models.SendErrorResponse(w, fmt.Sprintf("Можно запросить не более %d анкет", service.MaxBatchProfiles), http.StatusBadRequest)
+		return
+	}
+
+	// Повторяющиеся идентификаторы запрашиваем один раз
+	seen := make(map[uuid.UUID]bool, len(request.UserIds))
+	userIds := make([]uuid.UUID, 0, len(request.UserIds))
+	for _, rawId := range request.UserIds {
+		userId, err := uuid.Parse(rawId)
+		if err != nil {
+			models.SendErrorResponse(w, "Идентификатор пользователя указан некорректно: "+rawId, http.StatusBadRequest)
+			return
+		}
+		if !seen[userId] {
+			seen[userId] = true
+			userIds = append(userIds, userId)
+		}
+	}
+
+	viewerId, _ := uuid.Parse(r.Header.Get("X-User-ID"))
+
+	profiles, err := handler.profileService.GetByIds(r.Context(), viewerId, userIds)
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make(map[string]models.ProfileResponse, len(profiles))
+	for userId, profile := range profiles {
+		response[userId.String()] = handler.toProfileResponse(profile)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Анкета по имени пользователя (GET /u/{username}); прежнее имя перенаправляет на актуальное
+func (handler *profileHandler) GetProfileByUsername(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	viewerId, _ := uuid.Parse(r.Header.Get("X-User-ID"))
+
+	profile, redirectUsername, err := handler.profileService.GetByUsername(r.Context(), viewerId, username)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		models.SendErrorResponse(w, "Анкета не найдена", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		models.SendErrorResponse(w, "Не удалось получить анкету", http.StatusInternalServerError)
+		return
+	}
+
+	if redirectUsername != "" {
+		http.Redirect(w, r, "/u/"+url.PathEscape(redirectUsername), http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", profileETag(profile.UpdatedAt))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(handler.toProfileResponse(profile))
+}
+
+func (handler *profileHandler) ChangeUsername(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		models.SendErrorResponse(w, "Метод не найден", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	var request models.ChangeUsernameRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		models.SendErrorResponse(w, "Невалидные данные", http.StatusBadRequest)
+		return
+	}
+
+	err = handler.profileService.ChangeUsername(r.Context(), currentUserId, request.Username)
+	if errors.Is(err, repository.ErrUsernameTaken) {
+		models.SendErrorResponse(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Имя пользователя успешно изменено"})
 }
 
 func (handler *profileHandler) SearchProfile(w http.ResponseWriter, r *http.Request) {
@@ -60,7 +181,9 @@ func (handler *profileHandler) SearchProfile(w http.ResponseWriter, r *http.Requ
 		offset int = 0
 	)
 
-	profiles, err := handler.profileService.SearchProfile(r.Context(), lastName, firstName, limit, offset)
+	viewerId, _ := uuid.Parse(r.Header.Get("X-User-ID"))
+
+	profiles, err := handler.profileService.SearchProfile(r.Context(), viewerId, lastName, firstName, limit, offset)
 
 	if err != nil {
 		models.SendSuccessResponse(w, err.Error(), http.StatusNotFound)
@@ -70,16 +193,152 @@ func (handler *profileHandler) SearchProfile(w http.ResponseWriter, r *http.Requ
 	var profileList []models.ProfileResponse
 
 	for _, profile := range profiles {
-		obj := models.ProfileResponse{
-			FirstName: profile.FirstName,
-			LastName:  profile.LastName,
-			Gender:    profile.Gender,
-			Birthdate: profile.Birthdate.Format("2006-01-02 15:04:05"),
-			Biography: profile.Biography,
-			City:      profile.City,
-		}
-		profileList = append(profileList, obj)
+		profileList = append(profileList, handler.toProfileResponse(profile))
 	}
 
 	json.NewEncoder(w).Encode(profileList)
 }
+
+// Частичное обновление анкеты авторизованного пользователя (PATCH /user/me)
+func (handler *profileHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		models.SendErrorResponse(w, "Метод не найден", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" {
+		models.SendErrorResponse(w, "Не указан заголовок If-Match с версией анкеты", http.StatusPreconditionRequired)
+		return
+	}
+
+	version, err := parseIfMatch(ifMatch)
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	var request models.UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		models.SendErrorResponse(w, "Невалидные данные", http.StatusBadRequest)
+		return
+	}
+
+	profile, err := handler.profileService.UpdateProfile(r.Context(), currentUserId, &request, version)
+	if errors.Is(err, repository.ErrProfileVersionConflict) {
+		models.SendErrorResponse(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", profileETag(profile.UpdatedAt))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(handler.toProfileResponse(profile))
+}
+
+func (handler *profileHandler) GetPrivacy(w http.ResponseWriter, r *http.Request) {
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	settings, err := handler.profileService.GetPrivacySettings(r.Context(), currentUserId)
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(toPrivacyResponse(settings))
+}
+
+func (handler *profileHandler) UpdatePrivacy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		models.SendErrorResponse(w, "Метод не найден", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	var request models.UpdatePrivacyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		models.SendErrorResponse(w, "Невалидные данные", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := handler.profileService.UpdatePrivacySettings(r.Context(), currentUserId, &request)
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(toPrivacyResponse(settings))
+}
+
+// Скрытые настройками приватности поля приходят пустыми и не попадают в ответ
+func (handler *profileHandler) toProfileResponse(profile *models.Profile) models.ProfileResponse {
+	response := models.ProfileResponse{
+		UserId:    profile.UserId.String(),
+		Username:  profile.Username,
+		FirstName: profile.FirstName,
+		LastName:  profile.LastName,
+		Gender:    profile.Gender,
+		Biography: profile.Biography,
+		City:      profile.City,
+		Avatar:    handler.avatarService.GetURLs(profile.Avatar),
+	}
+
+	if !profile.Birthdate.IsZero() {
+		response.Birthdate = profile.Birthdate.Format("2006-01-02 15:04:05")
+	}
+
+	return response
+}
+
+func toPrivacyResponse(settings *models.PrivacySettings) models.PrivacySettingsResponse {
+	return models.PrivacySettingsResponse{
+		Birthdate:  settings.Birthdate,
+		City:       settings.City,
+		Biography:  settings.Biography,
+		Searchable: settings.Searchable,
+	}
+}
+
+// Версия анкеты для заголовка ETag
+func profileETag(updatedAt time.Time) string {
+	return fmt.Sprintf(`"%d"`, updatedAt.UnixMicro())
+}
+
+// Разбор заголовка If-Match. "*" не принимается: обновление всегда выполняется
+// с проверкой версии
+func parseIfMatch(header string) (time.Time, error) {
+	if header == "*" {
+		return time.Time{}, fmt.Errorf("Укажите версию анкеты из ETag в заголовке If-Match")
+	}
+
+	value := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	micro, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Заголовок If-Match указан некорректно")
+	}
+
+	return time.UnixMicro(micro).UTC(), nil
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"social-network/pkg/models"
+	"social-network/pkg/service"
+
+	"github.com/google/uuid"
+)
+
+// Анкеты без БД: запоминается версия, с которой пришло обновление
+type versionProfileService struct {
+	service.ProfileService
+	updated bool
+	version time.Time
+}
+
+func (service *versionProfileService) UpdateProfile(ctx context.Context, userId uuid.UUID, request *models.UpdateProfileRequest, version time.Time) (*models.Profile, error) {
+	service.updated = true
+	service.version = version
+
+	return &models.Profile{UserId: userId, UpdatedAt: time.Now()}, nil
+}
+
+// Аватары без хранилища
+type emptyAvatarService struct {
+	service.AvatarService
+}
+
+func (service *emptyAvatarService) GetURLs(avatarKey string) *models.AvatarResponse {
+	return nil
+}
+
+// Без If-Match обновление не выполняется, чтобы не перезаписать чужие изменения
+func TestUpdateProfileRequiresIfMatch(t *testing.T) {
+	updatedAt := time.UnixMicro(time.Now().UnixMicro()).UTC()
+	cases := []struct {
+		ifMatch string
+		status  int
+		version time.Time
+	}{
+		{ifMatch: "", status: http.StatusPreconditionRequired},
+		{ifMatch: "abc", status: http.StatusPreconditionFailed},
+		{ifMatch: "*", status: http.StatusPreconditionFailed},
+		{ifMatch: profileETag(updatedAt), status: http.StatusOK, version: updatedAt},
+	}
+
+	for _, testCase := range cases {
+		profileService := &versionProfileService{}
+		handler := InitUserHandler(profileService, &emptyAvatarService{})
+
+		request := httptest.NewRequest(http.MethodPatch, "/user/me", strings.NewReader(`{"city":"Москва"}`))
+		request.Header.Set("X-User-ID", uuid.New().String())
+		if testCase.ifMatch != "" {
+			request.Header.Set("If-Match", testCase.ifMatch)
+		}
+		recorder := httptest.NewRecorder()
+		handler.UpdateProfile(recorder, request)
+
+		if recorder.Code != testCase.status {
+			t.Errorf("If-Match %q: ответ %d вместо %d", testCase.ifMatch, recorder.Code, testCase.status)
+		}
+		if profileService.updated != (testCase.status == http.StatusOK) {
+			t.Errorf("If-Match %q: анкета обновлена: %v", testCase.ifMatch, profileService.updated)
+		}
+		if !profileService.version.Equal(testCase.version) {
+			t.Errorf("If-Match %q: версия %v вместо %v", testCase.ifMatch, profileService.version, testCase.version)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"social-network/internal/config"
+	"social-network/pkg/models"
+	"social-network/pkg/service"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type RoleHandler interface {
+	GetRoles(w http.ResponseWriter, r *http.Request)
+	SetRoles(w http.ResponseWriter, r *http.Request)
+}
+
+type roleHandler struct {
+	config      *config.Config
+	roleService service.RoleService
+}
+
+func InitRoleHandler(config *config.Config, roleService service.RoleService) RoleHandler {
+	return &roleHandler{config: config, roleService: roleService}
+}
+
+func (handler *roleHandler) GetRoles(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор пользователя указан некорректно", http.StatusBadRequest)
+		return
+	}
+
+	roles, err := handler.roleService.GetRoles(r.Context(), userId)
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.RolesResponse{UserId: userId.String(), Roles: roles})
+}
+
+// Установка набора ролей пользователя. Новые роли попадут в токен пользователя
+// при следующем входе или обновлении токена
+func (handler *roleHandler) SetRoles(w http.ResponseWriter, r *http.Request) {
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	userId, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор пользователя указан некорректно", http.StatusBadRequest)
+		return
+	}
+
+	var request models.SetRolesRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		models.SendErrorResponse(w, "Невалидные данные", http.StatusBadRequest)
+		return
+	}
+
+	roles, err := handler.roleService.SetRoles(r.Context(), currentUserId, userId, request.Roles, clientIP(handler.config, r))
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.RolesResponse{UserId: userId.String(), Roles: roles})
+}
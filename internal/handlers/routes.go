@@ -1,51 +1,130 @@
 package handlers
 
 import (
+	"expvar"
+	"net/http"
 	"social-network/internal/config"
+	"social-network/internal/realtime"
 	"social-network/pkg/database"
+	"social-network/pkg/models"
 	"social-network/pkg/service"
 
 	"github.com/gorilla/mux"
 )
 
 type Routes struct {
-	config            *config.Config
-	ProfileHandler    ProfileHandler
-	AuthHandler       AuthHandler
-	FriendShipHandler FriendsHandler
-	PostHandler       PostHandler
-	GenerateHandler   GenerateHandler
-	TestHandler       TestHandler
+	config                    *config.Config
+	sessionService            service.SessionService
+	moderationService         service.ModerationService
+	ProfileHandler            ProfileHandler
+	AvatarHandler             AvatarHandler
+	AuthHandler               AuthHandler
+	IdentityHandler           IdentityHandler
+	TwoFactorHandler          TwoFactorHandler
+	SessionHandler            SessionHandler
+	RoleHandler               RoleHandler
+	AccountHandler            AccountHandler
+	ModerationHandler         ModerationHandler
+	FriendShipHandler         FriendsHandler
+	PostHandler               PostHandler
+	FeedStreamHandler         FeedStreamHandler
+	NotificationStreamHandler NotificationStreamHandler
+	FeedRebuildHandler        FeedRebuildHandler
+	GenerateHandler           GenerateHandler
+	TestHandler               TestHandler
 }
 
-func InitRoutes(config *config.Config, authService service.AuthService, profileService service.ProfileService, friendfiendShipService service.FriendShipService, postService service.PostService, routerDB *database.ReplicationRouter) *Routes {
+func InitRoutes(config *config.Config, authService service.AuthService, identityService service.IdentityService, twoFactorService service.TwoFactorService, sessionService service.SessionService, roleService service.RoleService, accountService service.AccountService, moderationService service.ModerationService, profileService service.ProfileService, avatarService service.AvatarService, friendfiendShipService service.FriendShipService, postService service.PostService, feedService service.FeedService, notificationService service.NotificationService, feedRebuildService service.FeedRebuildService, hub *realtime.Hub, routerDB *database.ReplicationRouter) *Routes {
 	return &Routes{
-		config:            config,
-		ProfileHandler:    InitUserHandler(profileService),
-		AuthHandler:       InitAuthHandler(authService),
-		FriendShipHandler: InitFriendShipHandler(friendfiendShipService),
-		PostHandler:       InitPostHandler(postService),
-		GenerateHandler:   InitGenerateHandler(authService, friendfiendShipService, postService),
-		TestHandler:       InitTestHandler(routerDB),
+		config:                    config,
+		sessionService:            sessionService,
+		moderationService:         moderationService,
+		ProfileHandler:            InitUserHandler(profileService, avatarService),
+		AvatarHandler:             InitAvatarHandler(config, avatarService),
+		AuthHandler:               InitAuthHandler(config, authService),
+		IdentityHandler:           InitIdentityHandler(identityService),
+		TwoFactorHandler:          InitTwoFactorHandler(twoFactorService),
+		SessionHandler:            InitSessionHandler(sessionService),
+		RoleHandler:               InitRoleHandler(config, roleService),
+		AccountHandler:            InitAccountHandler(config, accountService),
+		ModerationHandler:         InitModerationHandler(config, moderationService),
+		FriendShipHandler:         InitFriendShipHandler(friendfiendShipService),
+		PostHandler:               InitPostHandler(postService),
+		FeedStreamHandler:         InitFeedStreamHandler(config, sessionService, moderationService, feedService, hub),
+		NotificationStreamHandler: InitNotificationStreamHandler(config, sessionService, moderationService, notificationService, feedService, hub),
+		FeedRebuildHandler:        InitFeedRebuildHandler(feedRebuildService),
+		GenerateHandler:           InitGenerateHandler(authService, friendfiendShipService, postService),
+		TestHandler:               InitTestHandler(routerDB),
 	}
 }
 
 func (route *Routes) Run() *mux.Router {
 	router := mux.NewRouter()
 	router.HandleFunc("/login", route.AuthHandler.Login).Methods("POST")
+	router.HandleFunc("/login/2fa", route.AuthHandler.LoginTwoFactor).Methods("POST")
 	router.HandleFunc("/user/register", route.AuthHandler.UserRegister).Methods("POST")
-	router.HandleFunc("/user/get/{id}", route.ProfileHandler.GetProfile).Methods("GET")
-	router.HandleFunc("/user/search", route.ProfileHandler.SearchProfile).Methods("GET")
-	router.HandleFunc("/friend/add/{id}", AuthMiddleware(route.config, route.FriendShipHandler.AddFriend)).Methods("POST")
-	router.HandleFunc("/friend/delete/{id}", AuthMiddleware(route.config, route.FriendShipHandler.DeleteFriend)).Methods("DELETE")
-	router.HandleFunc("/post/create", AuthMiddleware(route.config, route.PostHandler.AddPost)).Methods("POST")
-	router.HandleFunc("/post/get/{id}", AuthMiddleware(route.config, route.PostHandler.GetPost)).Methods("GET")
-	router.HandleFunc("/post/delete/{id}", AuthMiddleware(route.config, route.PostHandler.DeletePost)).Methods("PUT")
-	router.HandleFunc("/post/feed", AuthMiddleware(route.config, route.PostHandler.GetFeed)).Methods("GET")
-	router.HandleFunc("/post/feed/count", AuthMiddleware(route.config, route.PostHandler.GetFeedCount)).Methods("GET")
-	router.HandleFunc("/generate/data", route.GenerateHandler.GenerateData).Methods("GET")
-	router.HandleFunc("/test/create", route.TestHandler.AddRecord).Methods("POST")
-	router.HandleFunc("/test/get", route.TestHandler.GetRecord).Methods("GET")
-	router.HandleFunc("/generate/data", route.GenerateHandler.GenerateData).Methods("GET")
+	router.HandleFunc("/password/forgot", route.AuthHandler.ForgotPassword).Methods("POST")
+	router.HandleFunc("/password/reset", route.AuthHandler.ResetPassword).Methods("POST")
+	router.HandleFunc("/token/refresh", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.AuthHandler.RefreshToken)).Methods("POST")
+	router.HandleFunc("/user/me/password", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.AuthHandler.ChangePassword)).Methods("POST")
+	router.HandleFunc("/user/get/{id}", OptionalAuthMiddleware(route.config, route.sessionService, route.moderationService, route.ProfileHandler.GetProfile)).Methods("GET")
+	router.HandleFunc("/user/batch", OptionalAuthMiddleware(route.config, route.sessionService, route.moderationService, route.ProfileHandler.GetProfiles)).Methods("POST")
+	router.HandleFunc("/u/{username}", OptionalAuthMiddleware(route.config, route.sessionService, route.moderationService, route.ProfileHandler.GetProfileByUsername)).Methods("GET")
+	router.HandleFunc("/user/search", OptionalAuthMiddleware(route.config, route.sessionService, route.moderationService, route.ProfileHandler.SearchProfile)).Methods("GET")
+	router.HandleFunc("/user/me", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.ProfileHandler.UpdateProfile)).Methods("PATCH")
+	router.HandleFunc("/user/me/username", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.ProfileHandler.ChangeUsername)).Methods("PUT")
+	router.HandleFunc("/user/me/privacy", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.ProfileHandler.GetPrivacy)).Methods("GET")
+	router.HandleFunc("/user/me/privacy", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.ProfileHandler.UpdatePrivacy)).Methods("PATCH")
+	router.HandleFunc("/user/me/identities", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.IdentityHandler.GetIdentities)).Methods("GET")
+	router.HandleFunc("/user/me/identities", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.IdentityHandler.AddIdentity)).Methods("POST")
+	router.HandleFunc("/user/me/identities/{id}/verify", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.IdentityHandler.VerifyIdentity)).Methods("POST")
+	router.HandleFunc("/user/me/identities/{id}/resend", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.IdentityHandler.ResendCode)).Methods("POST")
+	router.HandleFunc("/user/me/identities/{id}", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.IdentityHandler.DeleteIdentity)).Methods("DELETE")
+	router.HandleFunc("/user/me/2fa/setup", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.TwoFactorHandler.Setup)).Methods("POST")
+	router.HandleFunc("/user/me/2fa/enable", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.TwoFactorHandler.Enable)).Methods("POST")
+	router.HandleFunc("/user/me/2fa/disable", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.TwoFactorHandler.Disable)).Methods("POST")
+	router.HandleFunc("/user/me/export", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.AccountHandler.ExportData)).Methods("GET")
+	router.HandleFunc("/user/me/deletion", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.AccountHandler.ScheduleDeletion)).Methods("POST")
+	router.HandleFunc("/user/me/deletion", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.AccountHandler.CancelDeletion)).Methods("DELETE")
+	router.HandleFunc("/user/me/sessions", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.SessionHandler.GetSessions)).Methods("GET")
+	router.HandleFunc("/user/me/sessions", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.SessionHandler.RevokeOtherSessions)).Methods("DELETE")
+	router.HandleFunc("/user/me/sessions/{id}", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.SessionHandler.RevokeSession)).Methods("DELETE")
+	router.HandleFunc("/user/me/avatar", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.AvatarHandler.UploadAvatar)).Methods("POST")
+	router.HandleFunc("/user/me/avatar", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.AvatarHandler.DeleteAvatar)).Methods("DELETE")
+	router.HandleFunc("/media/{key:.+}", route.AvatarHandler.GetMedia).Methods("GET")
+	router.HandleFunc("/friend/add/{id}", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.FriendShipHandler.AddFriend)).Methods("POST")
+	router.HandleFunc("/friend/delete/{id}", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.FriendShipHandler.DeleteFriend)).Methods("DELETE")
+	router.HandleFunc("/post/create", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.PostHandler.AddPost)).Methods("POST")
+	router.HandleFunc("/post/get/{id}", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.PostHandler.GetPost)).Methods("GET")
+	router.HandleFunc("/post/delete/{id}", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.PostHandler.DeletePost)).Methods("PUT")
+	router.HandleFunc("/post/reaction/{id}", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.PostHandler.AddReaction)).Methods("PUT")
+	router.HandleFunc("/post/reaction/{id}", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.PostHandler.DeleteReaction)).Methods("DELETE")
+	router.HandleFunc("/post/comment/{id}", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.PostHandler.AddComment)).Methods("POST")
+	router.HandleFunc("/post/comments/{id}", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.PostHandler.GetComments)).Methods("GET")
+	router.HandleFunc("/post/feed", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.PostHandler.GetFeed)).Methods("GET")
+	router.HandleFunc("/post/feed/posted", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.FeedStreamHandler.Posted)).Methods("GET")
+	router.HandleFunc("/notifications/stream", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.NotificationStreamHandler.Stream)).Methods("GET")
+	router.HandleFunc("/post/feed/count", AuthMiddleware(route.config, route.sessionService, route.moderationService, route.PostHandler.GetFeedCount)).Methods("GET")
+	router.HandleFunc("/admin/users/{id}/roles", route.adminOnly(route.RoleHandler.GetRoles)).Methods("GET")
+	router.HandleFunc("/admin/users/{id}/roles", route.adminOnly(route.RoleHandler.SetRoles)).Methods("PUT")
+	router.HandleFunc("/admin/feeds/rebuild", route.adminOnly(route.FeedRebuildHandler.Start)).Methods("POST")
+	router.HandleFunc("/admin/feeds/rebuild", route.adminOnly(route.FeedRebuildHandler.GetLatest)).Methods("GET")
+	router.HandleFunc("/admin/feeds/rebuild/{id}", route.adminOnly(route.FeedRebuildHandler.GetJob)).Methods("GET")
+	router.HandleFunc("/moderation/users/{id}", route.moderatorOnly(route.ModerationHandler.GetModeration)).Methods("GET")
+	router.HandleFunc("/moderation/users/{id}", route.moderatorOnly(route.ModerationHandler.SetState)).Methods("PUT")
+	router.HandleFunc("/generate/data", route.adminOnly(route.GenerateHandler.GenerateData)).Methods("GET")
+	router.HandleFunc("/test/create", route.adminOnly(route.TestHandler.AddRecord)).Methods("POST")
+	router.HandleFunc("/test/get", route.adminOnly(route.TestHandler.GetRecord)).Methods("GET")
+	router.HandleFunc("/debug/vars", route.adminOnly(expvar.Handler().ServeHTTP)).Methods("GET")
 	return router
 }
+
+// Авторизация и проверка роли администратора
+func (route *Routes) adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return AuthMiddleware(route.config, route.sessionService, route.moderationService, RequireRole(models.RoleAdmin, next))
+}
+
+// Авторизация и проверка роли модератора
+func (route *Routes) moderatorOnly(next http.HandlerFunc) http.HandlerFunc {
+	return AuthMiddleware(route.config, route.sessionService, route.moderationService, RequireRole(models.RoleModerator, next))
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"social-network/pkg/models"
+	"social-network/pkg/service"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type SessionHandler interface {
+	GetSessions(w http.ResponseWriter, r *http.Request)
+	RevokeSession(w http.ResponseWriter, r *http.Request)
+	RevokeOtherSessions(w http.ResponseWriter, r *http.Request)
+}
+
+type sessionHandler struct {
+	sessionService service.SessionService
+}
+
+func InitSessionHandler(sessionService service.SessionService) SessionHandler {
+	return &sessionHandler{sessionService: sessionService}
+}
+
+// Список действующих сессий; текущая отмечена полем current
+func (handler *sessionHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+	currentSessionId, _ := uuid.Parse(r.Header.Get("X-Session-ID"))
+
+	sessions, err := handler.sessionService.GetSessions(r.Context(), currentUserId)
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]models.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, models.SessionResponse{
+			Id:         session.Id.String(),
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			Current:    session.Id == currentSessionId,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (handler *sessionHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	sessionId, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор сессии указан некорректно", http.StatusBadRequest)
+		return
+	}
+
+	err = handler.sessionService.Revoke(r.Context(), currentUserId, sessionId)
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Сессия завершена"})
+}
+
+// Завершение всех сессий, кроме текущей
+func (handler *sessionHandler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	currentSessionId, err := uuid.Parse(r.Header.Get("X-Session-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Текущий токен не привязан к сессии, выполните вход заново", http.StatusBadRequest)
+		return
+	}
+
+	err = handler.sessionService.RevokeOthers(r.Context(), currentUserId, currentSessionId)
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Остальные сессии завершены"})
+}
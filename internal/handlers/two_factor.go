@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"social-network/pkg/models"
+	"social-network/pkg/repository"
+	"social-network/pkg/service"
+
+	"github.com/google/uuid"
+)
+
+type TwoFactorHandler interface {
+	Setup(w http.ResponseWriter, r *http.Request)
+	Enable(w http.ResponseWriter, r *http.Request)
+	Disable(w http.ResponseWriter, r *http.Request)
+}
+
+type twoFactorHandler struct {
+	twoFactorService service.TwoFactorService
+}
+
+func InitTwoFactorHandler(twoFactorService service.TwoFactorService) TwoFactorHandler {
+	return &twoFactorHandler{twoFactorService: twoFactorService}
+}
+
+func (handler *twoFactorHandler) Setup(w http.ResponseWriter, r *http.Request) {
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	response, err := handler.twoFactorService.Setup(r.Context(), currentUserId)
+	if errors.Is(err, repository.ErrTwoFactorEnabled) {
+		models.SendErrorResponse(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (handler *twoFactorHandler) Enable(w http.ResponseWriter, r *http.Request) {
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	var request models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		models.SendErrorResponse(w, "Невалидные данные", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := handler.twoFactorService.Enable(r.Context(), currentUserId, request.Code)
+	if errors.Is(err, repository.ErrTwoFactorEnabled) {
+		models.SendErrorResponse(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.TwoFactorEnableResponse{RecoveryCodes: codes})
+}
+
+func (handler *twoFactorHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	currentUserId, err := uuid.Parse(r.Header.Get("X-User-ID"))
+	if err != nil {
+		models.SendErrorResponse(w, "Идентификатор авторизованного пользователя указан некорректно", http.StatusForbidden)
+		return
+	}
+
+	var request models.TwoFactorDisableRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		models.SendErrorResponse(w, "Невалидные данные", http.StatusBadRequest)
+		return
+	}
+
+	err = handler.twoFactorService.Disable(r.Context(), currentUserId, request.Password, request.Code)
+	if err != nil {
+		models.SendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Двухфакторная аутентификация отключена"})
+}
@@ -0,0 +1,43 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Уведомления в файл (или в лог при пустом пути) для локальной разработки
+type FileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (notifier *FileNotifier) Send(ctx context.Context, message *Message) error {
+	line := fmt.Sprintf("%s [%s] to=%s subject=%q body=%q\n",
+		time.Now().Format(time.RFC3339), message.Channel, message.To, message.Subject, message.Body)
+
+	if notifier.path == "" {
+		log.Print(line)
+		return nil
+	}
+
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+
+	file, err := os.OpenFile(notifier.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("Не удалось открыть файл уведомлений: %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(line)
+
+	return err
+}
@@ -0,0 +1,33 @@
+package notify
+
+import (
+	"context"
+	"social-network/internal/config"
+)
+
+const (
+	ChannelEmail = "email"
+	ChannelPhone = "phone"
+)
+
+// Сообщение пользователю: код подтверждения, ссылка сброса пароля и т.п.
+type Message struct {
+	Channel string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Отправка уведомлений пользователям
+type Notifier interface {
+	Send(ctx context.Context, message *Message) error
+}
+
+// Выбор реализации по настройкам: smtp или file (по умолчанию)
+func NewNotifier(cfg *config.Config) Notifier {
+	if cfg.NotifierConfig.Driver == "smtp" {
+		return NewSMTPNotifier(cfg.NotifierConfig)
+	}
+
+	return NewFileNotifier(cfg.NotifierConfig.FilePath)
+}
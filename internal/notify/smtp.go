@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"social-network/internal/config"
+	"strings"
+)
+
+// Отправка уведомлений по электронной почте через SMTP
+type SMTPNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPNotifier(cfg config.NotifierConfig) *SMTPNotifier {
+	var auth smtp.Auth
+	if cfg.SMTPUser != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUser, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+
+	return &SMTPNotifier{
+		addr: fmt.Sprintf("%s:%d", cfg.SMTPHost, cfg.SMTPPort),
+		auth: auth,
+		from: cfg.SMTPFrom,
+	}
+}
+
+func (notifier *SMTPNotifier) Send(ctx context.Context, message *Message) error {
+	if message.Channel != ChannelEmail {
+		return fmt.Errorf("Отправка уведомлений по каналу %s не поддерживается", message.Channel)
+	}
+
+	if strings.ContainsAny(message.To, "\r\n") {
+		return fmt.Errorf("Адрес получателя указан некорректно")
+	}
+
+	body := strings.Join([]string{
+		"From: " + notifier.from,
+		"To: " + message.To,
+		"Subject: " + mime.QEncoding.Encode("utf-8", message.Subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		message.Body,
+	}, "\r\n")
+
+	return smtp.SendMail(notifier.addr, notifier.auth, notifier.from, []string{message.To}, []byte(body))
+}
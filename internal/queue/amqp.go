@@ -0,0 +1,221 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"social-network/pkg/models"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Очередь RabbitMQ. Очереди событий и недоставленных событий устойчивы
+// к перезапуску брокера, сообщения публикуются как persistent с подтверждением
+type AMQPBroker struct {
+	url       string
+	queue     string
+	deadQueue string
+	prefetch  int
+
+	mu      sync.Mutex
+	conn    *amqp.Connection
+	channel *amqp.Channel // Канал публикации в режиме подтверждений
+}
+
+func NewAMQPBroker(url, queue string, prefetch int) (*AMQPBroker, error) {
+	broker := &AMQPBroker{
+		url:       url,
+		queue:     queue,
+		deadQueue: queue + ".dead",
+		prefetch:  prefetch,
+	}
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if _, err := broker.publishChannel(); err != nil {
+		return nil, err
+	}
+
+	return broker, nil
+}
+
+// Соединение с брокером, при разрыве устанавливается заново. Вызывается под mu
+func (broker *AMQPBroker) connection() (*amqp.Connection, error) {
+	if broker.conn != nil && !broker.conn.IsClosed() {
+		return broker.conn, nil
+	}
+
+	conn, err := amqp.Dial(broker.url)
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось подключиться к брокеру сообщений: %w", err)
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	defer channel.Close()
+
+	for _, name := range []string{broker.queue, broker.deadQueue} {
+		if _, err = channel.QueueDeclare(name, true, false, false, false, nil); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("Не удалось объявить очередь %s: %w", name, err)
+		}
+	}
+
+	broker.conn = conn
+	broker.channel = nil
+
+	return conn, nil
+}
+
+// Канал публикации, при закрытии открывается заново. Вызывается под mu
+func (broker *AMQPBroker) publishChannel() (*amqp.Channel, error) {
+	conn, err := broker.connection()
+	if err != nil {
+		return nil, err
+	}
+
+	if broker.channel != nil && !broker.channel.IsClosed() {
+		return broker.channel, nil
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err = channel.Confirm(false); err != nil {
+		channel.Close()
+		return nil, err
+	}
+	broker.channel = channel
+
+	return channel, nil
+}
+
+func (broker *AMQPBroker) Publish(ctx context.Context, event *models.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return broker.publish(ctx, broker.queue, event.Id.String(), body)
+}
+
+// Публикация с ожиданием подтверждения: после возврата без ошибки сообщение сохранено брокером
+func (broker *AMQPBroker) publish(ctx context.Context, queue, messageId string, body []byte) error {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	channel, err := broker.publishChannel()
+	if err != nil {
+		return err
+	}
+
+	confirmation, err := channel.PublishWithDeferredConfirmWithContext(ctx, "", queue, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    messageId,
+		Body:         body,
+	})
+	if err != nil {
+		return err
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return fmt.Errorf("Брокер не подтвердил публикацию сообщения %s", messageId)
+	}
+
+	return nil
+}
+
+func (broker *AMQPBroker) Consume(ctx context.Context, handler Handler) error {
+	broker.mu.Lock()
+	conn, err := broker.connection()
+	broker.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+
+	if err = channel.Qos(broker.prefetch, 0, false); err != nil {
+		return err
+	}
+
+	deliveries, err := channel.ConsumeWithContext(ctx, broker.queue, "", false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case delivery, ok := <-deliveries:
+			if !ok {
+				return fmt.Errorf("Канал получения сообщений закрыт")
+			}
+			if err = broker.handle(ctx, delivery, handler); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Обработка одного сообщения. Ошибка означает, что подтвердить его не удалось
+func (broker *AMQPBroker) handle(ctx context.Context, delivery amqp.Delivery, handler Handler) error {
+	var event models.Event
+	if err := json.Unmarshal(delivery.Body, &event); err != nil {
+		log.Printf("Нечитаемое сообщение %s отправлено в очередь недоставленных: %v", delivery.MessageId, err)
+		return broker.deadLetter(ctx, delivery)
+	}
+
+	err := handler(ctx, &event)
+	if err == nil {
+		return delivery.Ack(false)
+	}
+
+	// Остановка: сообщение вернется в очередь
+	if ctx.Err() != nil {
+		return delivery.Nack(false, true)
+	}
+
+	log.Printf("Событие %s (%s) отправлено в очередь недоставленных: %v", event.Id, event.Type, err)
+
+	return broker.deadLetter(ctx, delivery)
+}
+
+// Перенос сообщения в очередь недоставленных. Если перенести не удалось,
+// сообщение возвращается в основную очередь, чтобы не потерять его
+func (broker *AMQPBroker) deadLetter(ctx context.Context, delivery amqp.Delivery) error {
+	if err := broker.publish(ctx, broker.deadQueue, delivery.MessageId, delivery.Body); err != nil {
+		_ = delivery.Nack(false, true)
+		return err
+	}
+
+	return delivery.Ack(false)
+}
+
+func (broker *AMQPBroker) Close() error {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	if broker.conn == nil {
+		return nil
+	}
+
+	return broker.conn.Close()
+}
@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"social-network/internal/config"
+	"social-network/pkg/models"
+)
+
+const (
+	memoryBufferSize = 10000           // Емкость очереди в памяти
+	reconnectDelay   = 5 * time.Second // Пауза перед повторным подключением обработчика
+)
+
+var ErrBrokerClosed = errors.New("Брокер сообщений закрыт")
+
+// Обработчик события. Ошибка означает, что событие не обработано
+type Handler func(ctx context.Context, event *models.Event) error
+
+// Брокер сообщений. Событие, обработчик которого вернул ошибку,
+// переносится в очередь недоставленных (DLQ)
+type Broker interface {
+	Publish(ctx context.Context, event *models.Event) error
+	// Доставка событий обработчику до отмены ctx или разрыва соединения
+	Consume(ctx context.Context, handler Handler) error
+	Close() error
+}
+
+// Выбор реализации по настройкам: amqp (по умолчанию) или memory. Очередь в памяти
+// не сохраняет события: outbox отмечает их опубликованными при записи в канал, и
+// необработанные события теряются при остановке процесса
+func NewBroker(cfg *config.Config) (Broker, error) {
+	if cfg.QueueConfig.Driver == "memory" {
+		log.Println("Очередь событий в памяти (QUEUE_DRIVER=memory): события не сохраняются при перезапуске, только для разработки")
+		return NewMemoryBroker(memoryBufferSize), nil
+	}
+
+	return NewAMQPBroker(cfg.QueueConfig.AMQPURL, cfg.QueueConfig.Name, cfg.QueueConfig.Prefetch)
+}
+
+// Запуск workers обработчиков событий. При разрыве соединения обработчик
+// подключается заново, пока не отменен ctx
+func StartWorkers(ctx context.Context, broker Broker, workers int, handler Handler) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				err := broker.Consume(ctx, handler)
+				if ctx.Err() != nil || errors.Is(err, ErrBrokerClosed) {
+					return
+				}
+				log.Printf("Обработчик очереди остановлен: %v", err)
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(reconnectDelay):
+				}
+			}
+		}()
+	}
+}
@@ -0,0 +1,91 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"social-network/internal/cache"
+	"social-network/pkg/models"
+)
+
+// Сколько хранится отметка об обработанном событии
+const processedEventTTL = 24 * time.Hour
+
+// Повторные попытки обработки события с экспоненциальной паузой
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+// Обработчик, повторяющий попытки по policy. Ошибка последней попытки
+// возвращается брокеру, и событие уходит в очередь недоставленных
+func Retrying(policy RetryPolicy, handler Handler) Handler {
+	return func(ctx context.Context, event *models.Event) error {
+		backoff := policy.Backoff
+		for attempt := 1; ; attempt++ {
+			err := handler(ctx, event)
+			if err == nil {
+				return nil
+			}
+			if attempt >= policy.MaxAttempts {
+				return fmt.Errorf("Событие не обработано за %d попыток: %w", attempt, err)
+			}
+			log.Printf("Ошибка обработки события %s (%s), попытка %d: %v", event.Id, event.Type, attempt, err)
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+
+			backoff *= 2
+			if backoff > policy.MaxBackoff {
+				backoff = policy.MaxBackoff
+			}
+		}
+	}
+}
+
+// Последовательный вызов нескольких обработчиков одного события. Повтор
+// последовательности повторяет и уже выполненные обработчики, поэтому каждый из
+// них оборачивается в Idempotent со своим именем
+func Sequence(handlers ...Handler) Handler {
+	return func(ctx context.Context, event *models.Event) error {
+		for _, handler := range handlers {
+			if err := handler(ctx, event); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// Обработчик name, пропускающий уже обработанные им события: брокер может
+// доставить событие повторно, если подтверждение не дошло, а событие из очереди
+// недоставленных переотправляется целиком. При недоступности Redis событие
+// обрабатывается, обработчики ленты не ломаются от повтора
+func Idempotent(name string, handler Handler) Handler {
+	return func(ctx context.Context, event *models.Event) error {
+		processed, err := cache.IsEventProcessed(name, event.Id.String())
+		if err != nil {
+			log.Printf("Не удалось проверить обработку события %s: %v", event.Id, err)
+		}
+		if processed {
+			return nil
+		}
+
+		if err = handler(ctx, event); err != nil {
+			return err
+		}
+
+		if err = cache.MarkEventProcessed(name, event.Id.String(), processedEventTTL); err != nil {
+			log.Printf("Не удалось отметить обработку события %s обработчиком %s: %v", event.Id, name, err)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,89 @@
+package queue
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"social-network/pkg/models"
+)
+
+// Очередь в памяти процесса для тестов и локальной разработки.
+// События не переживают перезапуск
+type MemoryBroker struct {
+	events    chan *models.Event
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu   sync.Mutex
+	dead []*models.Event
+}
+
+func NewMemoryBroker(size int) *MemoryBroker {
+	return &MemoryBroker{
+		events: make(chan *models.Event, size),
+		done:   make(chan struct{}),
+	}
+}
+
+func (broker *MemoryBroker) Publish(ctx context.Context, event *models.Event) error {
+	select {
+	case <-broker.done:
+		return ErrBrokerClosed
+	default:
+	}
+
+	select {
+	case broker.events <- event:
+		return nil
+	case <-broker.done:
+		return ErrBrokerClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (broker *MemoryBroker) Consume(ctx context.Context, handler Handler) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-broker.done:
+			return ErrBrokerClosed
+		case event := <-broker.events:
+			err := handler(ctx, event)
+			if err == nil {
+				continue
+			}
+
+			// Остановка: событие возвращается в очередь, если в ней есть место
+			if ctx.Err() != nil {
+				select {
+				case broker.events <- event:
+				default:
+					log.Printf("Событие %s (%s) потеряно при остановке", event.Id, event.Type)
+				}
+				return ctx.Err()
+			}
+
+			log.Printf("Событие %s (%s) отправлено в очередь недоставленных: %v", event.Id, event.Type, err)
+			broker.mu.Lock()
+			broker.dead = append(broker.dead, event)
+			broker.mu.Unlock()
+		}
+	}
+}
+
+// События, которые не удалось обработать
+func (broker *MemoryBroker) DeadLetters() []*models.Event {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	return append([]*models.Event(nil), broker.dead...)
+}
+
+func (broker *MemoryBroker) Close() error {
+	broker.closeOnce.Do(func() { close(broker.done) })
+
+	return nil
+}
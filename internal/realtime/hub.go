@@ -0,0 +1,141 @@
+package realtime
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"social-network/internal/cache"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Сколько сообщений может ожидать отправки одному подписчику
+const subscriptionBuffer = 64
+
+// Доставка сообщений Redis pub/sub подключенным на этом узле клиентам.
+// Узел подписывается только на каналы своих клиентов
+type Hub struct {
+	pubsub *redis.PubSub
+
+	mu       sync.Mutex
+	channels map[string]map[*Subscription]struct{}
+}
+
+// Сообщение из канала pub/sub
+type Message struct {
+	Channel string
+	Payload string
+}
+
+// Подписка клиента на каналы
+type Subscription struct {
+	hub      *Hub
+	channels []string
+	messages chan *Message
+	overflow chan struct{}
+	closed   bool
+}
+
+func NewHub() *Hub {
+	hub := &Hub{
+		pubsub:   cache.GetClient().Subscribe(context.Background()),
+		channels: make(map[string]map[*Subscription]struct{}),
+	}
+	go hub.run()
+
+	return hub
+}
+
+// Подписка клиента на каналы
+func (hub *Hub) Subscribe(channels ...string) (*Subscription, error) {
+	subscription := &Subscription{
+		hub:      hub,
+		channels: channels,
+		messages: make(chan *Message, subscriptionBuffer),
+		overflow: make(chan struct{}),
+	}
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	var newChannels []string
+	for _, channel := range channels {
+		if hub.channels[channel] == nil {
+			hub.channels[channel] = make(map[*Subscription]struct{})
+			newChannels = append(newChannels, channel)
+		}
+		hub.channels[channel][subscription] = struct{}{}
+	}
+
+	if len(newChannels) > 0 {
+		if err := hub.pubsub.Subscribe(context.Background(), newChannels...); err != nil {
+			hub.remove(subscription)
+			return nil, err
+		}
+	}
+
+	return subscription, nil
+}
+
+func (subscription *Subscription) Messages() <-chan *Message {
+	return subscription.messages
+}
+
+// Закрывается, если клиент не успевает получать сообщения и часть из них потеряна
+func (subscription *Subscription) Overflow() <-chan struct{} {
+	return subscription.overflow
+}
+
+func (subscription *Subscription) Close() {
+	subscription.hub.mu.Lock()
+	defer subscription.hub.mu.Unlock()
+
+	subscription.hub.remove(subscription)
+}
+
+// Удаление подписки и отписка от каналов без подписчиков. Вызывается под mu
+func (hub *Hub) remove(subscription *Subscription) {
+	if subscription.closed {
+		return
+	}
+	subscription.closed = true
+
+	var unused []string
+	for _, channel := range subscription.channels {
+		delete(hub.channels[channel], subscription)
+		if len(hub.channels[channel]) == 0 {
+			delete(hub.channels, channel)
+			unused = append(unused, channel)
+		}
+	}
+
+	if len(unused) > 0 {
+		if err := hub.pubsub.Unsubscribe(context.Background(), unused...); err != nil {
+			log.Printf("Не удалось отписаться от каналов новых постов: %v", err)
+		}
+	}
+}
+
+// Раздача сообщений pub/sub подписчикам
+func (hub *Hub) run() {
+	for message := range hub.pubsub.Channel() {
+		hubMessage := &Message{Channel: message.Channel, Payload: message.Payload}
+
+		hub.mu.Lock()
+		for subscription := range hub.channels[message.Channel] {
+			select {
+			case subscription.messages <- hubMessage:
+			default:
+				// Медленный клиент переподключится и догрузит пропущенное
+				hub.remove(subscription)
+				close(subscription.overflow)
+			}
+		}
+		hub.mu.Unlock()
+	}
+}
+
+func (hub *Hub) Close() error {
+	return hub.pubsub.Close()
+}
@@ -0,0 +1,129 @@
+package security
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"social-network/internal/cache"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// Количество неудачных попыток до блокировки аккаунта и IP-адреса
+	accountFailureThreshold = 5
+	ipFailureThreshold      = 20
+	// Окно подсчета неудачных попыток
+	failureWindow = 15 * time.Minute
+	// Первая блокировка; каждая следующая неудача удваивает срок
+	baseLockout = 30 * time.Second
+	maxLockout  = time.Hour
+)
+
+const (
+	ScopeAccount = "account"
+	ScopeIP      = "ip"
+)
+
+// Слишком много неудачных попыток входа
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (err *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("Слишком много неудачных попыток входа, повторите через %d с", int(err.RetryAfter.Round(time.Second).Seconds()))
+}
+
+// Блокировка, установленная после очередной неудачной попытки
+type Lockout struct {
+	Scope    string
+	Subject  string
+	Failures int64
+	Duration time.Duration
+}
+
+// Счетчики неудачных попыток входа в Redis с экспоненциальной блокировкой
+type LoginLimiter struct {
+}
+
+func NewLoginLimiter() *LoginLimiter {
+	return &LoginLimiter{}
+}
+
+// Проверка блокировки; возвращает *TooManyAttemptsError, если вход временно запрещен.
+// При недоступности Redis вход не блокируется
+func (limiter *LoginLimiter) Check(ctx context.Context, scope, subject string) error {
+	ttl, err := cache.GetClient().PTTL(ctx, lockKey(scope, subject)).Result()
+	if err != nil {
+		log.Printf("Не удалось проверить блокировку входа: %v", err)
+		return nil
+	}
+
+	if ttl > 0 {
+		return &TooManyAttemptsError{RetryAfter: ttl}
+	}
+
+	return nil
+}
+
+// Учет неудачной попытки. Если превышен порог, устанавливает блокировку и возвращает ее
+func (limiter *LoginLimiter) RegisterFailure(ctx context.Context, scope, subject string) *Lockout {
+	threshold := int64(accountFailureThreshold)
+	if scope == ScopeIP {
+		threshold = ipFailureThreshold
+	}
+
+	failuresKey := failuresKey(scope, subject)
+	failures, err := cache.GetClient().Incr(ctx, failuresKey).Result()
+	if err != nil {
+		log.Printf("Не удалось учесть неудачную попытку входа: %v", err)
+		return nil
+	}
+
+	if failures < threshold {
+		cache.GetClient().Expire(ctx, failuresKey, failureWindow)
+		return nil
+	}
+
+	duration := lockoutDuration(failures - threshold)
+
+	pipe := cache.GetClient().Pipeline()
+	pipe.Set(ctx, lockKey(scope, subject), failures, duration)
+	// Счетчик живет дольше блокировки, чтобы следующая неудача продлила ее вдвое
+	pipe.Expire(ctx, failuresKey, failureWindow+duration)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		log.Printf("Не удалось установить блокировку входа: %v", err)
+		return nil
+	}
+
+	return &Lockout{Scope: scope, Subject: subject, Failures: failures, Duration: duration}
+}
+
+// Сброс счетчика после успешного входа
+func (limiter *LoginLimiter) Reset(ctx context.Context, scope, subject string) {
+	if err := cache.GetClient().Del(ctx, failuresKey(scope, subject)).Err(); err != nil {
+		log.Printf("Не удалось сбросить счетчик попыток входа: %v", err)
+	}
+}
+
+func lockoutDuration(step int64) time.Duration {
+	duration := baseLockout
+	for i := int64(0); i < step && duration < maxLockout; i++ {
+		duration *= 2
+	}
+
+	if duration > maxLockout {
+		return maxLockout
+	}
+
+	return duration
+}
+
+func failuresKey(scope, subject string) string {
+	return fmt.Sprintf("login_failures:%s:%s", scope, subject)
+}
+
+func lockKey(scope, subject string) string {
+	return fmt.Sprintf("login_lock:%s:%s", scope, subject)
+}
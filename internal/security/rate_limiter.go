@@ -0,0 +1,58 @@
+package security
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"social-network/internal/cache"
+	"time"
+)
+
+// Слишком много запросов за окно ограничения
+type TooManyRequestsError struct {
+	RetryAfter time.Duration
+}
+
+func (err *TooManyRequestsError) Error() string {
+	return fmt.Sprintf("Слишком много запросов, повторите через %d с", int(err.RetryAfter.Round(time.Second).Seconds()))
+}
+
+// Ограничение частоты запросов: не больше limit запросов за окно window на субъект.
+// Счетчики хранятся в Redis
+type RateLimiter struct {
+	name   string
+	limit  int64
+	window time.Duration
+}
+
+func NewRateLimiter(name string, limit int64, window time.Duration) *RateLimiter {
+	return &RateLimiter{name: name, limit: limit, window: window}
+}
+
+// Учет запроса; возвращает *TooManyRequestsError, если лимит исчерпан.
+// При недоступности Redis запрос не ограничивается
+func (limiter *RateLimiter) Allow(ctx context.Context, subject string) error {
+	key := fmt.Sprintf("rate:%s:%s", limiter.name, subject)
+	count, err := cache.GetClient().Incr(ctx, key).Result()
+	if err != nil {
+		log.Printf("Не удалось учесть запрос %s: %v", limiter.name, err)
+		return nil
+	}
+
+	if count == 1 {
+		cache.GetClient().Expire(ctx, key, limiter.window)
+	}
+
+	if count <= limiter.limit {
+		return nil
+	}
+
+	ttl, err := cache.GetClient().PTTL(ctx, key).Result()
+	if err != nil || ttl <= 0 {
+		// Окно без срока жизни (сбой между INCR и EXPIRE) - задаем его заново
+		cache.GetClient().Expire(ctx, key, limiter.window)
+		ttl = limiter.window
+	}
+
+	return &TooManyRequestsError{RetryAfter: ttl}
+}
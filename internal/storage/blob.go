@@ -0,0 +1,18 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Объект с указанным ключом отсутствует в хранилище
+var ErrBlobNotFound = errors.New("Файл не найден")
+
+// Хранилище бинарных объектов (оригиналы аватаров, миниатюры)
+type BlobStore interface {
+	Put(ctx context.Context, key string, data io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, string, error)
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Хранилище файлов на локальном диске
+type LocalBlobStore struct {
+	rootDir string
+	baseURL string
+}
+
+func NewLocalBlobStore(rootDir, baseURL string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(rootDir, 0o755); err != nil {
+		return nil, fmt.Errorf("Не удалось создать каталог хранилища: %w", err)
+	}
+
+	return &LocalBlobStore{
+		rootDir: rootDir,
+		baseURL: strings.TrimRight(baseURL, "/"),
+	}, nil
+}
+
+// Запись файла: сначала во временный файл, затем атомарное переименование
+func (store *LocalBlobStore) Put(ctx context.Context, key string, data io.Reader, contentType string) error {
+	path, err := store.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (store *LocalBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	path, err := store.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, "", ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return file, mime.TypeByExtension(filepath.Ext(path)), nil
+}
+
+func (store *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	path, err := store.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (store *LocalBlobStore) URL(key string) string {
+	return store.baseURL + "/" + key
+}
+
+// Путь к файлу внутри корневого каталога; ключи с выходом за его пределы отклоняются
+func (store *LocalBlobStore) path(key string) (string, error) {
+	cleaned := filepath.Clean("/" + key)
+	if cleaned == "/" {
+		return "", fmt.Errorf("Некорректный ключ файла")
+	}
+
+	return filepath.Join(store.rootDir, cleaned), nil
+}
@@ -66,6 +66,87 @@ func createTables(db *sql.DB) error {
 			password VARCHAR(255) NOT NULL,
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		);
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS username VARCHAR(32);
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS username_changed_at TIMESTAMP;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_scheduled_at TIMESTAMP;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS moderation_action_id UUID;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_revoked_at TIMESTAMP;
+		CREATE TABLE IF NOT EXISTS username_history (
+			username VARCHAR(32) PRIMARY KEY NOT NULL,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			expires_at TIMESTAMP NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS login_identities (
+			id UUID PRIMARY KEY NOT NULL,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			kind VARCHAR(10) NOT NULL,
+			value VARCHAR(255) NOT NULL,
+			verified_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(user_id, kind, value)
+		);
+		CREATE TABLE IF NOT EXISTS verification_codes (
+			identity_id UUID PRIMARY KEY NOT NULL REFERENCES login_identities(id) ON DELETE CASCADE,
+			code_hash VARCHAR(64) NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0
+		);
+		ALTER TABLE verification_codes ADD COLUMN IF NOT EXISTS sent_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+		ALTER TABLE verification_codes ADD COLUMN IF NOT EXISTS sends INTEGER NOT NULL DEFAULT 1;
+		ALTER TABLE verification_codes ADD COLUMN IF NOT EXISTS window_started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+		CREATE TABLE IF NOT EXISTS password_reset_tokens (
+			token_hash VARCHAR(64) PRIMARY KEY NOT NULL,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS moderation_actions (
+			id UUID PRIMARY KEY NOT NULL,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			state VARCHAR(20) NOT NULL,
+			reason TEXT NOT NULL,
+			expires_at TIMESTAMP,
+			actor_id UUID,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS outbox (
+			id UUID PRIMARY KEY NOT NULL,
+			event_type VARCHAR(50) NOT NULL,
+			payload JSONB NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			delivered_at TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS user_roles (
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			role VARCHAR(32) NOT NULL,
+			granted_by UUID,
+			granted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, role)
+		);
+		CREATE TABLE IF NOT EXISTS sessions (
+			id UUID PRIMARY KEY NOT NULL,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			user_agent TEXT NOT NULL DEFAULT '',
+			ip VARCHAR(64) NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			revoked_at TIMESTAMP
+		);
+		ALTER TABLE sessions ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+		UPDATE sessions SET expires_at = created_at + INTERVAL '24 hours' WHERE expires_at IS NULL;
+		CREATE TABLE IF NOT EXISTS two_factor (
+			user_id UUID PRIMARY KEY NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			secret TEXT NOT NULL,
+			last_used_step BIGINT NOT NULL DEFAULT 0,
+			enabled_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS two_factor_recovery_codes (
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			code_hash VARCHAR(64) NOT NULL,
+			used_at TIMESTAMP,
+			PRIMARY KEY (user_id, code_hash)
+		);
 		CREATE TABLE IF NOT EXISTS profiles (
 			id UUID PRIMARY KEY NOT NULL,
 			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -75,8 +156,12 @@ func createTables(db *sql.DB) error {
 			gender VARCHAR(20) NOT NULL,
 			biography TEXT,
 			city VARCHAR(100),
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			avatar VARCHAR(255),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		);
+		ALTER TABLE profiles ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+		ALTER TABLE profiles ADD COLUMN IF NOT EXISTS avatar VARCHAR(255);
 		CREATE TABLE IF NOT EXISTS friendships (
         	id UUID PRIMARY KEY NOT NULL,
         	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -93,6 +178,50 @@ func createTables(db *sql.DB) error {
 			is_public BOOLEAN DEFAULT false,
         	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		);
+		CREATE TABLE IF NOT EXISTS post_reactions (
+			post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (post_id, user_id)
+		);
+		CREATE TABLE IF NOT EXISTS post_comments (
+			id UUID PRIMARY KEY NOT NULL,
+			post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			content TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS feed_rebuild_jobs (
+			id UUID PRIMARY KEY NOT NULL,
+			active_days INT NOT NULL DEFAULT 0,
+			force BOOLEAN NOT NULL DEFAULT false,
+			status VARCHAR(20) NOT NULL,
+			last_user_id UUID,
+			total INT NOT NULL DEFAULT 0,
+			processed INT NOT NULL DEFAULT 0,
+			failed INT NOT NULL DEFAULT 0,
+			error TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			finished_at TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS privacy_settings (
+			user_id UUID PRIMARY KEY NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			birth_date VARCHAR(20) NOT NULL DEFAULT 'everyone',
+			city VARCHAR(20) NOT NULL DEFAULT 'everyone',
+			biography VARCHAR(20) NOT NULL DEFAULT 'everyone',
+			searchable BOOLEAN NOT NULL DEFAULT true,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id UUID PRIMARY KEY NOT NULL,
+			event VARCHAR(50) NOT NULL,
+			user_id UUID,
+			actor_id UUID,
+			ip VARCHAR(64),
+			details JSONB,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
 		CREATE TABLE IF NOT EXISTS test (
         	id UUID PRIMARY KEY NOT NULL
 		);`
@@ -109,6 +238,21 @@ func CreateIndexes(db *sql.DB) error {
 			first_name varchar_pattern_ops
 		);
 		CREATE INDEX IF NOT EXISTS idx_profiles_user_id ON profiles(user_id);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_lower ON users (LOWER(username));
+		CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log(user_id, created_at);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_login_identities_verified ON login_identities (kind, value) WHERE verified_at IS NOT NULL;
+		CREATE INDEX IF NOT EXISTS idx_users_deletion_scheduled_at ON users(deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
+		CREATE INDEX IF NOT EXISTS idx_moderation_actions_user_id ON moderation_actions(user_id, created_at DESC);
+		CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(created_at, id) WHERE delivered_at IS NULL;
+		CREATE INDEX IF NOT EXISTS idx_outbox_delivered_at ON outbox(delivered_at) WHERE delivered_at IS NOT NULL;
+		CREATE INDEX IF NOT EXISTS idx_posts_user_id_created_at ON posts(user_id, created_at DESC, id DESC);
+		CREATE INDEX IF NOT EXISTS idx_post_reactions_user_id ON post_reactions(user_id, created_at);
+		CREATE INDEX IF NOT EXISTS idx_post_comments_post_id ON post_comments(post_id, created_at);
+		CREATE INDEX IF NOT EXISTS idx_post_comments_user_id ON post_comments(user_id, created_at);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_feed_rebuild_jobs_running ON feed_rebuild_jobs((true)) WHERE status = 'running';
+		CREATE INDEX IF NOT EXISTS idx_sessions_last_seen_at ON sessions(last_seen_at, user_id) WHERE revoked_at IS NULL;
+		CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id, last_seen_at DESC) WHERE revoked_at IS NULL;
+		CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
 		`
 
 	_, err := db.Exec(query)
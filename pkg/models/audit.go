@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Типы событий журнала аудита
+const (
+	AuditLoginLockout      = "login_lockout"
+	AuditTwoFactorEnabled  = "two_factor_enabled"
+	AuditTwoFactorDisabled = "two_factor_disabled"
+	AuditRoleGranted       = "role_granted"
+	AuditRoleRevoked       = "role_revoked"
+	AuditDeletionScheduled = "account_deletion_scheduled"
+	AuditDeletionCanceled  = "account_deletion_canceled"
+	AuditAccountDeleted    = "account_deleted"
+	AuditModerationChanged = "moderation_changed"
+)
+
+// Запись журнала аудита
+type AuditEvent struct {
+	Id        uuid.UUID              `json:"id"`
+	Event     string                 `json:"event"`
+	UserId    uuid.UUID              `json:"user_id"`
+	ActorId   uuid.UUID              `json:"actor_id"`
+	IP        string                 `json:"ip"`
+	Details   map[string]interface{} `json:"details"`
+	CreatedAt time.Time              `json:"created_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Комментарий к посту
+type Comment struct {
+	Id        uuid.UUID `json:"id"`
+	PostId    uuid.UUID `json:"post_id"`
+	UserId    uuid.UUID `json:"user_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Реакция пользователя на пост
+type Reaction struct {
+	PostId    uuid.UUID `json:"post_id"`
+	UserId    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateCommentRequest struct {
+	Content string `json:"content"`
+}
+
+// Реакции и комментарии к посту
+type PostEngagement struct {
+	Reactions int
+	Comments  int
+}
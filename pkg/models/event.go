@@ -0,0 +1,59 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Типы событий, по которым обновляются ленты
+const (
+	EventPostCreated    = "post_created"
+	EventPostDeleted    = "post_deleted"
+	EventFriendAdded    = "friend_added"
+	EventFriendRemoved  = "friend_removed"
+	EventAccountDeleted = "account_deleted"
+)
+
+// Событие очереди. Id используется для идемпотентной обработки повторных доставок
+type Event struct {
+	Id        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Новое событие с данными payload
+func NewEvent(eventType string, payload interface{}) (*Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Event{
+		Id:        uuid.New(),
+		Type:      eventType,
+		Payload:   data,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// Разбор данных события
+func (event *Event) Decode(target interface{}) error {
+	return json.Unmarshal(event.Payload, target)
+}
+
+// Данные событий добавления и удаления друга
+type FriendEvent struct {
+	UserId   uuid.UUID `json:"user_id"`
+	FriendId uuid.UUID `json:"friend_id"`
+}
+
+// Данные события удаления аккаунта: посты и друзья на момент удаления, после
+// каскадного удаления строк их уже не получить
+type AccountDeletedEvent struct {
+	UserId    uuid.UUID   `json:"user_id"`
+	PostIds   []uuid.UUID `json:"post_ids"`
+	FriendIds []uuid.UUID `json:"friend_ids"`
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidFeedCursor = errors.New("Некорректный курсор ленты")
+	ErrUnknownFeedMode   = errors.New("Неизвестный режим ленты")
+)
+
+// Режимы ранжирования ленты
+const (
+	FeedModeChronological = "chronological" // Сначала новые посты
+	FeedModeEngagement    = "engagement"    // По реакциям и комментариям с затуханием со временем
+	FeedModeCloseFriends  = "close_friends" // Сначала посты близких друзей
+)
+
+// Позиция в ленте: последний полученный клиентом пост. Лента упорядочена
+// по (created_at, id) по убыванию, следующая страница начинается строго после курсора
+type FeedCursor struct {
+	CreatedAt time.Time
+	Id        uuid.UUID
+}
+
+// Курсор, указывающий на пост
+func FeedCursorOf(post *Post) *FeedCursor {
+	return &FeedCursor{CreatedAt: post.CreatedAt, Id: post.Id}
+}
+
+// Непрозрачное для клиента строковое представление курсора
+func (cursor *FeedCursor) Encode() string {
+	if cursor == nil {
+		return ""
+	}
+
+	raw := strconv.FormatInt(cursor.CreatedAt.UnixNano(), 10) + ":" + cursor.Id.String()
+
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// Разбор курсора, полученного от клиента. Пустая строка означает начало ленты
+func DecodeFeedCursor(value string) (*FeedCursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidFeedCursor
+	}
+
+	nanos, id, found := strings.Cut(string(raw), ":")
+	if !found {
+		return nil, ErrInvalidFeedCursor
+	}
+
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidFeedCursor
+	}
+
+	postId, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrInvalidFeedCursor
+	}
+
+	return &FeedCursor{CreatedAt: time.Unix(0, unixNano).UTC(), Id: postId}, nil
+}
+
+// Позиция в ранжированной ленте: момент ранжирования, фиксирующий окно постов
+// и затухание оценок, и число уже полученных клиентом постов
+type RankedFeedCursor struct {
+	RankedAt time.Time
+	Offset   int
+}
+
+func (cursor *RankedFeedCursor) Encode() string {
+	if cursor == nil {
+		return ""
+	}
+
+	raw := strconv.FormatInt(cursor.RankedAt.UnixNano(), 10) + ":" + strconv.Itoa(cursor.Offset)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// Разбор курсора ранжированной ленты. Пустая строка означает начало ленты
+func DecodeRankedFeedCursor(value string) (*RankedFeedCursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidFeedCursor
+	}
+
+	nanos, offset, found := strings.Cut(string(raw), ":")
+	if !found {
+		return nil, ErrInvalidFeedCursor
+	}
+
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidFeedCursor
+	}
+
+	offsetValue, err := strconv.Atoi(offset)
+	if err != nil || offsetValue < 0 {
+		return nil, ErrInvalidFeedCursor
+	}
+
+	return &RankedFeedCursor{RankedAt: time.Unix(0, unixNano).UTC(), Offset: offsetValue}, nil
+}
+
+// Страница ленты
+type FeedResponse struct {
+	Mode       string  `json:"mode"`
+	Posts      []*Post `json:"posts"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
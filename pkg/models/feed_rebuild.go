@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Состояния задачи пересборки лент
+const (
+	FeedRebuildRunning   = "running"
+	FeedRebuildCompleted = "completed"
+	FeedRebuildFailed    = "failed"
+)
+
+// Задача пересборки лент пользователей. Пользователи обходятся по возрастанию id,
+// LastUserId - последний пользователь обработанной пачки: после него задача
+// продолжается после остановки
+type FeedRebuildJob struct {
+	Id         uuid.UUID  `json:"id"`
+	ActiveDays int        `json:"active_days"` // 0 - все пользователи
+	Force      bool       `json:"force"`       // false - только отсутствующие в кеше ленты
+	Status     string     `json:"status"`
+	LastUserId *uuid.UUID `json:"last_user_id,omitempty"`
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Failed     int        `json:"failed"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+type StartFeedRebuildRequest struct {
+	ActiveDays int  `json:"active_days"`
+	Force      bool `json:"force"`
+	Resume     bool `json:"resume"`
+}
@@ -1,6 +1,10 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 // Друзья
 type FriendShip struct {
@@ -8,5 +12,5 @@ type FriendShip struct {
 	UserId    uuid.UUID `json:"user_id"`
 	FriendId  uuid.UUID `json:"friend_id"`
 	Status    string    `json:"status"`
-	CreatedAt uuid.Time `json:"created_at"`
+	CreatedAt time.Time `json:"created_at"`
 }
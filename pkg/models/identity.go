@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Тип идентификатора для входа
+type IdentityKind string
+
+const (
+	IdentityEmail IdentityKind = "email"
+	IdentityPhone IdentityKind = "phone"
+)
+
+// Идентификатор для входа (email, телефон), привязанный к пользователю
+type LoginIdentity struct {
+	Id         uuid.UUID    `json:"id"`
+	UserId     uuid.UUID    `json:"user_id"`
+	Kind       IdentityKind `json:"kind"`
+	Value      string       `json:"value"`
+	VerifiedAt *time.Time   `json:"verified_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+func (identity *LoginIdentity) IsVerified() bool {
+	return identity.VerifiedAt != nil
+}
+
+// Код подтверждения идентификатора
+type VerificationCode struct {
+	IdentityId uuid.UUID
+	CodeHash   string
+	ExpiresAt  time.Time
+	Attempts   int
+}
+
+type AddIdentityRequest struct {
+	Kind  IdentityKind `json:"kind"`
+	Value string       `json:"value"`
+}
+
+type VerifyIdentityRequest struct {
+	Code string `json:"code"`
+}
+
+type IdentityResponse struct {
+	Id       string       `json:"id"`
+	Kind     IdentityKind `json:"kind"`
+	Value    string       `json:"value"`
+	Verified bool         `json:"verified"`
+}
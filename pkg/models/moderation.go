@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Состояние пользователя, устанавливаемое модератором
+type ModerationState string
+
+const (
+	// Ограничений нет
+	ModerationActive ModerationState = "active"
+	// Вход запрещен, контент скрыт от всех
+	ModerationSuspended ModerationState = "suspended"
+	// Контент виден только автору
+	ModerationShadowBanned ModerationState = "shadow_banned"
+)
+
+func (state ModerationState) IsValid() bool {
+	return state == ModerationActive || state == ModerationSuspended || state == ModerationShadowBanned
+}
+
+// Виден ли контент пользователя в этом состоянии зрителю
+func (state ModerationState) ContentVisibleTo(isAuthor bool) bool {
+	switch state {
+	case ModerationSuspended:
+		return false
+	case ModerationShadowBanned:
+		return isAuthor
+	default:
+		return true
+	}
+}
+
+// Изменение состояния пользователя модератором
+type ModerationAction struct {
+	Id        uuid.UUID       `json:"id"`
+	UserId    uuid.UUID       `json:"user_id"`
+	State     ModerationState `json:"state"`
+	Reason    string          `json:"reason"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+	ActorId   uuid.UUID       `json:"actor_id"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Действующее на момент now состояние: по истечении срока ограничение снимается
+func (action *ModerationAction) StateAt(now time.Time) ModerationState {
+	if action == nil || action.State == ModerationActive {
+		return ModerationActive
+	}
+	if action.ExpiresAt != nil && !action.ExpiresAt.After(now) {
+		return ModerationActive
+	}
+
+	return action.State
+}
+
+type ModerationRequest struct {
+	State     ModerationState `json:"state"`
+	Reason    string          `json:"reason"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+type ModerationResponse struct {
+	UserId  string              `json:"user_id"`
+	State   ModerationState     `json:"state"`
+	Current *ModerationAction   `json:"current,omitempty"`
+	History []*ModerationAction `json:"history"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+// Типы событий пользователя в потоке уведомлений
+const (
+	NotificationFeedPost      = "feed_post"
+	NotificationFriendRequest = "friend_request"
+	NotificationMention       = "mention"
+	// Часть событий после Last-Event-ID уже удалена из журнала, клиенту нужно заново загрузить данные
+	NotificationReset = "reset"
+)
+
+// Событие из журнала пользователя. Id - идентификатор записи Redis stream
+type Notification struct {
+	Id   string          `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Данные уведомления о заявке в друзья
+type FriendRequestNotification struct {
+	UserId uuid.UUID `json:"user_id"`
+}
@@ -0,0 +1,64 @@
+package models
+
+import "github.com/google/uuid"
+
+// Уровень видимости поля анкеты
+type PrivacyLevel string
+
+const (
+	PrivacyEveryone PrivacyLevel = "everyone"
+	PrivacyFriends  PrivacyLevel = "friends"
+	PrivacyNobody   PrivacyLevel = "nobody"
+)
+
+func (level PrivacyLevel) IsValid() bool {
+	return level == PrivacyEveryone || level == PrivacyFriends || level == PrivacyNobody
+}
+
+// Доступно ли поле с таким уровнем видимости зрителю с указанным отношением к владельцу
+func (level PrivacyLevel) VisibleTo(isOwner, isFriend bool) bool {
+	switch {
+	case isOwner:
+		return true
+	case level == PrivacyEveryone:
+		return true
+	case level == PrivacyFriends:
+		return isFriend
+	default:
+		return false
+	}
+}
+
+// Настройки приватности анкеты пользователя
+type PrivacySettings struct {
+	UserId     uuid.UUID    `json:"user_id"`
+	Birthdate  PrivacyLevel `json:"birthdate"`
+	City       PrivacyLevel `json:"city"`
+	Biography  PrivacyLevel `json:"biography"`
+	Searchable bool         `json:"searchable"`
+}
+
+// Настройки по умолчанию: все поля видны всем, анкета участвует в поиске
+func DefaultPrivacySettings(userId uuid.UUID) *PrivacySettings {
+	return &PrivacySettings{
+		UserId:     userId,
+		Birthdate:  PrivacyEveryone,
+		City:       PrivacyEveryone,
+		Biography:  PrivacyEveryone,
+		Searchable: true,
+	}
+}
+
+type UpdatePrivacyRequest struct {
+	Birthdate  *PrivacyLevel `json:"birthdate"`
+	City       *PrivacyLevel `json:"city"`
+	Biography  *PrivacyLevel `json:"biography"`
+	Searchable *bool         `json:"searchable"`
+}
+
+type PrivacySettingsResponse struct {
+	Birthdate  PrivacyLevel `json:"birthdate"`
+	City       PrivacyLevel `json:"city"`
+	Biography  PrivacyLevel `json:"biography"`
+	Searchable bool         `json:"searchable"`
+}
@@ -12,25 +12,38 @@ import (
 type Profile struct {
 	Id        uuid.UUID `json:"id"`
 	UserId    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
 	FirstName string    `json:"first_name"`
 	LastName  string    `json:"last_name"`
 	Birthdate time.Time `json:"birth_date"`
 	Gender    string    `json:"gender"`
 	Biography string    `json:"biography"`
 	City      string    `json:"city"`
+	Avatar    string    `json:"avatar"`
 	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type ProfileResponse struct {
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Birthdate string `json:"birthdate"`
-	Gender    string `json:"gender"`
-	Biography string `json:"biography"`
-	City      string `json:"city"`
+	UserId    string          `json:"user_id"`
+	Username  string          `json:"username,omitempty"`
+	FirstName string          `json:"first_name"`
+	LastName  string          `json:"last_name"`
+	Birthdate string          `json:"birthdate,omitempty"`
+	Gender    string          `json:"gender"`
+	Biography string          `json:"biography,omitempty"`
+	City      string          `json:"city,omitempty"`
+	Avatar    *AvatarResponse `json:"avatar,omitempty"`
+}
+
+// Ссылки на оригинал аватара и его миниатюры (ключ - размер в пикселях)
+type AvatarResponse struct {
+	Original   string            `json:"original"`
+	Thumbnails map[string]string `json:"thumbnails"`
 }
 
 type RegisterRequest struct {
+	Username  string `json:"username"`
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
 	Birthdate string `json:"birthdate"`
@@ -40,6 +53,21 @@ type RegisterRequest struct {
 	Password  string `json:"password"`
 }
 
+// Частичное обновление анкеты: nil-поля не изменяются
+type UpdateProfileRequest struct {
+	FirstName *string `json:"first_name"`
+	LastName  *string `json:"last_name"`
+	Birthdate *string `json:"birthdate"`
+	Gender    *string `json:"gender"`
+	Biography *string `json:"biography"`
+	City      *string `json:"city"`
+}
+
+// Запрос анкет нескольких пользователей
+type BatchProfileRequest struct {
+	UserIds []string `json:"user_ids"`
+}
+
 type RegisterResponse struct {
 	UserId string `json:"user_id"`
 }
@@ -0,0 +1,27 @@
+package models
+
+import "slices"
+
+// Роли пользователей. Пользователь без ролей - обычный участник сети
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+)
+
+func IsValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleModerator
+}
+
+// Проверка наличия роли; администратору доступно все
+func HasRole(roles []string, role string) bool {
+	return slices.Contains(roles, RoleAdmin) || slices.Contains(roles, role)
+}
+
+type SetRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+type RolesResponse struct {
+	UserId string   `json:"user_id"`
+	Roles  []string `json:"roles"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Настройки двухфакторной аутентификации пользователя. Секрет хранится в зашифрованном виде;
+// пока EnabledAt не задан, подключение не подтверждено и при входе не учитывается
+type TwoFactor struct {
+	UserId       uuid.UUID
+	Secret       string
+	LastUsedStep int64
+	EnabledAt    *time.Time
+	CreatedAt    time.Time
+}
+
+func (twoFactor *TwoFactor) IsEnabled() bool {
+	return twoFactor.EnabledAt != nil
+}
+
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TwoFactorEnableResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Отключение требует повторной аутентификации: пароль и код TOTP или код восстановления
+type TwoFactorDisableRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
@@ -10,19 +10,57 @@ import (
 
 // Пользователь
 type User struct {
-	Id        uuid.UUID `json:"id"`
-	Password  string    `json:"password"`
-	CreatedAt time.Time `json:"created_at"`
+	Id                uuid.UUID `json:"id"`
+	Username          string    `json:"username"`
+	Password          string    `json:"password"`
+	UsernameChangedAt time.Time `json:"username_changed_at"`
+	CreatedAt         time.Time `json:"created_at"`
 }
 
+// Вход по логину (id, username, подтвержденный email или телефон);
+// поля id и username поддерживаются для совместимости
 type AuthRequest struct {
+	Login    string `json:"login"`
 	Id       string `json:"id"`
+	Username string `json:"username"`
 	Password string `json:"password"`
 }
 
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+// Запрос сброса пароля по подтвержденному email или телефону
+type ForgotPasswordRequest struct {
+	Login string `json:"login"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type ChangeUsernameRequest struct {
+	Username string `json:"username"`
+}
+
+// Удаление аккаунта требует подтверждения паролем
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+type DeleteAccountResponse struct {
+	DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+}
+
+// При включенной двухфакторной аутентификации вместо токена доступа возвращается
+// промежуточный токен, который обменивается на токен доступа по коду TOTP
 type AuthResponse struct {
-	Token  string    `json:"token"`
-	UserId uuid.UUID `json:"user_id"`
+	Token             string    `json:"token,omitempty"`
+	UserId            uuid.UUID `json:"user_id"`
+	TwoFactorRequired bool      `json:"two_factor_required,omitempty"`
+	ChallengeToken    string    `json:"challenge_token,omitempty"`
 }
 
 type ErrorResponse struct {
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"social-network/pkg/database"
+	"social-network/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+type AuditRepository interface {
+	Add(ctx context.Context, event *models.AuditEvent) error
+}
+
+type auditRepository struct {
+	routerDB *database.ReplicationRouter
+}
+
+func InitAuditRepository(routerDB *database.ReplicationRouter) AuditRepository {
+	return &auditRepository{routerDB: routerDB}
+}
+
+// Запись события в журнал аудита (всегда на мастер)
+func (repository *auditRepository) Add(ctx context.Context, event *models.AuditEvent) error {
+	ctx = database.WithMaster(ctx)
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	if event.Id == uuid.Nil {
+		event.Id = uuid.New()
+	}
+
+	details, err := json.Marshal(event.Details)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO audit_log (id, event, user_id, actor_id, ip, details) VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at`
+	err = db.QueryRowContext(ctx, query,
+		event.Id,
+		event.Event,
+		nullUUID(event.UserId),
+		nullUUID(event.ActorId),
+		event.IP,
+		details,
+	).Scan(&event.CreatedAt)
+
+	return err
+}
+
+// uuid.Nil сохраняем как NULL
+func nullUUID(id uuid.UUID) interface{} {
+	if id == uuid.Nil {
+		return nil
+	}
+
+	return id
+}
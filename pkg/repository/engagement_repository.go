@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"context"
+	"social-network/pkg/database"
+	"social-network/pkg/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type EngagementRepository interface {
+	AddReaction(ctx context.Context, postId, userId uuid.UUID) error
+	DeleteReaction(ctx context.Context, postId, userId uuid.UUID) error
+	AddComment(ctx context.Context, comment *models.Comment) error
+	GetComments(ctx context.Context, postId uuid.UUID, limit, offset int) ([]*models.Comment, error)
+	GetCommentsByUserId(ctx context.Context, userId uuid.UUID, limit, offset int) ([]*models.Comment, error)
+	GetReactionsByUserId(ctx context.Context, userId uuid.UUID, limit, offset int) ([]*models.Reaction, error)
+	GetByPostIds(ctx context.Context, postIds []uuid.UUID) (map[uuid.UUID]models.PostEngagement, error)
+	GetAuthorInteractions(ctx context.Context, userId uuid.UUID, since time.Time) (map[uuid.UUID]int, error)
+}
+
+type engagementRepository struct {
+	routerDB *database.ReplicationRouter
+}
+
+func InitEngagementRepository(routerDB *database.ReplicationRouter) EngagementRepository {
+	return &engagementRepository{routerDB: routerDB}
+}
+
+// Реакция пользователя на пост; повторная реакция ничего не меняет
+func (repository *engagementRepository) AddReaction(ctx context.Context, postId, userId uuid.UUID) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO post_reactions (post_id, user_id) VALUES ($1, $2) ON CONFLICT (post_id, user_id) DO NOTHING`
+	_, err = db.ExecContext(ctx, query, postId, userId)
+
+	return err
+}
+
+func (repository *engagementRepository) DeleteReaction(ctx context.Context, postId, userId uuid.UUID) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `DELETE FROM post_reactions WHERE post_id = $1 AND user_id = $2`
+	_, err = db.ExecContext(ctx, query, postId, userId)
+
+	return err
+}
+
+func (repository *engagementRepository) AddComment(ctx context.Context, comment *models.Comment) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO post_comments (id, post_id, user_id, content) VALUES ($1, $2, $3, $4) RETURNING created_at`
+
+	return db.QueryRowContext(ctx, query, comment.Id, comment.PostId, comment.UserId, comment.Content).Scan(&comment.CreatedAt)
+}
+
+// Комментарии к посту в порядке написания
+func (repository *engagementRepository) GetComments(ctx context.Context, postId uuid.UUID, limit, offset int) ([]*models.Comment, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, post_id, user_id, content, created_at FROM post_comments
+		WHERE post_id = $1 ORDER BY created_at, id LIMIT $2 OFFSET $3`
+	rows, err := db.QueryContext(ctx, query, postId, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []*models.Comment
+	for rows.Next() {
+		var comment models.Comment
+		if err = rows.Scan(&comment.Id, &comment.PostId, &comment.UserId, &comment.Content, &comment.CreatedAt); err != nil {
+			return nil, err
+		}
+		comments = append(comments, &comment)
+	}
+
+	return comments, rows.Err()
+}
+
+// Комментарии пользователя ко всем постам в порядке написания
+func (repository *engagementRepository) GetCommentsByUserId(ctx context.Context, userId uuid.UUID, limit, offset int) ([]*models.Comment, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, post_id, user_id, content, created_at FROM post_comments
+		WHERE user_id = $1 ORDER BY created_at, id LIMIT $2 OFFSET $3`
+	rows, err := db.QueryContext(ctx, query, userId, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []*models.Comment
+	for rows.Next() {
+		var comment models.Comment
+		if err = rows.Scan(&comment.Id, &comment.PostId, &comment.UserId, &comment.Content, &comment.CreatedAt); err != nil {
+			return nil, err
+		}
+		comments = append(comments, &comment)
+	}
+
+	return comments, rows.Err()
+}
+
+// Реакции пользователя на посты в порядке добавления
+func (repository *engagementRepository) GetReactionsByUserId(ctx context.Context, userId uuid.UUID, limit, offset int) ([]*models.Reaction, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT post_id, user_id, created_at FROM post_reactions
+		WHERE user_id = $1 ORDER BY created_at, post_id LIMIT $2 OFFSET $3`
+	rows, err := db.QueryContext(ctx, query, userId, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reactions []*models.Reaction
+	for rows.Next() {
+		var reaction models.Reaction
+		if err = rows.Scan(&reaction.PostId, &reaction.UserId, &reaction.CreatedAt); err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, &reaction)
+	}
+
+	return reactions, rows.Err()
+}
+
+// Число реакций и комментариев к постам postIds. Посты без них в результат не попадают
+func (repository *engagementRepository) GetByPostIds(ctx context.Context, postIds []uuid.UUID) (map[uuid.UUID]models.PostEngagement, error) {
+	result := make(map[uuid.UUID]models.PostEngagement)
+	if len(postIds) == 0 {
+		return result, nil
+	}
+
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT post_id, SUM(reactions), SUM(comments) FROM (
+			SELECT post_id, COUNT(*) AS reactions, 0 AS comments FROM post_reactions
+			WHERE post_id = ANY($1::uuid[]) GROUP BY post_id
+			UNION ALL
+			SELECT post_id, 0, COUNT(*) FROM post_comments
+			WHERE post_id = ANY($1::uuid[]) GROUP BY post_id
+		) engagement GROUP BY post_id`
+	rows, err := db.QueryContext(ctx, query, uuidArray(postIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postId uuid.UUID
+		var engagement models.PostEngagement
+		if err = rows.Scan(&postId, &engagement.Reactions, &engagement.Comments); err != nil {
+			return nil, err
+		}
+		result[postId] = engagement
+	}
+
+	return result, rows.Err()
+}
+
+// Число реакций и комментариев пользователя userId к постам других авторов
+// начиная с since, по авторам
+func (repository *engagementRepository) GetAuthorInteractions(ctx context.Context, userId uuid.UUID, since time.Time) (map[uuid.UUID]int, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT p.user_id, COUNT(*) FROM (
+			SELECT post_id FROM post_reactions WHERE user_id = $1 AND created_at >= $2
+			UNION ALL
+			SELECT post_id FROM post_comments WHERE user_id = $1 AND created_at >= $2
+		) interactions
+		JOIN posts p ON p.id = interactions.post_id
+		WHERE p.user_id <> $1
+		GROUP BY p.user_id`
+	rows, err := db.QueryContext(ctx, query, userId, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[uuid.UUID]int)
+	for rows.Next() {
+		var authorId uuid.UUID
+		var count int
+		if err = rows.Scan(&authorId, &count); err != nil {
+			return nil, err
+		}
+		result[authorId] = count
+	}
+
+	return result, rows.Err()
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"social-network/pkg/database"
+	"social-network/pkg/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Уже выполняется другая задача пересборки лент
+var ErrFeedRebuildRunning = errors.New("Пересборка лент уже выполняется")
+
+type FeedRebuildRepository interface {
+	Create(ctx context.Context, job *models.FeedRebuildJob) error
+	GetById(ctx context.Context, jobId uuid.UUID) (*models.FeedRebuildJob, error)
+	GetLatest(ctx context.Context) (*models.FeedRebuildJob, error)
+	Claim(ctx context.Context, jobId uuid.UUID, staleBefore time.Time) (*models.FeedRebuildJob, error)
+	SaveProgress(ctx context.Context, job *models.FeedRebuildJob) error
+	Heartbeat(ctx context.Context, jobId uuid.UUID) error
+	Finish(ctx context.Context, job *models.FeedRebuildJob) error
+}
+
+type feedRebuildRepository struct {
+	routerDB *database.ReplicationRouter
+}
+
+func InitFeedRebuildRepository(routerDB *database.ReplicationRouter) FeedRebuildRepository {
+	return &feedRebuildRepository{routerDB: routerDB}
+}
+
+const feedRebuildColumns = `id, active_days, force, status, last_user_id, total, processed, failed, COALESCE(error, ''), created_at, updated_at, finished_at`
+
+// Создание задачи в состоянии running. Одновременно выполняется не больше одной
+// задачи: это гарантирует частичный уникальный индекс
+func (repository *feedRebuildRepository) Create(ctx context.Context, job *models.FeedRebuildJob) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO feed_rebuild_jobs (id, active_days, force, status, total, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)`
+	_, err = db.ExecContext(ctx, query, job.Id, job.ActiveDays, job.Force, job.Status, job.Total, job.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrFeedRebuildRunning
+	}
+
+	return err
+}
+
+func (repository *feedRebuildRepository) GetById(ctx context.Context, jobId uuid.UUID) (*models.FeedRebuildJob, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + feedRebuildColumns + ` FROM feed_rebuild_jobs WHERE id = $1`
+
+	return scanFeedRebuildJob(db.QueryRowContext(ctx, query, jobId))
+}
+
+// Последняя созданная задача; nil, если задач не было
+func (repository *feedRebuildRepository) GetLatest(ctx context.Context) (*models.FeedRebuildJob, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + feedRebuildColumns + ` FROM feed_rebuild_jobs ORDER BY created_at DESC LIMIT 1`
+
+	return scanFeedRebuildJob(db.QueryRowContext(ctx, query))
+}
+
+// Захват незавершенной задачи для продолжения: упавшей или выполняемой, прогресс
+// которой не обновлялся с staleBefore (экземпляр, выполнявший ее, остановился).
+// Возвращает nil, если задачу продолжать нельзя
+func (repository *feedRebuildRepository) Claim(ctx context.Context, jobId uuid.UUID, staleBefore time.Time) (*models.FeedRebuildJob, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `UPDATE feed_rebuild_jobs SET status = $2, error = NULL, finished_at = NULL, updated_at = $3
+		WHERE id = $1 AND (status = $4 OR (status = $2 AND updated_at < $5))
+		RETURNING ` + feedRebuildColumns
+	job, err := scanFeedRebuildJob(db.QueryRowContext(ctx, query,
+		jobId, models.FeedRebuildRunning, time.Now().UTC(), models.FeedRebuildFailed, staleBefore.UTC()))
+	if isUniqueViolation(err) {
+		return nil, ErrFeedRebuildRunning
+	}
+
+	return job, err
+}
+
+// Сохранение прогресса выполняемой задачи; заодно отмечает, что задача жива
+func (repository *feedRebuildRepository) SaveProgress(ctx context.Context, job *models.FeedRebuildJob) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	job.UpdatedAt = time.Now().UTC()
+	query := `UPDATE feed_rebuild_jobs SET last_user_id = $2, total = $3, processed = $4, failed = $5, updated_at = $6 WHERE id = $1`
+	_, err = db.ExecContext(ctx, query, job.Id, job.LastUserId, job.Total, job.Processed, job.Failed, job.UpdatedAt)
+
+	return err
+}
+
+// Отметка, что выполняемая задача жива, без изменения прогресса
+func (repository *feedRebuildRepository) Heartbeat(ctx context.Context, jobId uuid.UUID) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE feed_rebuild_jobs SET updated_at = $3 WHERE id = $1 AND status = $2`
+	_, err = db.ExecContext(ctx, query, jobId, models.FeedRebuildRunning, time.Now().UTC())
+
+	return err
+}
+
+// Завершение задачи с итоговым состоянием job.Status
+func (repository *feedRebuildRepository) Finish(ctx context.Context, job *models.FeedRebuildJob) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	job.UpdatedAt = now
+	job.FinishedAt = &now
+	query := `UPDATE feed_rebuild_jobs SET status = $2, last_user_id = $3, total = $4, processed = $5, failed = $6,
+			error = NULLIF($7, ''), updated_at = $8, finished_at = $8
+		WHERE id = $1`
+	_, err = db.ExecContext(ctx, query, job.Id, job.Status, job.LastUserId, job.Total, job.Processed, job.Failed, job.Error, now)
+
+	return err
+}
+
+func scanFeedRebuildJob(row *sql.Row) (*models.FeedRebuildJob, error) {
+	var job models.FeedRebuildJob
+	var lastUserId uuid.NullUUID
+	var finishedAt sql.NullTime
+	err := row.Scan(&job.Id, &job.ActiveDays, &job.Force, &job.Status, &lastUserId, &job.Total, &job.Processed,
+		&job.Failed, &job.Error, &job.CreatedAt, &job.UpdatedAt, &finishedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if lastUserId.Valid {
+		job.LastUserId = &lastUserId.UUID
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+
+	return &job, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"social-network/pkg/database"
+	"social-network/pkg/models"
 
 	"github.com/google/uuid"
 )
@@ -12,6 +13,7 @@ type FriendShipRepository interface {
 	Add(ctx context.Context, userId uuid.UUID, friendId uuid.UUID) error
 	Delete(ctx context.Context, userId uuid.UUID, friendId uuid.UUID) error
 	GetFriendsByUserId(ctx context.Context, userId uuid.UUID) ([]uuid.UUID, error)
+	GetListByUserId(ctx context.Context, userId uuid.UUID) ([]*models.FriendShip, error)
 }
 
 type friendShipRepository struct {
@@ -22,7 +24,7 @@ func InitFriendShipRepository(routerDB *database.ReplicationRouter) FriendShipRe
 	return &friendShipRepository{routerDB: routerDB}
 }
 
-// Добавление друга friendId
+// Добавление друга friendId. Событие для обновления лент записывается в outbox в той же транзакции
 func (repository *friendShipRepository) Add(ctx context.Context, userId uuid.UUID, friendId uuid.UUID) error {
 	db, err := repository.routerDB.GetDatabase(ctx)
 	if err != nil {
@@ -36,32 +38,56 @@ func (repository *friendShipRepository) Add(ctx context.Context, userId uuid.UUI
 		return fmt.Errorf("Выбранный пользователь уже есть в списке друзей")
 	}
 
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	id := uuid.New()
 	status := "pending"
-	query = `INSERT INTO friendships (id, user_id, friend_id, status) VALUES ($1, $2, $3, $4) RETURNING created_at`
-	_, err = db.ExecContext(ctx, query, id, userId, friendId, status)
+	query = `INSERT INTO friendships (id, user_id, friend_id, status) VALUES ($1, $2, $3, $4)`
+	if _, err = tx.ExecContext(ctx, query, id, userId, friendId, status); err != nil {
+		return err
+	}
 
-	return err
+	err = insertOutboxEvent(ctx, tx, models.EventFriendAdded, &models.FriendEvent{UserId: userId, FriendId: friendId})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-// Удаление друга friendId
+// Удаление друга friendId. Событие для обновления лент записывается в outbox в той же транзакции
 func (repository *friendShipRepository) Delete(ctx context.Context, userId uuid.UUID, friendId uuid.UUID) error {
 	db, err := repository.routerDB.GetDatabase(ctx)
 	if err != nil {
 		return err
 	}
 
-	var exists bool
-	query := `SELECT EXISTS(SELECT 1 FROM friendships WHERE user_id = $1 AND friend_id = $2 OR user_id = $2 AND friend_id = $1)`
-	db.QueryRowContext(ctx, query, userId, friendId).Scan(&exists)
-	if !exists {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM friendships WHERE (user_id = $1 AND friend_id = $2 OR user_id = $2 AND friend_id = $1)`
+	result, err := tx.ExecContext(ctx, query, userId, friendId)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
 		return fmt.Errorf("В вашем списке друзей нет выбранного пользователя")
 	}
 
-	query = `DELETE FROM friendships WHERE (user_id = $1 AND friend_id = $2 OR user_id = $2 AND friend_id = $1)`
-	_, err = db.ExecContext(ctx, query, userId, friendId)
+	err = insertOutboxEvent(ctx, tx, models.EventFriendRemoved, &models.FriendEvent{UserId: userId, FriendId: friendId})
+	if err != nil {
+		return err
+	}
 
-	return err
+	return tx.Commit()
 }
 
 // Возвращает id-друзей
@@ -105,3 +131,30 @@ func (repository *friendShipRepository) GetFriendsByUserId(ctx context.Context,
 
 	return friendIds, nil
 }
+
+// Записи о дружбе, в которых участвует пользователь
+func (repository *friendShipRepository) GetListByUserId(ctx context.Context, userId uuid.UUID) ([]*models.FriendShip, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, user_id, friend_id, status, created_at FROM friendships WHERE user_id = $1 OR friend_id = $1 ORDER BY created_at`
+	rows, err := db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	friendShips := []*models.FriendShip{}
+	for rows.Next() {
+		var friendShip models.FriendShip
+		err = rows.Scan(&friendShip.Id, &friendShip.UserId, &friendShip.FriendId, &friendShip.Status, &friendShip.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		friendShips = append(friendShips, &friendShip)
+	}
+
+	return friendShips, rows.Err()
+}
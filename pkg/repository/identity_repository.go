@@ -0,0 +1,269 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"social-network/pkg/database"
+	"social-network/pkg/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type IdentityRepository interface {
+	Create(ctx context.Context, identity *models.LoginIdentity) error
+	GetById(ctx context.Context, id uuid.UUID) (*models.LoginIdentity, error)
+	GetListByUserId(ctx context.Context, userId uuid.UUID) ([]*models.LoginIdentity, error)
+	GetVerified(ctx context.Context, kind models.IdentityKind, value string) (*models.LoginIdentity, error)
+	Delete(ctx context.Context, id, userId uuid.UUID) error
+	SaveCode(ctx context.Context, code *models.VerificationCode, limits VerificationLimits) error
+	UseAttempt(ctx context.Context, identityId uuid.UUID, maxAttempts int) (*models.VerificationCode, error)
+	MarkVerified(ctx context.Context, identityId uuid.UUID) error
+}
+
+var (
+	// Идентификатор уже привязан к этому пользователю
+	ErrIdentityExists = errors.New("Идентификатор уже добавлен")
+	// Идентификатор подтвержден другим пользователем
+	ErrIdentityTaken = errors.New("Идентификатор уже используется другим пользователем")
+	// Код запрошен раньше окончания паузы или исчерпан лимит отправок за окно
+	ErrVerificationSendLimit = errors.New("Код подтверждения запрашивается слишком часто, повторите позже")
+	// Исчерпаны попытки ввода кода за окно
+	ErrVerificationAttemptsExceeded = errors.New("Превышено количество попыток, повторите позже")
+	// Подтвержденного идентификатора нет в БД
+	ErrIdentityNotFound = errors.New("Идентификатор не найден")
+)
+
+// Ограничения на коды подтверждения одного идентификатора. Попытки ввода и отправки
+// считаются в окне Window и не сбрасываются новым кодом
+type VerificationLimits struct {
+	Cooldown time.Duration
+	MaxSends int
+	Window   time.Duration
+}
+
+type identityRepository struct {
+	routerDB *database.ReplicationRouter
+}
+
+func InitIdentityRepository(routerDB *database.ReplicationRouter) IdentityRepository {
+	return &identityRepository{routerDB: routerDB}
+}
+
+func (repository *identityRepository) Create(ctx context.Context, identity *models.LoginIdentity) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO login_identities (id, user_id, kind, value) VALUES ($1, $2, $3, $4) RETURNING created_at`
+	err = db.QueryRowContext(ctx, query, identity.Id, identity.UserId, identity.Kind, identity.Value).Scan(&identity.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrIdentityExists
+	}
+
+	return err
+}
+
+func (repository *identityRepository) GetById(ctx context.Context, id uuid.UUID) (*models.LoginIdentity, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, user_id, kind, value, verified_at, created_at FROM login_identities WHERE id = $1`
+	identity, err := scanIdentity(db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, fmt.Errorf("Идентификатор не найден")
+	}
+
+	return identity, nil
+}
+
+func (repository *identityRepository) GetListByUserId(ctx context.Context, userId uuid.UUID) ([]*models.LoginIdentity, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, user_id, kind, value, verified_at, created_at FROM login_identities WHERE user_id = $1 ORDER BY created_at`
+	rows, err := db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []*models.LoginIdentity
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+// Подтвержденный идентификатор для входа
+func (repository *identityRepository) GetVerified(ctx context.Context, kind models.IdentityKind, value string) (*models.LoginIdentity, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, user_id, kind, value, verified_at, created_at FROM login_identities
+		WHERE kind = $1 AND value = $2 AND verified_at IS NOT NULL`
+	identity, err := scanIdentity(db.QueryRowContext(ctx, query, kind, value))
+	if err == sql.ErrNoRows {
+		return nil, ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+func (repository *identityRepository) Delete(ctx context.Context, id, userId uuid.UUID) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `DELETE FROM login_identities WHERE id = $1 AND user_id = $2`
+	result, err := db.ExecContext(ctx, query, id, userId)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("Идентификатор не найден")
+	}
+
+	return nil
+}
+
+// Сохранение нового кода подтверждения (заменяет предыдущий). Если пауза после
+// прошлой отправки не истекла или лимит отправок за окно исчерпан, возвращает
+// ErrVerificationSendLimit. Счетчик попыток обнуляется только с началом нового окна
+func (repository *identityRepository) SaveCode(ctx context.Context, code *models.VerificationCode, limits VerificationLimits) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	query := `INSERT INTO verification_codes AS v (identity_id, code_hash, expires_at, attempts, sent_at, sends, window_started_at)
+		VALUES ($1, $2, $3, 0, $4, 1, $4)
+		ON CONFLICT (identity_id) DO UPDATE SET
+			code_hash = EXCLUDED.code_hash,
+			expires_at = EXCLUDED.expires_at,
+			sent_at = EXCLUDED.sent_at,
+			attempts = CASE WHEN v.window_started_at <= $5 THEN 0 ELSE v.attempts END,
+			sends = CASE WHEN v.window_started_at <= $5 THEN 1 ELSE v.sends + 1 END,
+			window_started_at = CASE WHEN v.window_started_at <= $5 THEN EXCLUDED.window_started_at ELSE v.window_started_at END
+		WHERE v.sent_at <= $6 AND (v.window_started_at <= $5 OR v.sends < $7)`
+	result, err := db.ExecContext(ctx, query, code.IdentityId, code.CodeHash, code.ExpiresAt, now,
+		now.Add(-limits.Window), now.Add(-limits.Cooldown), limits.MaxSends)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrVerificationSendLimit
+	}
+
+	return nil
+}
+
+// Учет попытки ввода кода до его проверки, чтобы параллельные запросы не обходили
+// лимит. Возвращает код с учетом этой попытки или ErrVerificationAttemptsExceeded
+func (repository *identityRepository) UseAttempt(ctx context.Context, identityId uuid.UUID, maxAttempts int) (*models.VerificationCode, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	code := models.VerificationCode{IdentityId: identityId}
+	query := `UPDATE verification_codes SET attempts = attempts + 1
+		WHERE identity_id = $1 AND attempts < $2
+		RETURNING code_hash, expires_at, attempts`
+	err = db.QueryRowContext(ctx, query, identityId, maxAttempts).Scan(&code.CodeHash, &code.ExpiresAt, &code.Attempts)
+	if err == sql.ErrNoRows {
+		var exists bool
+		query = `SELECT EXISTS (SELECT 1 FROM verification_codes WHERE identity_id = $1)`
+		if err = db.QueryRowContext(ctx, query, identityId).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("Код подтверждения не запрашивался")
+		}
+
+		return nil, ErrVerificationAttemptsExceeded
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &code, nil
+}
+
+// Отметка о подтверждении и удаление использованного кода
+func (repository *identityRepository) MarkVerified(ctx context.Context, identityId uuid.UUID) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE login_identities SET verified_at = CURRENT_TIMESTAMP WHERE id = $1`
+	_, err = tx.ExecContext(ctx, query, identityId)
+	if isUniqueViolation(err) {
+		return ErrIdentityTaken
+	}
+	if err != nil {
+		return err
+	}
+
+	query = `DELETE FROM verification_codes WHERE identity_id = $1`
+	_, err = tx.ExecContext(ctx, query, identityId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanIdentity(row rowScanner) (*models.LoginIdentity, error) {
+	var (
+		identity   models.LoginIdentity
+		verifiedAt sql.NullTime
+	)
+
+	err := row.Scan(&identity.Id, &identity.UserId, &identity.Kind, &identity.Value, &verifiedAt, &identity.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if verifiedAt.Valid {
+		identity.VerifiedAt = &verifiedAt.Time
+	}
+
+	return &identity, nil
+}
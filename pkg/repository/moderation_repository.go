@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"social-network/pkg/database"
+	"social-network/pkg/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ModerationRepository interface {
+	Add(ctx context.Context, action *models.ModerationAction) error
+	GetCurrent(ctx context.Context, userId uuid.UUID) (*models.ModerationAction, error)
+	GetHistory(ctx context.Context, userId uuid.UUID) ([]*models.ModerationAction, error)
+	GetRestricted(ctx context.Context, now time.Time) ([]*models.ModerationAction, error)
+}
+
+type moderationRepository struct {
+	routerDB *database.ReplicationRouter
+}
+
+func InitModerationRepository(routerDB *database.ReplicationRouter) ModerationRepository {
+	return &moderationRepository{routerDB: routerDB}
+}
+
+// Запись изменения состояния; запись становится текущим состоянием пользователя
+func (repository *moderationRepository) Add(ctx context.Context, action *models.ModerationAction) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE users SET moderation_action_id = $1 WHERE id = $2`
+	result, err := tx.ExecContext(ctx, query, action.Id, action.UserId)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("Пользователь не найден")
+	}
+
+	query = `INSERT INTO moderation_actions (id, user_id, state, reason, expires_at, actor_id) VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at`
+	err = tx.QueryRowContext(ctx, query,
+		action.Id,
+		action.UserId,
+		action.State,
+		action.Reason,
+		action.ExpiresAt,
+		nullUUID(action.ActorId),
+	).Scan(&action.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Текущее состояние пользователя; nil, если модераторы его не меняли
+func (repository *moderationRepository) GetCurrent(ctx context.Context, userId uuid.UUID) (*models.ModerationAction, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ma.id, ma.user_id, ma.state, ma.reason, ma.expires_at, ma.actor_id, ma.created_at FROM users u
+		JOIN moderation_actions ma ON ma.id = u.moderation_action_id WHERE u.id = $1`
+	action, err := scanModerationAction(db.QueryRowContext(ctx, query, userId))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return action, err
+}
+
+// История изменений состояния, начиная с последнего
+func (repository *moderationRepository) GetHistory(ctx context.Context, userId uuid.UUID) ([]*models.ModerationAction, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, user_id, state, reason, expires_at, actor_id, created_at FROM moderation_actions
+		WHERE user_id = $1 ORDER BY created_at DESC`
+
+	return repository.queryActions(ctx, db, query, userId)
+}
+
+// Действующие на момент now ограничения всех пользователей
+func (repository *moderationRepository) GetRestricted(ctx context.Context, now time.Time) ([]*models.ModerationAction, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ma.id, ma.user_id, ma.state, ma.reason, ma.expires_at, ma.actor_id, ma.created_at FROM users u
+		JOIN moderation_actions ma ON ma.id = u.moderation_action_id
+		WHERE ma.state <> $1 AND (ma.expires_at IS NULL OR ma.expires_at > $2)`
+
+	return repository.queryActions(ctx, db, query, models.ModerationActive, now)
+}
+
+func (repository *moderationRepository) queryActions(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]*models.ModerationAction, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := []*models.ModerationAction{}
+	for rows.Next() {
+		action, err := scanModerationAction(rows)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, action)
+	}
+
+	return actions, rows.Err()
+}
+
+func scanModerationAction(row rowScanner) (*models.ModerationAction, error) {
+	var (
+		action    models.ModerationAction
+		expiresAt sql.NullTime
+		actorId   uuid.NullUUID
+	)
+
+	err := row.Scan(&action.Id, &action.UserId, &action.State, &action.Reason, &expiresAt, &actorId, &action.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if expiresAt.Valid {
+		action.ExpiresAt = &expiresAt.Time
+	}
+	action.ActorId = actorId.UUID
+
+	return &action, nil
+}
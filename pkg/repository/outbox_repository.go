@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"social-network/pkg/database"
+	"social-network/pkg/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type OutboxRepository interface {
+	PublishPending(ctx context.Context, limit int, publish func(event *models.Event) error) (int, error)
+	DeleteDelivered(ctx context.Context, before time.Time) (int64, error)
+}
+
+type outboxRepository struct {
+	routerDB *database.ReplicationRouter
+}
+
+func InitOutboxRepository(routerDB *database.ReplicationRouter) OutboxRepository {
+	return &outboxRepository{routerDB: routerDB}
+}
+
+// Запись события в outbox в транзакции изменения, которое оно описывает
+func insertOutboxEvent(ctx context.Context, tx *sql.Tx, eventType string, payload interface{}) error {
+	event, err := models.NewEvent(eventType, payload)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO outbox (id, event_type, payload, created_at) VALUES ($1, $2, $3, $4)`
+	_, err = tx.ExecContext(ctx, query, event.Id, event.Type, []byte(event.Payload), event.CreatedAt)
+
+	return err
+}
+
+// Публикация не более limit недоставленных событий в порядке их создания.
+// Строки блокируются с SKIP LOCKED, поэтому несколько экземпляров приложения
+// не публикуют одно событие одновременно. Публикация останавливается на первой
+// ошибке, отметка о доставке ставится только опубликованным событиям
+func (repository *outboxRepository) PublishPending(ctx context.Context, limit int, publish func(event *models.Event) error) (int, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT id, event_type, payload, created_at FROM outbox
+		WHERE delivered_at IS NULL ORDER BY created_at, id LIMIT $1 FOR UPDATE SKIP LOCKED`
+	rows, err := tx.QueryContext(ctx, query, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var events []*models.Event
+	for rows.Next() {
+		var event models.Event
+		var payload []byte
+		if err = rows.Scan(&event.Id, &event.Type, &payload, &event.CreatedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		event.Payload = payload
+		events = append(events, &event)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var delivered []uuid.UUID
+	var publishErr error
+	for _, event := range events {
+		if publishErr = publish(event); publishErr != nil {
+			break
+		}
+		delivered = append(delivered, event.Id)
+	}
+
+	if len(delivered) > 0 {
+		query = `UPDATE outbox SET delivered_at = $1 WHERE id = ANY($2::uuid[])`
+		if _, err = tx.ExecContext(ctx, query, time.Now().UTC(), uuidArray(delivered)); err != nil {
+			return 0, err
+		}
+		if err = tx.Commit(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(delivered), publishErr
+}
+
+// Удаление доставленных событий старше before
+func (repository *outboxRepository) DeleteDelivered(ctx context.Context, before time.Time) (int64, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `DELETE FROM outbox WHERE delivered_at < $1`
+	result, err := db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
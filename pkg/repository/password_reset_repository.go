@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"social-network/pkg/database"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PasswordResetRepository interface {
+	Create(ctx context.Context, tokenHash string, userId uuid.UUID, expiresAt time.Time) error
+	GetUserId(ctx context.Context, tokenHash string) (uuid.UUID, error)
+	Reset(ctx context.Context, tokenHash string, password string) (uuid.UUID, error)
+}
+
+var errPasswordResetTokenInvalid = fmt.Errorf("Ссылка для сброса пароля недействительна или устарела")
+
+type passwordResetRepository struct {
+	routerDB *database.ReplicationRouter
+}
+
+func InitPasswordResetRepository(routerDB *database.ReplicationRouter) PasswordResetRepository {
+	return &passwordResetRepository{routerDB: routerDB}
+}
+
+func (repository *passwordResetRepository) Create(ctx context.Context, tokenHash string, userId uuid.UUID, expiresAt time.Time) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO password_reset_tokens (token_hash, user_id, expires_at) VALUES ($1, $2, $3)`
+	_, err = db.ExecContext(ctx, query, tokenHash, userId, expiresAt)
+
+	return err
+}
+
+// Пользователь, которому выдан действующий токен сброса
+func (repository *passwordResetRepository) GetUserId(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	var userId uuid.UUID
+	query := `SELECT user_id FROM password_reset_tokens WHERE token_hash = $1 AND expires_at > $2`
+	err = db.QueryRowContext(ctx, query, tokenHash, time.Now().UTC()).Scan(&userId)
+	if err != nil {
+		return uuid.Nil, errPasswordResetTokenInvalid
+	}
+
+	return userId, nil
+}
+
+// Смена пароля по токену сброса. Токен одноразовый: после использования удаляются
+// все токены пользователя
+func (repository *passwordResetRepository) Reset(ctx context.Context, tokenHash string, password string) (uuid.UUID, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	var userId uuid.UUID
+	query := `DELETE FROM password_reset_tokens WHERE token_hash = $1 AND expires_at > $2 RETURNING user_id`
+	err = tx.QueryRowContext(ctx, query, tokenHash, time.Now().UTC()).Scan(&userId)
+	if err != nil {
+		return uuid.Nil, errPasswordResetTokenInvalid
+	}
+
+	query = `UPDATE users SET password = $1 WHERE id = $2`
+	_, err = tx.ExecContext(ctx, query, password, userId)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	query = `DELETE FROM password_reset_tokens WHERE user_id = $1`
+	_, err = tx.ExecContext(ctx, query, userId)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return userId, tx.Commit()
+}
@@ -2,10 +2,10 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"social-network/pkg/database"
 	"social-network/pkg/models"
-	"strconv"
 	"strings"
 	"time"
 
@@ -15,9 +15,11 @@ import (
 type PostRepository interface {
 	AddPost(ctx context.Context, post *models.Post) error
 	GetById(ctx context.Context, postId uuid.UUID) (*models.Post, error)
+	GetByIds(ctx context.Context, postIds []uuid.UUID) ([]*models.Post, error)
 	DeletePost(ctx context.Context, postId, userId uuid.UUID) error
 	GetListByUserId(ctx context.Context, userId uuid.UUID, limit, offset int) ([]*models.Post, error)
-	GetListByUserIds(ctx context.Context, userIds []uuid.UUID, limit, offset int) ([]*models.Post, error)
+	GetListByUserIds(ctx context.Context, userIds []uuid.UUID, cursor *models.FeedCursor, limit int) ([]*models.Post, error)
+	GetIdsByUserId(ctx context.Context, userId uuid.UUID) ([]uuid.UUID, error)
 }
 
 type postRepository struct {
@@ -28,21 +30,31 @@ func InitPostRepository(routerDB *database.ReplicationRouter) PostRepository {
 	return &postRepository{routerDB: routerDB}
 }
 
+// Создание поста. Событие для обновления лент записывается в outbox в той же транзакции
 func (repository *postRepository) AddPost(ctx context.Context, post *models.Post) error {
 	db, err := repository.routerDB.GetDatabase(ctx)
 	if err != nil {
 		return err
 	}
 
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	var createdAt string
 	query := `INSERT INTO posts (id, user_id, title, content, is_public) VALUES ($1, $2, $3, $4, $5) RETURNING created_at`
 
-	err = db.QueryRowContext(ctx, query,
+	err = tx.QueryRowContext(ctx, query,
 		&post.Id,
 		&post.UserId,
 		&post.Title,
 		&post.Content,
 		&post.IsPublic).Scan(&createdAt)
+	if err != nil {
+		return err
+	}
 
 	createdAtValue, err := time.Parse(time.RFC3339, createdAt)
 	if err != nil {
@@ -50,30 +62,48 @@ func (repository *postRepository) AddPost(ctx context.Context, post *models.Post
 	}
 	post.CreatedAt = createdAtValue
 
-	return nil
+	if err = insertOutboxEvent(ctx, tx, models.EventPostCreated, post); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
+// Удаление поста автора. Событие для обновления лент записывается в outbox в той же транзакции
 func (repository *postRepository) DeletePost(ctx context.Context, postId, userId uuid.UUID) error {
 	db, err := repository.routerDB.GetDatabase(ctx)
 	if err != nil {
 		return err
 	}
 
-	var exists bool
-	query := `SELECT EXISTS(SELECT 1 FROM posts WHERE id = $1 AND user_id = $2)`
-	err = db.QueryRowContext(ctx, query, postId, userId).Scan(&exists)
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	if !exists {
+	var post models.Post
+	query := `DELETE FROM posts WHERE id = $1 AND user_id = $2 RETURNING id, user_id, title, content, is_public, created_at`
+	err = tx.QueryRowContext(ctx, query, postId, userId).Scan(
+		&post.Id,
+		&post.UserId,
+		&post.Title,
+		&post.Content,
+		&post.IsPublic,
+		&post.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
 		return fmt.Errorf("Пост не найден")
 	}
+	if err != nil {
+		return err
+	}
 
-	query = `DELETE FROM posts WHERE id = $1`
-	_, err = db.ExecContext(ctx, query, postId)
+	if err = insertOutboxEvent(ctx, tx, models.EventPostDeleted, &post); err != nil {
+		return err
+	}
 
-	return err
+	return tx.Commit()
 }
 
 func (repository *postRepository) GetById(ctx context.Context, postId uuid.UUID) (*models.Post, error) {
@@ -100,6 +130,37 @@ func (repository *postRepository) GetById(ctx context.Context, postId uuid.UUID)
 	return &post, err
 }
 
+// Посты с идентификаторами postIds; отсутствующих в БД в результате нет
+func (repository *postRepository) GetByIds(ctx context.Context, postIds []uuid.UUID) ([]*models.Post, error) {
+	if len(postIds) == 0 {
+		return nil, nil
+	}
+
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, user_id, title, content, is_public, created_at FROM posts WHERE id = ANY($1::uuid[])`
+	rows, err := db.QueryContext(ctx, query, uuidArray(postIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []*models.Post
+	for rows.Next() {
+		var post models.Post
+		err := rows.Scan(&post.Id, &post.UserId, &post.Title, &post.Content, &post.IsPublic, &post.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, &post)
+	}
+
+	return posts, rows.Err()
+}
+
 // Получить все посты определенного пользователя
 func (repository *postRepository) GetListByUserId(ctx context.Context, userId uuid.UUID, limit, offset int) ([]*models.Post, error) {
 	db, err := repository.routerDB.GetDatabase(ctx)
@@ -130,31 +191,30 @@ func (repository *postRepository) GetListByUserId(ctx context.Context, userId uu
 	return posts, nil
 }
 
-func (repository *postRepository) GetListByUserIds(ctx context.Context, userIds []uuid.UUID, limit, offset int) ([]*models.Post, error) {
+// Страница постов пользователей userIds, упорядоченная по (created_at, id) по убыванию.
+// Keyset-выборка начинается строго после курсора, nil - с самого нового поста
+func (repository *postRepository) GetListByUserIds(ctx context.Context, userIds []uuid.UUID, cursor *models.FeedCursor, limit int) ([]*models.Post, error) {
 	db, err := repository.routerDB.GetDatabase(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	placeholders := make([]string, len(userIds))
-	args := make([]interface{}, len(userIds))
-
-	for i, u := range userIds {
-		placeholders[i] = fmt.Sprintf("$%d", i+1)
-		args[i] = u.String()
+	query := `SELECT id, user_id, title, content, is_public, created_at FROM posts
+		WHERE user_id = ANY($1::uuid[])
+		ORDER BY created_at DESC, id DESC LIMIT $2`
+	args := []interface{}{uuidArray(userIds), limit}
+	if cursor != nil {
+		query = `SELECT id, user_id, title, content, is_public, created_at FROM posts
+			WHERE user_id = ANY($1::uuid[]) AND (created_at, id) < ($3::timestamp, $4::uuid)
+			ORDER BY created_at DESC, id DESC LIMIT $2`
+		args = append(args, cursor.CreatedAt.UTC(), cursor.Id)
 	}
 
-	query := fmt.Sprintf(
-		"SELECT id, user_id, title, content, is_public, created_at FROM posts WHERE user_id::uuid IN (%s) ORDER BY created_at DESC OFFSET %s LIMIT %s",
-		strings.Join(placeholders, ", "),
-		strconv.Itoa(offset),
-		strconv.Itoa(limit),
-	)
-
-	rows, err := db.Query(query, args...)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	var posts []*models.Post
 	for rows.Next() {
@@ -173,6 +233,32 @@ func (repository *postRepository) GetListByUserIds(ctx context.Context, userIds
 	return posts, nil
 }
 
+// Идентификаторы всех постов пользователя
+func (repository *postRepository) GetIdsByUserId(ctx context.Context, userId uuid.UUID) ([]uuid.UUID, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id FROM posts WHERE user_id = $1`
+	rows, err := db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var postIds []uuid.UUID
+	for rows.Next() {
+		var postId uuid.UUID
+		if err = rows.Scan(&postId); err != nil {
+			return nil, err
+		}
+		postIds = append(postIds, postId)
+	}
+
+	return postIds, rows.Err()
+}
+
 func (repository *postRepository) buildInQuery(uuids []uuid.UUID) (string, []interface{}) {
 	// Создаем плейсхолдеры: $1, $2, $3...
 	placeholders := make([]string, len(uuids))
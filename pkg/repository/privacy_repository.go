@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"social-network/pkg/database"
+	"social-network/pkg/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type PrivacyRepository interface {
+	GetByUserId(ctx context.Context, userId uuid.UUID) (*models.PrivacySettings, error)
+	GetByUserIds(ctx context.Context, userIds []uuid.UUID) (map[uuid.UUID]*models.PrivacySettings, error)
+	Save(ctx context.Context, settings *models.PrivacySettings) error
+}
+
+type privacyRepository struct {
+	routerDB *database.ReplicationRouter
+}
+
+func InitPrivacyRepository(routerDB *database.ReplicationRouter) PrivacyRepository {
+	return &privacyRepository{routerDB: routerDB}
+}
+
+// Настройки приватности пользователя; если они не сохранялись - настройки по умолчанию
+func (repository *privacyRepository) GetByUserId(ctx context.Context, userId uuid.UUID) (*models.PrivacySettings, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := models.PrivacySettings{UserId: userId}
+	query := `SELECT birth_date, city, biography, searchable FROM privacy_settings WHERE user_id = $1`
+	err = db.QueryRowContext(ctx, query, userId).Scan(
+		&settings.Birthdate,
+		&settings.City,
+		&settings.Biography,
+		&settings.Searchable,
+	)
+
+	if err == sql.ErrNoRows {
+		return models.DefaultPrivacySettings(userId), nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Не удалось получить настройки приватности: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// Настройки приватности для набора пользователей одним запросом
+func (repository *privacyRepository) GetByUserIds(ctx context.Context, userIds []uuid.UUID) (map[uuid.UUID]*models.PrivacySettings, error) {
+	result := make(map[uuid.UUID]*models.PrivacySettings, len(userIds))
+	for _, userId := range userIds {
+		result[userId] = models.DefaultPrivacySettings(userId)
+	}
+
+	if len(userIds) == 0 {
+		return result, nil
+	}
+
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT user_id, birth_date, city, biography, searchable FROM privacy_settings WHERE user_id = ANY($1::uuid[])`
+	rows, err := db.QueryContext(ctx, query, uuidArray(userIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var settings models.PrivacySettings
+		err := rows.Scan(&settings.UserId, &settings.Birthdate, &settings.City, &settings.Biography, &settings.Searchable)
+		if err != nil {
+			return nil, err
+		}
+		result[settings.UserId] = &settings
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (repository *privacyRepository) Save(ctx context.Context, settings *models.PrivacySettings) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO privacy_settings (user_id, birth_date, city, biography, searchable) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE SET birth_date = EXCLUDED.birth_date, city = EXCLUDED.city,
+		biography = EXCLUDED.biography, searchable = EXCLUDED.searchable, updated_at = CURRENT_TIMESTAMP`
+
+	_, err = db.ExecContext(ctx, query,
+		settings.UserId,
+		settings.Birthdate,
+		settings.City,
+		settings.Biography,
+		settings.Searchable,
+	)
+	if err != nil {
+		return fmt.Errorf("Не удалось сохранить настройки приватности: %w", err)
+	}
+
+	return nil
+}
+
+// Массив идентификаторов для условий вида "= ANY($1::uuid[])"
+func uuidArray(ids []uuid.UUID) interface{} {
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = id.String()
+	}
+
+	return pq.Array(values)
+}
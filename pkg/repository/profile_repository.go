@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"social-network/pkg/database"
 	"social-network/pkg/models"
@@ -15,9 +16,15 @@ type ProfileRepository interface {
 	Create(ctx context.Context, profile *models.Profile) error
 	GetById(ctx context.Context, id uuid.UUID) (*models.Profile, error)
 	GetByUserId(ctx context.Context, userId uuid.UUID) (*models.Profile, error)
-	SearchProfiles(ctx context.Context, firstName, lastName string, limit, offset int) ([]*models.Profile, error)
+	GetByUserIds(ctx context.Context, userIds []uuid.UUID) ([]*models.Profile, error)
+	SearchProfiles(ctx context.Context, viewerId uuid.UUID, firstName, lastName string, limit, offset int) ([]*models.Profile, error)
+	Update(ctx context.Context, profile *models.Profile, version time.Time) error
+	UpdateAvatar(ctx context.Context, userId uuid.UUID, avatar string) error
 }
 
+// Анкета была изменена после того, как клиент получил версию version
+var ErrProfileVersionConflict = errors.New("Анкета была изменена, обновите данные и повторите попытку")
+
 type profileRepository struct {
 	routerDB *database.ReplicationRouter
 }
@@ -64,7 +71,8 @@ func (repository *profileRepository) GetById(ctx context.Context, id uuid.UUID)
 		return nil, err
 	}
 
-	query := `select id, user_id, first_name, last_name, birth_date, gender, biography, city, created_at from profiles where id = $1`
+	query := `select p.id, p.user_id, COALESCE(u.username, ''), p.first_name, p.last_name, p.birth_date, p.gender, p.biography, p.city, COALESCE(p.avatar, ''), p.created_at, p.updated_at
+		from profiles p JOIN users u ON u.id = p.user_id where p.id = $1`
 
 	var (
 		profile   models.Profile
@@ -74,13 +82,16 @@ func (repository *profileRepository) GetById(ctx context.Context, id uuid.UUID)
 	err = db.QueryRowContext(ctx, query, id).Scan(
 		&profile.Id,
 		&profile.UserId,
+		&profile.Username,
 		&profile.FirstName,
 		&profile.LastName,
 		&profile.Birthdate,
 		&profile.Gender,
 		&profile.Biography,
 		&profile.City,
+		&profile.Avatar,
 		&createdAt,
+		&profile.UpdatedAt,
 	)
 
 	if err != nil {
@@ -98,7 +109,8 @@ func (repository *profileRepository) GetByUserId(ctx context.Context, userId uui
 	if err != nil {
 		return nil, err
 	}
-	query := `select id, user_id, first_name, last_name, birth_date, gender, biography, city, created_at from profiles where user_id = $1`
+	query := `select p.id, p.user_id, COALESCE(u.username, ''), p.first_name, p.last_name, p.birth_date, p.gender, p.biography, p.city, COALESCE(p.avatar, ''), p.created_at, p.updated_at
+		from profiles p JOIN users u ON u.id = p.user_id where p.user_id = $1`
 
 	var (
 		profile   models.Profile
@@ -108,13 +120,16 @@ func (repository *profileRepository) GetByUserId(ctx context.Context, userId uui
 	err = db.QueryRowContext(ctx, query, userId).Scan(
 		&profile.Id,
 		&profile.UserId,
+		&profile.Username,
 		&profile.FirstName,
 		&profile.LastName,
 		&profile.Birthdate,
 		&profile.Gender,
 		&profile.Biography,
 		&profile.City,
+		&profile.Avatar,
 		&createdAt,
+		&profile.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -132,7 +147,58 @@ func (repository *profileRepository) GetByUserId(ctx context.Context, userId uui
 	return &profile, nil
 }
 
-func (repository *profileRepository) SearchProfiles(ctx context.Context, firstName, lastName string, limit, offset int) ([]*models.Profile, error) {
+// Анкеты нескольких пользователей одним запросом; отсутствующие анкеты пропускаются
+func (repository *profileRepository) GetByUserIds(ctx context.Context, userIds []uuid.UUID) ([]*models.Profile, error) {
+	if len(userIds) == 0 {
+		return nil, nil
+	}
+
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `select p.id, p.user_id, COALESCE(u.username, ''), p.first_name, p.last_name, p.birth_date, p.gender, p.biography, p.city, COALESCE(p.avatar, ''), p.created_at, p.updated_at
+		from profiles p JOIN users u ON u.id = p.user_id where p.user_id = ANY($1::uuid[])`
+	rows, err := db.QueryContext(ctx, query, uuidArray(userIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var profiles []*models.Profile
+	for rows.Next() {
+		var profile models.Profile
+		err := rows.Scan(
+			&profile.Id,
+			&profile.UserId,
+			&profile.Username,
+			&profile.FirstName,
+			&profile.LastName,
+			&profile.Birthdate,
+			&profile.Gender,
+			&profile.Biography,
+			&profile.City,
+			&profile.Avatar,
+			&profile.CreatedAt,
+			&profile.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, &profile)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+// Поиск по началу фамилии и имени. Заблокированные пользователи не ищутся,
+// теневые находят только сами себя
+func (repository *profileRepository) SearchProfiles(ctx context.Context, viewerId uuid.UUID, firstName, lastName string, limit, offset int) ([]*models.Profile, error) {
 	db, err := repository.routerDB.GetDatabase(ctx)
 	if err != nil {
 		return nil, err
@@ -141,11 +207,18 @@ func (repository *profileRepository) SearchProfiles(ctx context.Context, firstNa
 	firstNameForQuery := firstName + "%"
 	lastNameForQuery := lastName + "%"
 
-	query := `SELECT id, user_id, last_name, first_name, birth_date, gender, biography, city, created_at FROM profiles 
-		WHERE last_name LIKE $1 and first_name LIKE $2 ORDER BY id LIMIT 10;
+	query := `SELECT p.id, p.user_id, COALESCE(u.username, ''), p.last_name, p.first_name, p.birth_date, p.gender, p.biography, p.city, COALESCE(p.avatar, ''), p.created_at FROM profiles p
+		JOIN users u ON u.id = p.user_id
+		LEFT JOIN privacy_settings ps ON ps.user_id = p.user_id
+		LEFT JOIN moderation_actions ma ON ma.id = u.moderation_action_id
+		WHERE p.last_name LIKE $1 and p.first_name LIKE $2 AND COALESCE(ps.searchable, true)
+			AND (ma.id IS NULL OR ma.state = $3 OR ma.expires_at <= $4
+				OR (ma.state = $5 AND u.id = $6))
+		ORDER BY p.id LIMIT 10;
 		`
 
-	rows, err := db.QueryContext(ctx, query, firstNameForQuery, lastNameForQuery)
+	rows, err := db.QueryContext(ctx, query, firstNameForQuery, lastNameForQuery,
+		models.ModerationActive, time.Now().UTC(), models.ModerationShadowBanned, viewerId)
 	if err != nil {
 		return nil, err
 	}
@@ -159,12 +232,14 @@ func (repository *profileRepository) SearchProfiles(ctx context.Context, firstNa
 		err := rows.Scan(
 			&profile.Id,
 			&profile.UserId,
+			&profile.Username,
 			&profile.FirstName,
 			&profile.LastName,
 			&profile.Birthdate,
 			&profile.Gender,
 			&profile.Biography,
 			&profile.City,
+			&profile.Avatar,
 			&createdAt,
 		)
 		if err != nil {
@@ -179,3 +254,59 @@ func (repository *profileRepository) SearchProfiles(ctx context.Context, firstNa
 
 	return profiles, nil
 }
+
+// Обновление анкеты с проверкой версии (updated_at), полученной клиентом
+func (repository *profileRepository) Update(ctx context.Context, profile *models.Profile, version time.Time) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE profiles SET first_name = $1, last_name = $2, birth_date = $3, gender = $4, biography = $5, city = $6,
+		updated_at = GREATEST(clock_timestamp()::timestamp, updated_at + INTERVAL '1 microsecond')
+		WHERE user_id = $7 AND updated_at = $8 RETURNING updated_at`
+
+	err = db.QueryRowContext(ctx, query,
+		profile.FirstName,
+		profile.LastName,
+		profile.Birthdate,
+		profile.Gender,
+		profile.Biography,
+		profile.City,
+		profile.UserId,
+		version,
+	).Scan(&profile.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return ErrProfileVersionConflict
+	}
+
+	if err != nil {
+		return fmt.Errorf("Не удалось обновить анкету пользователя: %w", err)
+	}
+
+	return nil
+}
+
+// Установка (или сброс при пустом значении) ключа аватара
+func (repository *profileRepository) UpdateAvatar(ctx context.Context, userId uuid.UUID, avatar string) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE profiles SET avatar = NULLIF($1, ''),
+		updated_at = GREATEST(clock_timestamp()::timestamp, updated_at + INTERVAL '1 microsecond')
+		WHERE user_id = $2`
+
+	result, err := db.ExecContext(ctx, query, avatar, userId)
+	if err != nil {
+		return fmt.Errorf("Не удалось обновить аватар: %w", err)
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("Анкета не найдена")
+	}
+
+	return nil
+}
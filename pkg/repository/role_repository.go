@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"social-network/pkg/database"
+
+	"github.com/google/uuid"
+)
+
+type RoleRepository interface {
+	GetByUserId(ctx context.Context, userId uuid.UUID) ([]string, error)
+	Grant(ctx context.Context, userId uuid.UUID, role string, grantedBy uuid.UUID) (bool, error)
+	Revoke(ctx context.Context, userId uuid.UUID, role string) (bool, error)
+}
+
+type roleRepository struct {
+	routerDB *database.ReplicationRouter
+}
+
+func InitRoleRepository(routerDB *database.ReplicationRouter) RoleRepository {
+	return &roleRepository{routerDB: routerDB}
+}
+
+func (repository *roleRepository) GetByUserId(ctx context.Context, userId uuid.UUID) ([]string, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role`
+	rows, err := db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		if err = rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// Назначение роли; false, если роль уже была назначена
+func (repository *roleRepository) Grant(ctx context.Context, userId uuid.UUID, role string, grantedBy uuid.UUID) (bool, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	query := `INSERT INTO user_roles (user_id, role, granted_by) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+	result, err := db.ExecContext(ctx, query, userId, role, nullUUID(grantedBy))
+	if err != nil {
+		return false, err
+	}
+
+	rows, _ := result.RowsAffected()
+
+	return rows > 0, nil
+}
+
+// Снятие роли; false, если роли не было
+func (repository *roleRepository) Revoke(ctx context.Context, userId uuid.UUID, role string) (bool, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	query := `DELETE FROM user_roles WHERE user_id = $1 AND role = $2`
+	result, err := db.ExecContext(ctx, query, userId, role)
+	if err != nil {
+		return false, err
+	}
+
+	rows, _ := result.RowsAffected()
+
+	return rows > 0, nil
+}
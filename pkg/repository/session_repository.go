@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"social-network/pkg/database"
+	"social-network/pkg/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Сессия отозвана или удалена
+var ErrSessionEnded = errors.New("Сессия завершена")
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *models.Session) error
+	GetActiveByUserId(ctx context.Context, userId uuid.UUID) ([]*models.Session, error)
+	Revoke(ctx context.Context, userId, sessionId uuid.UUID) error
+	RevokeAll(ctx context.Context, userId, exceptSessionId uuid.UUID) ([]uuid.UUID, error)
+	Touch(ctx context.Context, sessionId uuid.UUID, ip string, at time.Time) error
+	Extend(ctx context.Context, sessionId uuid.UUID, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, sessionId uuid.UUID) (bool, error)
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+type sessionRepository struct {
+	routerDB *database.ReplicationRouter
+}
+
+func InitSessionRepository(routerDB *database.ReplicationRouter) SessionRepository {
+	return &sessionRepository{routerDB: routerDB}
+}
+
+func (repository *sessionRepository) Create(ctx context.Context, session *models.Session) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO sessions (id, user_id, user_agent, ip, created_at, last_seen_at, expires_at) VALUES ($1, $2, $3, $4, $5, $5, $6)`
+	_, err = db.ExecContext(ctx, query, session.Id, session.UserId, session.UserAgent, session.IP, session.CreatedAt, session.ExpiresAt)
+
+	return err
+}
+
+// Действующие сессии пользователя (не отозванные и с неистекшим токеном),
+// начиная с последней активной
+func (repository *sessionRepository) GetActiveByUserId(ctx context.Context, userId uuid.UUID) ([]*models.Session, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, user_id, user_agent, ip, created_at, last_seen_at, expires_at FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2 ORDER BY last_seen_at DESC`
+	rows, err := db.QueryContext(ctx, query, userId, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*models.Session{}
+	for rows.Next() {
+		var session models.Session
+		err = rows.Scan(&session.Id, &session.UserId, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (repository *sessionRepository) Revoke(ctx context.Context, userId, sessionId uuid.UUID) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE sessions SET revoked_at = $3 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	result, err := db.ExecContext(ctx, query, sessionId, userId, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("Сессия не найдена")
+	}
+
+	return nil
+}
+
+// Отзыв всех сессий пользователя, кроме exceptSessionId (uuid.Nil - отзыв всех).
+// Возвращает идентификаторы отозванных сессий
+func (repository *sessionRepository) RevokeAll(ctx context.Context, userId, exceptSessionId uuid.UUID) ([]uuid.UUID, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `UPDATE sessions SET revoked_at = $3 WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL RETURNING id`
+	rows, err := db.QueryContext(ctx, query, userId, exceptSessionId, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// Обновление времени последней активности и IP-адреса сессии
+func (repository *sessionRepository) Touch(ctx context.Context, sessionId uuid.UUID, ip string, at time.Time) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE sessions SET last_seen_at = $2, ip = $3 WHERE id = $1 AND revoked_at IS NULL`
+	_, err = db.ExecContext(ctx, query, sessionId, at, ip)
+
+	return err
+}
+
+// Продление сессии до expiresAt при выпуске нового токена
+func (repository *sessionRepository) Extend(ctx context.Context, sessionId uuid.UUID, expiresAt time.Time) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE sessions SET expires_at = $2 WHERE id = $1 AND revoked_at IS NULL`
+	result, err := db.ExecContext(ctx, query, sessionId, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrSessionEnded
+	}
+
+	return nil
+}
+
+// Отозвана ли сессия. Сессия, которой нет в БД (например, удаленного пользователя),
+// считается отозванной
+func (repository *sessionRepository) IsRevoked(ctx context.Context, sessionId uuid.UUID) (bool, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var revoked bool
+	query := `SELECT revoked_at IS NOT NULL FROM sessions WHERE id = $1`
+	err = db.QueryRowContext(ctx, query, sessionId).Scan(&revoked)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
+
+// Удаление сессий, токены которых истекли до before. Возвращает число удаленных сессий
+func (repository *sessionRepository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `DELETE FROM sessions WHERE expires_at <= $1`
+	result, err := db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
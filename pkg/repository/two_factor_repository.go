@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"social-network/pkg/database"
+	"social-network/pkg/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type TwoFactorRepository interface {
+	Get(ctx context.Context, userId uuid.UUID) (*models.TwoFactor, error)
+	SavePending(ctx context.Context, userId uuid.UUID, secret string) error
+	Enable(ctx context.Context, userId uuid.UUID, step int64, recoveryCodeHashes []string) error
+	UseStep(ctx context.Context, userId uuid.UUID, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userId uuid.UUID, codeHash string) (bool, error)
+	Delete(ctx context.Context, userId uuid.UUID) error
+}
+
+var ErrTwoFactorEnabled = errors.New("Двухфакторная аутентификация уже включена")
+
+type twoFactorRepository struct {
+	routerDB *database.ReplicationRouter
+}
+
+func InitTwoFactorRepository(routerDB *database.ReplicationRouter) TwoFactorRepository {
+	return &twoFactorRepository{routerDB: routerDB}
+}
+
+// Настройки двухфакторной аутентификации; nil, если пользователь ее не подключал
+func (repository *twoFactorRepository) Get(ctx context.Context, userId uuid.UUID) (*models.TwoFactor, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		twoFactor = models.TwoFactor{UserId: userId}
+		enabledAt sql.NullTime
+	)
+
+	query := `SELECT secret, last_used_step, enabled_at, created_at FROM two_factor WHERE user_id = $1`
+	err = db.QueryRowContext(ctx, query, userId).Scan(&twoFactor.Secret, &twoFactor.LastUsedStep, &enabledAt, &twoFactor.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledAt.Valid {
+		twoFactor.EnabledAt = &enabledAt.Time
+	}
+
+	return &twoFactor, nil
+}
+
+// Сохранение секрета неподтвержденного подключения (заменяет предыдущий).
+// Включенную двухфакторную аутентификацию перезаписать нельзя
+func (repository *twoFactorRepository) SavePending(ctx context.Context, userId uuid.UUID, secret string) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO two_factor (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0, created_at = CURRENT_TIMESTAMP
+		WHERE two_factor.enabled_at IS NULL`
+	result, err := db.ExecContext(ctx, query, userId, secret)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrTwoFactorEnabled
+	}
+
+	return nil
+}
+
+// Подтверждение подключения и сохранение новых кодов восстановления
+func (repository *twoFactorRepository) Enable(ctx context.Context, userId uuid.UUID, step int64, recoveryCodeHashes []string) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE two_factor SET enabled_at = $2, last_used_step = $3 WHERE user_id = $1 AND enabled_at IS NULL`
+	result, err := tx.ExecContext(ctx, query, userId, time.Now().UTC(), step)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrTwoFactorEnabled
+	}
+
+	query = `DELETE FROM two_factor_recovery_codes WHERE user_id = $1`
+	_, err = tx.ExecContext(ctx, query, userId)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO two_factor_recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+	for _, codeHash := range recoveryCodeHashes {
+		_, err = tx.ExecContext(ctx, query, userId, codeHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Фиксация использованного шага TOTP. Возвращает false, если код этого или более
+// позднего шага уже был использован (защита от повторного применения кода)
+func (repository *twoFactorRepository) UseStep(ctx context.Context, userId uuid.UUID, step int64) (bool, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	query := `UPDATE two_factor SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2`
+	result, err := db.ExecContext(ctx, query, userId, step)
+	if err != nil {
+		return false, err
+	}
+
+	rows, _ := result.RowsAffected()
+
+	return rows > 0, nil
+}
+
+// Погашение одноразового кода восстановления
+func (repository *twoFactorRepository) UseRecoveryCode(ctx context.Context, userId uuid.UUID, codeHash string) (bool, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	query := `UPDATE two_factor_recovery_codes SET used_at = $3 WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	result, err := db.ExecContext(ctx, query, userId, codeHash, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+
+	rows, _ := result.RowsAffected()
+
+	return rows > 0, nil
+}
+
+func (repository *twoFactorRepository) Delete(ctx context.Context, userId uuid.UUID) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM two_factor_recovery_codes WHERE user_id = $1`
+	_, err = tx.ExecContext(ctx, query, userId)
+	if err != nil {
+		return err
+	}
+
+	query = `DELETE FROM two_factor WHERE user_id = $1`
+	_, err = tx.ExecContext(ctx, query, userId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -2,19 +2,42 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"social-network/pkg/database"
 	"social-network/pkg/models"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type UserRepository interface {
 	Create(ctx context.Context, user *models.User, password string) error
 	GetUserById(ctx context.Context, userId uuid.UUID) (*models.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
+	IsUsernameAvailable(ctx context.Context, username string, userId uuid.UUID) (bool, error)
+	ChangeUsername(ctx context.Context, userId uuid.UUID, username string, redirectUntil time.Time) error
+	GetUsernameRedirect(ctx context.Context, username string) (uuid.UUID, error)
+	UpdatePassword(ctx context.Context, userId uuid.UUID, password string) error
+	RevokeTokens(ctx context.Context, userId uuid.UUID, at time.Time) error
+	GetTokensRevokedAt(ctx context.Context, userId uuid.UUID) (time.Time, error)
+	ScheduleDeletion(ctx context.Context, userId uuid.UUID, at time.Time) error
+	CancelDeletion(ctx context.Context, userId uuid.UUID) error
+	GetScheduledForDeletion(ctx context.Context, before time.Time, limit int) ([]uuid.UUID, error)
+	Delete(ctx context.Context, userId uuid.UUID, before time.Time, event *models.AccountDeletedEvent) (bool, error)
+	GetIdsAfter(ctx context.Context, after uuid.UUID, activeSince time.Time, limit int) ([]uuid.UUID, error)
+	CountActive(ctx context.Context, activeSince time.Time) (int, error)
 }
 
+var (
+	// Имя пользователя занято другим пользователем (или зарезервировано за ним для перенаправления)
+	ErrUsernameTaken = errors.New("Имя пользователя уже занято")
+	// Пользователя нет в БД; остальные ошибки чтения возвращаются как есть
+	ErrUserNotFound = errors.New("Анкета не найдена")
+)
+
 type userRepository struct {
 	routerDB *database.ReplicationRouter
 }
@@ -29,10 +52,14 @@ func (repository *userRepository) Create(ctx context.Context, user *models.User,
 		return err
 	}
 
-	query := `INSERT INTO users (id, password) VALUES ($1, $2) RETURNING created_at`
+	query := `INSERT INTO users (id, password, username) VALUES ($1, $2, NULLIF($3, '')) RETURNING created_at`
 
 	var createdAt string
-	err = db.QueryRowContext(ctx, query, user.Id, password).Scan(&createdAt)
+	err = db.QueryRowContext(ctx, query, user.Id, password, user.Username).Scan(&createdAt)
+
+	if isUniqueViolation(err) {
+		return ErrUsernameTaken
+	}
 
 	if err != nil {
 		return err
@@ -52,18 +79,346 @@ func (repository *userRepository) GetUserById(ctx context.Context, userId uuid.U
 	if err != nil {
 		return nil, err
 	}
-	query := `select id, password from users where id = $1`
+	query := `select id, password, COALESCE(username, ''), username_changed_at from users where id = $1`
+
+	return repository.scanUser(db.QueryRowContext(ctx, query, userId))
+}
+
+// Поиск пользователя по имени без учета регистра
+func (repository *userRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query := `select id, password, COALESCE(username, ''), username_changed_at from users where LOWER(username) = LOWER($1)`
+
+	return repository.scanUser(db.QueryRowContext(ctx, query, username))
+}
+
+// Свободно ли имя для пользователя userId: не занято другим и не зарезервировано за другим
+func (repository *userRepository) IsUsernameAvailable(ctx context.Context, username string, userId uuid.UUID) (bool, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var taken bool
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(username) = LOWER($1) AND id <> $2)
+		OR EXISTS(SELECT 1 FROM username_history WHERE username = LOWER($1) AND user_id <> $2 AND expires_at > CURRENT_TIMESTAMP)`
+	err = db.QueryRowContext(ctx, query, username, userId).Scan(&taken)
+	if err != nil {
+		return false, err
+	}
+
+	return !taken, nil
+}
+
+// Смена имени: прежнее имя резервируется за пользователем до redirectUntil для перенаправления
+func (repository *userRepository) ChangeUsername(ctx context.Context, userId uuid.UUID, username string, redirectUntil time.Time) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldUsername string
+	query := `SELECT COALESCE(username, '') FROM users WHERE id = $1 FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, userId).Scan(&oldUsername)
+	if err != nil {
+		return fmt.Errorf("Пользователь не найден")
+	}
+
+	if oldUsername != "" {
+		query = `INSERT INTO username_history (username, user_id, expires_at) VALUES (LOWER($1), $2, $3)
+			ON CONFLICT (username) DO UPDATE SET user_id = EXCLUDED.user_id, expires_at = EXCLUDED.expires_at`
+		_, err = tx.ExecContext(ctx, query, oldUsername, userId, redirectUntil)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Возврат к собственному прежнему имени снимает резерв
+	query = `DELETE FROM username_history WHERE username = LOWER($1)`
+	_, err = tx.ExecContext(ctx, query, username)
+	if err != nil {
+		return err
+	}
+
+	query = `UPDATE users SET username = $1, username_changed_at = CURRENT_TIMESTAMP WHERE id = $2`
+	_, err = tx.ExecContext(ctx, query, username, userId)
+	if isUniqueViolation(err) {
+		return ErrUsernameTaken
+	}
+	if err != nil {
+		return err
+	}
 
-	var user models.User
+	return tx.Commit()
+}
+
+// Пользователь, за которым зарезервировано прежнее имя username
+func (repository *userRepository) GetUsernameRedirect(ctx context.Context, username string) (uuid.UUID, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	var userId uuid.UUID
+	query := `SELECT user_id FROM username_history WHERE username = LOWER($1) AND expires_at > CURRENT_TIMESTAMP`
+	err = db.QueryRowContext(ctx, query, username).Scan(&userId)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrUserNotFound
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return userId, nil
+}
+
+func (repository *userRepository) UpdatePassword(ctx context.Context, userId uuid.UUID, password string) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE users SET password = $1 WHERE id = $2`
+	result, err := db.ExecContext(ctx, query, password, userId)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("Пользователь не найден")
+	}
+
+	return nil
+}
+
+// Отзыв всех токенов пользователя, выпущенных раньше момента at
+func (repository *userRepository) RevokeTokens(ctx context.Context, userId uuid.UUID, at time.Time) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE users SET tokens_revoked_at = $1 WHERE id = $2`
+	_, err = db.ExecContext(ctx, query, at.UTC(), userId)
+
+	return err
+}
+
+// Момент отзыва токенов пользователя; нулевое время, если токены не отзывались
+func (repository *userRepository) GetTokensRevokedAt(ctx context.Context, userId uuid.UUID) (time.Time, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var revokedAt sql.NullTime
+	query := `SELECT tokens_revoked_at FROM users WHERE id = $1`
+	err = db.QueryRowContext(ctx, query, userId).Scan(&revokedAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return revokedAt.Time, nil
+}
+
+func (repository *userRepository) scanUser(row *sql.Row) (*models.User, error) {
+	var (
+		user      models.User
+		changedAt sql.NullTime
+	)
 
-	err = db.QueryRowContext(ctx, query, userId).Scan(
+	err := row.Scan(
 		&user.Id,
 		&user.Password,
+		&user.Username,
+		&changedAt,
 	)
 
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
 	if err != nil {
-		return nil, fmt.Errorf("Анкета не найдена")
+		return nil, err
 	}
 
+	user.UsernameChangedAt = changedAt.Time
+
 	return &user, nil
 }
+
+// Нарушение ограничения уникальности в PostgreSQL
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// Планирование удаления аккаунта на момент at
+func (repository *userRepository) ScheduleDeletion(ctx context.Context, userId uuid.UUID, at time.Time) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE users SET deletion_scheduled_at = $2 WHERE id = $1 AND deletion_scheduled_at IS NULL`
+	result, err := db.ExecContext(ctx, query, userId, at)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("Удаление аккаунта уже запланировано")
+	}
+
+	return nil
+}
+
+func (repository *userRepository) CancelDeletion(ctx context.Context, userId uuid.UUID) error {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE users SET deletion_scheduled_at = NULL WHERE id = $1 AND deletion_scheduled_at IS NOT NULL`
+	result, err := db.ExecContext(ctx, query, userId)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("Удаление аккаунта не запланировано")
+	}
+
+	return nil
+}
+
+// Пользователи, срок удаления которых наступил до before
+func (repository *userRepository) GetScheduledForDeletion(ctx context.Context, before time.Time, limit int) ([]uuid.UUID, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id FROM users WHERE deletion_scheduled_at <= $1 ORDER BY deletion_scheduled_at LIMIT $2`
+	rows, err := db.QueryContext(ctx, query, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIds []uuid.UUID
+	for rows.Next() {
+		var userId uuid.UUID
+		if err = rows.Scan(&userId); err != nil {
+			return nil, err
+		}
+		userIds = append(userIds, userId)
+	}
+
+	return userIds, rows.Err()
+}
+
+// Удаление пользователя, если срок удаления наступил и не был отменен.
+// Связанные данные удаляются каскадно внешними ключами, в той же транзакции
+// в outbox записывается событие account_deleted
+func (repository *userRepository) Delete(ctx context.Context, userId uuid.UUID, before time.Time, event *models.AccountDeletedEvent) (bool, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM users WHERE id = $1 AND deletion_scheduled_at <= $2`
+	result, err := tx.ExecContext(ctx, query, userId, before)
+	if err != nil {
+		return false, err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return false, nil
+	}
+
+	// Кеш лент очищается обработчиком события, поэтому очистка не теряется,
+	// даже если Redis недоступен в момент удаления
+	if err = insertOutboxEvent(ctx, tx, models.EventAccountDeleted, event); err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Пользователи с id больше after по возрастанию id; uuid.Nil - с начала. Если задан
+// activeSince, то только пользователи с сессиями, активными начиная с этого момента
+func (repository *userRepository) GetIdsAfter(ctx context.Context, after uuid.UUID, activeSince time.Time, limit int) ([]uuid.UUID, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id FROM users u
+		WHERE ($1::uuid IS NULL OR u.id > $1::uuid)
+			AND ($2::timestamp IS NULL OR EXISTS (
+				SELECT 1 FROM sessions s
+				WHERE s.user_id = u.id AND s.revoked_at IS NULL AND s.last_seen_at >= $2::timestamp))
+		ORDER BY u.id LIMIT $3`
+	rows, err := db.QueryContext(ctx, query, nullUUID(after), nullTime(activeSince), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIds []uuid.UUID
+	for rows.Next() {
+		var userId uuid.UUID
+		if err = rows.Scan(&userId); err != nil {
+			return nil, err
+		}
+		userIds = append(userIds, userId)
+	}
+
+	return userIds, rows.Err()
+}
+
+// Число пользователей, активных начиная с activeSince; нулевое время - всех пользователей
+func (repository *userRepository) CountActive(ctx context.Context, activeSince time.Time) (int, error) {
+	db, err := repository.routerDB.GetDatabase(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `SELECT COUNT(*) FROM users u
+		WHERE $1::timestamp IS NULL OR EXISTS (
+			SELECT 1 FROM sessions s
+			WHERE s.user_id = u.id AND s.revoked_at IS NULL AND s.last_seen_at >= $1::timestamp)`
+	var count int
+	err = db.QueryRowContext(ctx, query, nullTime(activeSince)).Scan(&count)
+
+	return count, err
+}
+
+// Нулевое время сохраняем как NULL
+func nullTime(value time.Time) interface{} {
+	if value.IsZero() {
+		return nil
+	}
+
+	return value.UTC()
+}
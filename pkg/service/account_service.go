@@ -0,0 +1,347 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"social-network/internal/cache"
+	"social-network/internal/config"
+	"social-network/pkg/database"
+	"social-network/pkg/models"
+	"social-network/pkg/repository"
+	"social-network/pkg/utils"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// Размер страницы при выгрузке постов, комментариев и реакций
+	exportBatch = 500
+	// Количество аккаунтов, удаляемых за один проход
+	deletionBatch = 100
+)
+
+type AccountService interface {
+	Export(ctx context.Context, userId uuid.UUID, writer io.Writer) error
+	ScheduleDeletion(ctx context.Context, userId uuid.UUID, password, ip string) (time.Time, error)
+	CancelDeletion(ctx context.Context, userId uuid.UUID, ip string) error
+	DeleteDueAccounts(ctx context.Context) (int, error)
+	RunDeletionWorker(ctx context.Context)
+}
+
+type accountService struct {
+	config               *config.Config
+	userRepository       repository.UserRepository
+	profileRepository    repository.ProfileRepository
+	privacyRepository    repository.PrivacyRepository
+	friendShipRepository repository.FriendShipRepository
+	postRepository       repository.PostRepository
+	engagementRepository repository.EngagementRepository
+	identityRepository   repository.IdentityRepository
+	sessionRepository    repository.SessionRepository
+	auditRepository      repository.AuditRepository
+	avatarService        AvatarService
+	profileCache         *cache.ProfileCache
+}
+
+// Инициализация сервиса выгрузки данных и удаления аккаунта
+func InitAccountService(config *config.Config, userRepository repository.UserRepository, profileRepository repository.ProfileRepository, privacyRepository repository.PrivacyRepository, friendShipRepository repository.FriendShipRepository, postRepository repository.PostRepository, engagementRepository repository.EngagementRepository, identityRepository repository.IdentityRepository, sessionRepository repository.SessionRepository, auditRepository repository.AuditRepository, avatarService AvatarService, profileCache *cache.ProfileCache) AccountService {
+	return &accountService{
+		config:               config,
+		userRepository:       userRepository,
+		profileRepository:    profileRepository,
+		privacyRepository:    privacyRepository,
+		friendShipRepository: friendShipRepository,
+		postRepository:       postRepository,
+		engagementRepository: engagementRepository,
+		identityRepository:   identityRepository,
+		sessionRepository:    sessionRepository,
+		auditRepository:      auditRepository,
+		avatarService:        avatarService,
+		profileCache:         profileCache,
+	}
+}
+
+// Выгрузка персональных данных в zip-архив: по файлу JSON Lines на каждый вид данных
+// и оригинал аватара
+func (service *accountService) Export(ctx context.Context, userId uuid.UUID, writer io.Writer) error {
+	ctx = database.WithMaster(ctx)
+	profile, err := service.profileRepository.GetByUserId(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	privacy, err := service.privacyRepository.GetByUserId(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	friendShips, err := service.friendShipRepository.GetListByUserId(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	identities, err := service.identityRepository.GetListByUserId(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := service.sessionRepository.GetActiveByUserId(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(writer)
+
+	err = writeJSONLines(archive, "profile.jsonl", []*models.Profile{profile})
+	if err != nil {
+		return err
+	}
+
+	err = writeJSONLines(archive, "privacy.jsonl", []*models.PrivacySettings{privacy})
+	if err != nil {
+		return err
+	}
+
+	err = writeJSONLines(archive, "friendships.jsonl", friendShips)
+	if err != nil {
+		return err
+	}
+
+	err = writeJSONLines(archive, "identities.jsonl", identities)
+	if err != nil {
+		return err
+	}
+
+	err = writeJSONLines(archive, "sessions.jsonl", sessions)
+	if err != nil {
+		return err
+	}
+
+	err = writeJSONLinesPages(archive, "posts.jsonl", func(limit, offset int) ([]*models.Post, error) {
+		return service.postRepository.GetListByUserId(ctx, userId, limit, offset)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeJSONLinesPages(archive, "comments.jsonl", func(limit, offset int) ([]*models.Comment, error) {
+		return service.engagementRepository.GetCommentsByUserId(ctx, userId, limit, offset)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeJSONLinesPages(archive, "reactions.jsonl", func(limit, offset int) ([]*models.Reaction, error) {
+		return service.engagementRepository.GetReactionsByUserId(ctx, userId, limit, offset)
+	})
+	if err != nil {
+		return err
+	}
+
+	if profile.Avatar != "" {
+		err = service.exportAvatar(ctx, archive, profile.Avatar)
+		if err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// Планирование удаления аккаунта после повторной проверки пароля. До наступления
+// срока удаление можно отменить
+func (service *accountService) ScheduleDeletion(ctx context.Context, userId uuid.UUID, password, ip string) (time.Time, error) {
+	ctx = database.WithMaster(ctx)
+	user, err := service.userRepository.GetUserById(ctx, userId)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if !utils.CheckPassword(password, user.Password) {
+		return time.Time{}, fmt.Errorf("Пароль указан неверно")
+	}
+
+	deletionAt := time.Now().UTC().Add(service.config.AccountConfig.DeletionGracePeriod)
+	err = service.userRepository.ScheduleDeletion(ctx, userId, deletionAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	service.audit(ctx, models.AuditDeletionScheduled, userId, ip, map[string]interface{}{"deletion_at": deletionAt})
+
+	return deletionAt, nil
+}
+
+func (service *accountService) CancelDeletion(ctx context.Context, userId uuid.UUID, ip string) error {
+	ctx = database.WithMaster(ctx)
+	err := service.userRepository.CancelDeletion(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	service.audit(ctx, models.AuditDeletionCanceled, userId, ip, nil)
+
+	return nil
+}
+
+// Удаление аккаунтов, срок удаления которых наступил. Возвращает количество удаленных
+func (service *accountService) DeleteDueAccounts(ctx context.Context) (int, error) {
+	ctx = database.WithMaster(ctx)
+	userIds, err := service.userRepository.GetScheduledForDeletion(ctx, time.Now().UTC(), deletionBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, userId := range userIds {
+		ok, err := service.deleteAccount(ctx, userId)
+		if err != nil {
+			log.Printf("Не удалось удалить аккаунт %s: %v", userId, err)
+			continue
+		}
+		if ok {
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// Периодическое удаление аккаунтов до отмены контекста
+func (service *accountService) RunDeletionWorker(ctx context.Context) {
+	ticker := time.NewTicker(service.config.AccountConfig.DeletionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := service.DeleteDueAccounts(ctx)
+		if err != nil {
+			log.Printf("Ошибка удаления аккаунтов: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Удалено аккаунтов: %d", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Удаление аккаунта: строки в Postgres удаляются каскадно, ленту и посты пользователя,
+// а также его посты в лентах друзей удаляет из Redis обработчик события account_deleted
+func (service *accountService) deleteAccount(ctx context.Context, userId uuid.UUID) (bool, error) {
+	// Друзья и посты нужны для очистки кеша, после удаления их уже не получить
+	friendIds, err := service.friendShipRepository.GetFriendsByUserId(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+
+	postIds, err := service.postRepository.GetIdsByUserId(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+
+	event := &models.AccountDeletedEvent{UserId: userId, PostIds: postIds, FriendIds: friendIds}
+	deleted, err := service.userRepository.Delete(ctx, userId, time.Now().UTC(), event)
+	if err != nil || !deleted {
+		return false, err
+	}
+
+	// Аватар удаляется только после удаления строки: если удаление отменено
+	// в последний момент, аккаунт остается с аватаром
+	err = service.avatarService.Delete(ctx, userId)
+	if err != nil {
+		log.Printf("Не удалось удалить аватар пользователя %s: %v", userId, err)
+	}
+
+	_ = service.profileCache.Invalidate(userId)
+	_ = cache.SetTokensRevokedAt(userId.String(), time.Now(), utils.TokenTTL)
+
+	service.audit(ctx, models.AuditAccountDeleted, userId, "", map[string]interface{}{
+		"posts":   len(postIds),
+		"friends": len(friendIds),
+	})
+
+	return true, nil
+}
+
+func (service *accountService) exportAvatar(ctx context.Context, archive *zip.Writer, avatarKey string) error {
+	reader, _, err := service.avatarService.Open(ctx, avatarKey)
+	if err != nil {
+		log.Printf("Не удалось прочитать аватар %s для выгрузки: %v", avatarKey, err)
+		return nil
+	}
+	defer reader.Close()
+
+	file, err := archive.Create("avatar" + path.Ext(avatarKey))
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, reader)
+
+	return err
+}
+
+func (service *accountService) audit(ctx context.Context, event string, userId uuid.UUID, ip string, details map[string]interface{}) {
+	err := service.auditRepository.Add(ctx, &models.AuditEvent{
+		Event:   event,
+		UserId:  userId,
+		ActorId: userId,
+		IP:      ip,
+		Details: details,
+	})
+	if err != nil {
+		log.Printf("Не удалось записать событие %s в журнал аудита: %v", event, err)
+	}
+}
+
+// Запись элементов в файл архива, по одному JSON-объекту на строку
+func writeJSONLines[T any](archive *zip.Writer, name string, items []T) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	for _, item := range items {
+		if err = encoder.Encode(item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Запись в файл архива всех элементов, загружаемых страницами по exportBatch
+func writeJSONLinesPages[T any](archive *zip.Writer, name string, load func(limit, offset int) ([]T, error)) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	for offset := 0; ; offset += exportBatch {
+		items, err := load(exportBatch, offset)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			if err = encoder.Encode(item); err != nil {
+				return err
+			}
+		}
+
+		if len(items) < exportBatch {
+			return nil
+		}
+	}
+}
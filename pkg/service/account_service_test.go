@@ -0,0 +1,208 @@
+package service
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"social-network/internal/cache"
+	"social-network/internal/config"
+	"social-network/pkg/models"
+	"social-network/pkg/repository"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+)
+
+// Комментарии и реакции в памяти вместо таблиц post_comments и post_reactions
+type memoryEngagementRepository struct {
+	repository.EngagementRepository
+	comments  []*models.Comment
+	reactions []*models.Reaction
+}
+
+func (repository *memoryEngagementRepository) GetCommentsByUserId(ctx context.Context, userId uuid.UUID, limit, offset int) ([]*models.Comment, error) {
+	var comments []*models.Comment
+	for _, comment := range repository.comments {
+		if comment.UserId == userId {
+			comments = append(comments, comment)
+		}
+	}
+
+	return memoryPage(comments, limit, offset), nil
+}
+
+func (repository *memoryEngagementRepository) GetReactionsByUserId(ctx context.Context, userId uuid.UUID, limit, offset int) ([]*models.Reaction, error) {
+	var reactions []*models.Reaction
+	for _, reaction := range repository.reactions {
+		if reaction.UserId == userId {
+			reactions = append(reactions, reaction)
+		}
+	}
+
+	return memoryPage(reactions, limit, offset), nil
+}
+
+func memoryPage[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return nil
+	}
+	items = items[offset:]
+	if len(items) > limit {
+		items = items[:limit]
+	}
+
+	return items
+}
+
+// Пользователь, удаление которого запланировано; deletable - удалится ли строка
+type memoryDeletionUserRepository struct {
+	repository.UserRepository
+	userId    uuid.UUID
+	deletable bool
+}
+
+func (repository *memoryDeletionUserRepository) GetScheduledForDeletion(ctx context.Context, before time.Time, limit int) ([]uuid.UUID, error) {
+	return []uuid.UUID{repository.userId}, nil
+}
+
+func (repository *memoryDeletionUserRepository) Delete(ctx context.Context, userId uuid.UUID, before time.Time, event *models.AccountDeletedEvent) (bool, error) {
+	return repository.deletable, nil
+}
+
+type emptyProfileRepository struct {
+	repository.ProfileRepository
+}
+
+func (repository *emptyProfileRepository) GetByUserId(ctx context.Context, userId uuid.UUID) (*models.Profile, error) {
+	return &models.Profile{}, nil
+}
+
+type emptyPrivacyRepository struct {
+	repository.PrivacyRepository
+}
+
+func (repository *emptyPrivacyRepository) GetByUserId(ctx context.Context, userId uuid.UUID) (*models.PrivacySettings, error) {
+	return &models.PrivacySettings{}, nil
+}
+
+type emptyIdentityRepository struct {
+	repository.IdentityRepository
+}
+
+func (repository *emptyIdentityRepository) GetListByUserId(ctx context.Context, userId uuid.UUID) ([]*models.LoginIdentity, error) {
+	return nil, nil
+}
+
+type emptySessionRepository struct {
+	repository.SessionRepository
+}
+
+func (repository *emptySessionRepository) GetActiveByUserId(ctx context.Context, userId uuid.UUID) ([]*models.Session, error) {
+	return nil, nil
+}
+
+type discardAuditRepository struct{}
+
+func (repository *discardAuditRepository) Add(ctx context.Context, event *models.AuditEvent) error {
+	return nil
+}
+
+// Аватары в памяти: запоминаются только удаления
+type memoryAvatarService struct {
+	AvatarService
+	deleted map[uuid.UUID]bool
+}
+
+func (service *memoryAvatarService) Delete(ctx context.Context, userId uuid.UUID) error {
+	service.deleted[userId] = true
+	return nil
+}
+
+// Выгрузка содержит все комментарии и реакции пользователя, в том числе
+// больше одной страницы
+func TestExportIncludesCommentsAndReactions(t *testing.T) {
+	userId, otherId := uuid.New(), uuid.New()
+	engagementRepository := &memoryEngagementRepository{}
+	for i := 0; i < exportBatch+1; i++ {
+		engagementRepository.comments = append(engagementRepository.comments, &models.Comment{Id: uuid.New(), PostId: uuid.New(), UserId: userId, Content: "комментарий"})
+	}
+	engagementRepository.comments = append(engagementRepository.comments, &models.Comment{Id: uuid.New(), PostId: uuid.New(), UserId: otherId, Content: "чужой"})
+	for i := 0; i < 3; i++ {
+		engagementRepository.reactions = append(engagementRepository.reactions, &models.Reaction{PostId: uuid.New(), UserId: userId})
+	}
+	engagementRepository.reactions = append(engagementRepository.reactions, &models.Reaction{PostId: uuid.New(), UserId: otherId})
+
+	accountService := InitAccountService(&config.Config{}, nil, &emptyProfileRepository{}, &emptyPrivacyRepository{},
+		&memoryFriendShipRepository{}, &memoryPostRepository{posts: make(map[uuid.UUID]*models.Post)}, engagementRepository,
+		&emptyIdentityRepository{}, &emptySessionRepository{}, &discardAuditRepository{}, &memoryAvatarService{}, nil)
+
+	var buffer bytes.Buffer
+	if err := accountService.Export(context.Background(), userId, &buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := make(map[string]int)
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			lines[file.Name]++
+		}
+		_ = reader.Close()
+	}
+
+	if lines["comments.jsonl"] != exportBatch+1 {
+		t.Errorf("в выгрузке %d комментариев вместо %d", lines["comments.jsonl"], exportBatch+1)
+	}
+	if lines["reactions.jsonl"] != 3 {
+		t.Errorf("в выгрузке %d реакций вместо 3", lines["reactions.jsonl"])
+	}
+}
+
+// Аватар удаляется только вместе с аккаунтом
+func TestDeleteAccountRemovesAvatarOnlyAfterDeletion(t *testing.T) {
+	server := miniredis.RunT(t)
+	port, err := strconv.Atoi(server.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cnf := &config.Config{RedisConfig: config.RedisConfig{RedisHost: server.Host(), RedisPort: port}}
+	if err = cache.InitRedis(cnf); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = cache.Close() })
+
+	for _, deletable := range []bool{false, true} {
+		userId := uuid.New()
+		avatarService := &memoryAvatarService{deleted: make(map[uuid.UUID]bool)}
+		accountService := InitAccountService(cnf, &memoryDeletionUserRepository{userId: userId, deletable: deletable}, nil, nil,
+			&memoryFriendShipRepository{}, &memoryPostRepository{posts: make(map[uuid.UUID]*models.Post)}, nil,
+			nil, nil, &discardAuditRepository{}, avatarService, cache.NewProfileCache(time.Minute, nil))
+
+		deleted, err := accountService.DeleteDueAccounts(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if deletable && (deleted != 1 || !avatarService.deleted[userId]) {
+			t.Errorf("аккаунт удален: %d, аватар удален: %v", deleted, avatarService.deleted[userId])
+		}
+		if !deletable && (deleted != 0 || avatarService.deleted[userId]) {
+			t.Errorf("удаление отменено, но удалено аккаунтов: %d, аватар удален: %v", deleted, avatarService.deleted[userId])
+		}
+	}
+}
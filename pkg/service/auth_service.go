@@ -2,33 +2,84 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"social-network/internal/config"
+	"social-network/internal/notify"
+	"social-network/internal/security"
 	"social-network/pkg/database"
 	"social-network/pkg/models"
 	"social-network/pkg/repository"
 	"social-network/pkg/utils"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// Одна ошибка для неизвестного логина и неверного пароля, чтобы по ответу нельзя
+// было определить, зарегистрирован ли пользователь
+var ErrInvalidCredentials = errors.New("Логин или пароль указан неверно")
+
 type AuthService interface {
 	UserRegister(ctx context.Context, request *models.RegisterRequest) (*models.Profile, error)
-	Login(ctx context.Context, userId, password string) (*models.AuthResponse, error)
+	Login(ctx context.Context, login, password, ip, userAgent string) (*models.AuthResponse, error)
+	CompleteTwoFactorLogin(ctx context.Context, challengeToken, code, ip, userAgent string) (*models.AuthResponse, error)
+	ChangePassword(ctx context.Context, userId, sessionId uuid.UUID, oldPassword, newPassword string) (*models.AuthResponse, error)
+	RefreshToken(ctx context.Context, userId, sessionId uuid.UUID) (*models.AuthResponse, error)
+	RequestPasswordReset(ctx context.Context, login, ip string) error
+	ResetPassword(ctx context.Context, token, newPassword, ip string) error
 }
 
+// Срок действия токена сброса пароля
+const passwordResetTTL = 30 * time.Minute
+
+// Лимиты запросов сброса пароля: с одного IP-адреса и на один логин
+const (
+	passwordForgotIPLimit    = 10
+	passwordForgotLoginLimit = 3
+	passwordForgotWindow     = time.Hour
+)
+
 type authService struct {
-	config            *config.Config
-	userRepository    repository.UserRepository
-	profileRepository repository.ProfileRepository
+	config                  *config.Config
+	userRepository          repository.UserRepository
+	profileRepository       repository.ProfileRepository
+	identityRepository      repository.IdentityRepository
+	passwordResetRepository repository.PasswordResetRepository
+	auditRepository         repository.AuditRepository
+	loginLimiter            *security.LoginLimiter
+	forgotIPLimiter         *security.RateLimiter
+	forgotLoginLimiter      *security.RateLimiter
+	notifier                notify.Notifier
+	twoFactorService        TwoFactorService
+	sessionService          SessionService
+	roleService             RoleService
+	moderationService       ModerationService
+	// Хеш для проверки пароля неизвестного пользователя: время ответа не должно
+	// отличаться от проверки настоящего пароля
+	dummyHashOnce sync.Once
+	dummyHash     string
 }
 
-func InitAuthService(config *config.Config, userRepository repository.UserRepository, profileRepository repository.ProfileRepository) AuthService {
+func InitAuthService(config *config.Config, userRepository repository.UserRepository, profileRepository repository.ProfileRepository, identityRepository repository.IdentityRepository, passwordResetRepository repository.PasswordResetRepository, auditRepository repository.AuditRepository, loginLimiter *security.LoginLimiter, notifier notify.Notifier, twoFactorService TwoFactorService, sessionService SessionService, roleService RoleService, moderationService ModerationService) AuthService {
 	return &authService{
-		config:            config,
-		userRepository:    userRepository,
-		profileRepository: profileRepository,
+		config:                  config,
+		userRepository:          userRepository,
+		profileRepository:       profileRepository,
+		identityRepository:      identityRepository,
+		passwordResetRepository: passwordResetRepository,
+		auditRepository:         auditRepository,
+		loginLimiter:            loginLimiter,
+		forgotIPLimiter:         security.NewRateLimiter("password_forgot_ip", passwordForgotIPLimit, passwordForgotWindow),
+		forgotLoginLimiter:      security.NewRateLimiter("password_forgot_login", passwordForgotLoginLimit, passwordForgotWindow),
+		notifier:                notifier,
+		twoFactorService:        twoFactorService,
+		sessionService:          sessionService,
+		roleService:             roleService,
+		moderationService:       moderationService,
 	}
 }
 
@@ -39,15 +90,31 @@ func (authService *authService) UserRegister(ctx context.Context, request *model
 		return nil, err
 	}
 
-	birthDate, err := time.Parse("2006-01-02", request.Birthdate)
+	birthDate, err := utils.ParseBirthdate(request.Birthdate)
 	if err != nil {
-		return nil, fmt.Errorf("Дата рождения указана некорректно")
+		return nil, err
 	}
 	user := models.User{
-		Id: uuid.New(),
+		Id:       uuid.New(),
+		Username: request.Username,
+	}
+
+	if user.Username != "" {
+		err = utils.ValidateUsername(user.Username)
+		if err != nil {
+			return nil, err
+		}
+
+		available, err := authService.userRepository.IsUsernameAvailable(ctx, user.Username, user.Id)
+		if err != nil {
+			return nil, err
+		}
+		if !available {
+			return nil, repository.ErrUsernameTaken
+		}
 	}
 
-	pass, err := utils.HashPassword(request.Password)
+	pass, err := utils.HashPassword(request.Password, authService.config)
 	if err != nil {
 		return nil, err
 	}
@@ -76,29 +143,388 @@ func (authService *authService) UserRegister(ctx context.Context, request *model
 	return &profile, nil
 }
 
-func (authService *authService) Login(ctx context.Context, userId, password string) (*models.AuthResponse, error) {
+// Вход по id пользователя, имени пользователя или подтвержденному email/телефону.
+// Неудачные попытки считаются по аккаунту и по IP-адресу; при превышении порога
+// вход временно блокируется до проверки пароля. При включенной двухфакторной
+// аутентификации вместо токена доступа возвращается промежуточный токен
+func (authService *authService) Login(ctx context.Context, login, password, ip, userAgent string) (*models.AuthResponse, error) {
 	ctx = database.WithReplica(ctx)
-	id, err := uuid.Parse(userId)
+
+	err := authService.loginLimiter.Check(ctx, security.ScopeIP, ip)
 	if err != nil {
-		return nil, fmt.Errorf("Пользователь не зарегистрирован")
+		return nil, err
 	}
 
-	user, err := authService.userRepository.GetUserById(ctx, id)
+	user, err := authService.findUserByLogin(ctx, login)
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) && !errors.Is(err, repository.ErrIdentityNotFound) {
+		return nil, err
+	}
+	if user == nil {
+		utils.CheckPassword(password, authService.dummyPasswordHash())
+		authService.registerLoginFailure(ctx, security.ScopeIP, ip, uuid.Nil, ip)
+		return nil, ErrInvalidCredentials
+	}
 
+	err = authService.loginLimiter.Check(ctx, security.ScopeAccount, user.Id.String())
 	if err != nil {
-		return nil, fmt.Errorf("Пользователь не зарегистрирован")
+		return nil, err
 	}
 
 	isValidPassword := utils.CheckPassword(password, user.Password)
 
 	if !isValidPassword {
-		return nil, fmt.Errorf("Логин или пароль указан неверно")
+		authService.registerLoginFailure(ctx, security.ScopeAccount, user.Id.String(), user.Id, ip)
+		authService.registerLoginFailure(ctx, security.ScopeIP, ip, user.Id, ip)
+		return nil, ErrInvalidCredentials
+	}
+
+	authService.loginLimiter.Reset(ctx, security.ScopeAccount, user.Id.String())
+
+	// Блокировка проверяется после пароля, чтобы не раскрывать ее подбирающему пароль
+	err = authService.moderationService.CheckLoginAllowed(database.WithMaster(ctx), user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Хеш в устаревшем формате (bcrypt или старые параметры argon2id) пересчитываем,
+	// пока пароль известен в открытом виде
+	if utils.PasswordNeedsRehash(user.Password, authService.config) {
+		authService.rehashPassword(ctx, user.Id, password)
+	}
+
+	twoFactorEnabled, err := authService.twoFactorService.IsEnabled(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if twoFactorEnabled {
+		challengeToken, err := utils.GenerateChallengeToken(user.Id, authService.config)
+		if err != nil {
+			return nil, err
+		}
+
+		return &models.AuthResponse{
+			UserId:            user.Id,
+			TwoFactorRequired: true,
+			ChallengeToken:    challengeToken,
+		}, nil
+	}
+
+	return authService.startSession(ctx, user.Id, ip, userAgent)
+}
+
+// Второй шаг входа: обмен промежуточного токена и кода TOTP (или кода восстановления)
+// на токен доступа. Неверные коды учитываются ограничителем попыток входа
+func (authService *authService) CompleteTwoFactorLogin(ctx context.Context, challengeToken, code, ip, userAgent string) (*models.AuthResponse, error) {
+	claims, err := utils.ValidateChallengeToken(challengeToken, authService.config)
+	if err != nil {
+		return nil, fmt.Errorf("Токен подтверждения входа недействителен или устарел")
+	}
+
+	userId := claims.UserID
+
+	// Промежуточный токен, выданный до смены пароля, больше не действует
+	if claims.IssuedAt != nil && authService.sessionService.IsTokenRevoked(ctx, userId, claims.IssuedAt.Time) {
+		return nil, fmt.Errorf("Токен подтверждения входа недействителен или устарел")
+	}
+
+	err = authService.loginLimiter.Check(ctx, security.ScopeIP, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authService.loginLimiter.Check(ctx, security.ScopeAccount, userId.String())
+	if err != nil {
+		return nil, err
+	}
+
+	err = authService.twoFactorService.Verify(ctx, userId, code)
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		authService.registerLoginFailure(ctx, security.ScopeAccount, userId.String(), userId, ip)
+		authService.registerLoginFailure(ctx, security.ScopeIP, ip, userId, ip)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	authService.loginLimiter.Reset(ctx, security.ScopeAccount, userId.String())
+
+	err = authService.moderationService.CheckLoginAllowed(database.WithMaster(ctx), userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return authService.startSession(ctx, userId, ip, userAgent)
+}
+
+// Смена пароля авторизованным пользователем. Все ранее выданные токены отзываются,
+// остальные сессии завершаются; для текущей сессии возвращается новый токен
+func (authService *authService) ChangePassword(ctx context.Context, userId, sessionId uuid.UUID, oldPassword, newPassword string) (*models.AuthResponse, error) {
+	ctx = database.WithMaster(ctx)
+	user, err := authService.userRepository.GetUserById(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !utils.CheckPassword(oldPassword, user.Password) {
+		return nil, fmt.Errorf("Текущий пароль указан неверно")
+	}
+
+	err = utils.ValidatePassword(newPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	pass, err := utils.HashPassword(newPassword, authService.config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authService.userRepository.UpdatePassword(ctx, userId, pass)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authService.sessionService.RevokeOthers(ctx, userId, sessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authService.sessionService.RevokeTokens(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return authService.issueToken(ctx, userId, sessionId)
+}
+
+// Новый токен для текущей сессии с актуальными ролями пользователя
+func (authService *authService) RefreshToken(ctx context.Context, userId, sessionId uuid.UUID) (*models.AuthResponse, error) {
+	ctx = database.WithMaster(ctx)
+
+	// Сессия живет столько же, сколько последний выпущенный для нее токен
+	if sessionId != uuid.Nil {
+		if err := authService.sessionService.Extend(ctx, sessionId); err != nil {
+			return nil, err
+		}
 	}
 
-	token, err := utils.GenerateToken(user.Id, authService.config)
+	return authService.issueToken(ctx, userId, sessionId)
+}
+
+// Отправка токена сброса пароля на подтвержденный email/телефон. Ответ не зависит
+// от наличия аккаунта: ошибки после поиска идентификатора только логируются, а
+// сообщение отправляется в фоне. Число запросов ограничено по IP-адресу и логину
+func (authService *authService) RequestPasswordReset(ctx context.Context, login, ip string) error {
+	ctx = database.WithMaster(ctx)
+	login = strings.TrimSpace(login)
+
+	err := authService.forgotIPLimiter.Allow(ctx, ip)
+	if err != nil {
+		return err
+	}
+
+	err = authService.forgotLoginLimiter.Allow(ctx, strings.ToLower(login))
+	if err != nil {
+		return err
+	}
+
+	identity, err := authService.findVerifiedIdentity(ctx, login)
+	if err != nil || identity == nil {
+		return nil
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		log.Printf("Не удалось создать токен сброса пароля: %v", err)
+		return nil
+	}
+
+	err = authService.passwordResetRepository.Create(ctx, utils.HashSecret(token), identity.UserId, time.Now().UTC().Add(passwordResetTTL))
+	if err != nil {
+		log.Printf("Не удалось сохранить токен сброса пароля: %v", err)
+		return nil
+	}
+
+	go func() {
+		err := authService.notifier.Send(context.Background(), &notify.Message{
+			Channel: string(identity.Kind),
+			To:      identity.Value,
+			Subject: "Сброс пароля",
+			Body: fmt.Sprintf("Для сброса пароля используйте токен: %s. Токен действует %d минут. Если вы не запрашивали сброс пароля, проигнорируйте это сообщение.",
+				token, int(passwordResetTTL.Minutes())),
+		})
+		if err != nil {
+			log.Printf("Не удалось отправить токен сброса пароля: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// Установка нового пароля по одноразовому токену сброса. Пароль хешируется только
+// после проверки токена, а неверные токены учитываются в блокировке IP-адреса,
+// как неудачные попытки входа
+func (authService *authService) ResetPassword(ctx context.Context, token, newPassword, ip string) error {
+	ctx = database.WithMaster(ctx)
+	err := authService.loginLimiter.Check(ctx, security.ScopeIP, ip)
+	if err != nil {
+		return err
+	}
+
+	err = utils.ValidatePassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	tokenHash := utils.HashSecret(token)
+	userId, err := authService.passwordResetRepository.GetUserId(ctx, tokenHash)
+	if err != nil {
+		authService.registerLoginFailure(ctx, security.ScopeIP, ip, uuid.Nil, ip)
+		return err
+	}
+
+	pass, err := utils.HashPassword(newPassword, authService.config)
+	if err != nil {
+		return err
+	}
+
+	// Токен мог быть использован параллельным запросом: Reset удаляет его атомарно
+	_, err = authService.passwordResetRepository.Reset(ctx, tokenHash, pass)
+	if err != nil {
+		return err
+	}
+
+	err = authService.sessionService.RevokeOthers(ctx, userId, uuid.Nil)
+	if err != nil {
+		return err
+	}
+
+	return authService.sessionService.RevokeTokens(ctx, userId)
+}
+
+// Новая сессия и привязанный к ней токен доступа
+func (authService *authService) startSession(ctx context.Context, userId uuid.UUID, ip, userAgent string) (*models.AuthResponse, error) {
+	session, err := authService.sessionService.Create(ctx, userId, userAgent, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	return authService.issueToken(ctx, userId, session.Id)
+}
+
+// Токен доступа для сессии; роли берутся на момент выпуска
+func (authService *authService) issueToken(ctx context.Context, userId, sessionId uuid.UUID) (*models.AuthResponse, error) {
+	roles, err := authService.roleService.GetRoles(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := utils.GenerateToken(userId, sessionId, roles, authService.config)
+	if err != nil {
+		return nil, err
+	}
 
 	return &models.AuthResponse{
 		Token:  token,
-		UserId: user.Id,
+		UserId: userId,
 	}, nil
 }
+
+func (authService *authService) rehashPassword(ctx context.Context, userId uuid.UUID, password string) {
+	pass, err := utils.HashPassword(password, authService.config)
+	if err != nil {
+		log.Printf("Не удалось пересчитать хеш пароля: %v", err)
+		return
+	}
+
+	err = authService.userRepository.UpdatePassword(database.WithMaster(ctx), userId, pass)
+	if err != nil {
+		log.Printf("Не удалось обновить хеш пароля: %v", err)
+	}
+}
+
+// Учет неудачной попытки входа; установленная блокировка записывается в журнал аудита
+func (authService *authService) registerLoginFailure(ctx context.Context, scope, subject string, userId uuid.UUID, ip string) {
+	lockout := authService.loginLimiter.RegisterFailure(ctx, scope, subject)
+	if lockout == nil {
+		return
+	}
+
+	err := authService.auditRepository.Add(ctx, &models.AuditEvent{
+		Event:  models.AuditLoginLockout,
+		UserId: userId,
+		IP:     ip,
+		Details: map[string]interface{}{
+			"scope":           lockout.Scope,
+			"failures":        lockout.Failures,
+			"lockout_seconds": int(lockout.Duration.Seconds()),
+		},
+	})
+	if err != nil {
+		log.Printf("Не удалось записать блокировку входа в журнал аудита: %v", err)
+	}
+}
+
+// Хеш случайного пароля с текущими параметрами хеширования, вычисляется один раз
+func (authService *authService) dummyPasswordHash() string {
+	authService.dummyHashOnce.Do(func() {
+		hash, err := utils.HashPassword(uuid.NewString(), authService.config)
+		if err != nil {
+			log.Printf("Не удалось вычислить хеш для проверки неизвестного логина: %v", err)
+			return
+		}
+		authService.dummyHash = hash
+	})
+
+	return authService.dummyHash
+}
+
+// Поиск пользователя по логину: UUID, email, телефон или имя пользователя.
+// Email и телефон учитываются только подтвержденные
+func (authService *authService) findUserByLogin(ctx context.Context, login string) (*models.User, error) {
+	login = strings.TrimSpace(login)
+
+	if id, err := uuid.Parse(login); err == nil {
+		return authService.userRepository.GetUserById(ctx, id)
+	}
+
+	identity, err := authService.findVerifiedIdentity(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	if identity == nil {
+		return authService.userRepository.GetUserByUsername(ctx, login)
+	}
+
+	return authService.userRepository.GetUserById(ctx, identity.UserId)
+}
+
+// Подтвержденный email или телефон по логину; nil, если логин не похож ни на email, ни на телефон
+func (authService *authService) findVerifiedIdentity(ctx context.Context, login string) (*models.LoginIdentity, error) {
+	var (
+		kind  models.IdentityKind
+		value string
+		err   error
+	)
+
+	switch {
+	case strings.Contains(login, "@"):
+		kind = models.IdentityEmail
+		value, err = utils.NormalizeEmail(login)
+	case strings.HasPrefix(login, "+"):
+		kind = models.IdentityPhone
+		value, err = utils.NormalizePhone(login)
+	default:
+		return nil, nil
+	}
+
+	// Некорректный email или телефон не может быть подтвержденным идентификатором
+	if err != nil {
+		return nil, repository.ErrIdentityNotFound
+	}
+
+	return authService.identityRepository.GetVerified(ctx, kind, value)
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"social-network/internal/cache"
+	"social-network/internal/config"
+	"social-network/internal/security"
+	"social-network/pkg/models"
+	"social-network/pkg/repository"
+	"social-network/pkg/utils"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+)
+
+// Пользователи в памяти с поиском по имени пользователя; err имитирует сбой БД
+type memoryLoginUserRepository struct {
+	repository.UserRepository
+	users map[string]*models.User
+	err   error
+}
+
+func (userRepository *memoryLoginUserRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	if userRepository.err != nil {
+		return nil, userRepository.err
+	}
+
+	user, ok := userRepository.users[username]
+	if !ok {
+		return nil, repository.ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func startAuthRedis(t *testing.T) *config.Config {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	port, err := strconv.Atoi(server.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cnf := &config.Config{
+		RedisConfig:    config.RedisConfig{RedisHost: server.Host(), RedisPort: port},
+		PasswordConfig: config.PasswordConfig{Algorithm: config.PasswordArgon2id, Argon2Memory: 1024, Argon2Iterations: 1, Argon2Parallelism: 1},
+	}
+	if err = cache.InitRedis(cnf); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = cache.Close() })
+
+	return cnf
+}
+
+// Неизвестный логин и неверный пароль неотличимы по ответу
+func TestLoginDoesNotRevealUnknownUsers(t *testing.T) {
+	cnf := startAuthRedis(t)
+	hash, err := utils.HashPassword("password", cnf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userRepository := &memoryLoginUserRepository{users: map[string]*models.User{
+		"known": {Id: uuid.New(), Password: hash},
+	}}
+	authService := InitAuthService(cnf, userRepository, nil, nil, nil, &discardAuditRepository{}, security.NewLoginLimiter(), nil, nil, nil, nil, nil)
+
+	_, unknownErr := authService.Login(context.Background(), "unknown", "password", "127.0.0.1", "test")
+	_, wrongErr := authService.Login(context.Background(), "known", "wrong", "127.0.0.2", "test")
+
+	if !errors.Is(unknownErr, ErrInvalidCredentials) || !errors.Is(wrongErr, ErrInvalidCredentials) {
+		t.Errorf("неизвестный логин: %v, неверный пароль: %v", unknownErr, wrongErr)
+	}
+}
+
+// Сбой БД при поиске пользователя не выдается за неверный логин или пароль
+func TestLoginReturnsDatabaseErrors(t *testing.T) {
+	cnf := startAuthRedis(t)
+	dbErr := errors.New("база недоступна")
+	userRepository := &memoryLoginUserRepository{err: dbErr}
+	authService := InitAuthService(cnf, userRepository, nil, nil, nil, &discardAuditRepository{}, security.NewLoginLimiter(), nil, nil, nil, nil, nil)
+
+	_, err := authService.Login(context.Background(), "known", "password", "127.0.0.1", "test")
+	if !errors.Is(err, dbErr) {
+		t.Errorf("ошибка входа при сбое БД: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"social-network/internal/avatar"
+	"social-network/internal/cache"
+	"social-network/internal/config"
+	"social-network/internal/storage"
+	"social-network/pkg/database"
+	"social-network/pkg/models"
+	"social-network/pkg/repository"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+type AvatarService interface {
+	Upload(ctx context.Context, userId uuid.UUID, reader io.Reader) (*models.AvatarResponse, error)
+	Delete(ctx context.Context, userId uuid.UUID) error
+	GetURLs(avatarKey string) *models.AvatarResponse
+	Open(ctx context.Context, key string) (io.ReadCloser, string, error)
+}
+
+type avatarService struct {
+	config            *config.Config
+	blobStore         storage.BlobStore
+	thumbnailPool     *avatar.ThumbnailPool
+	profileCache      *cache.ProfileCache
+	profileRepository repository.ProfileRepository
+}
+
+// Инициализация сервиса аватаров
+func InitAvatarService(config *config.Config, blobStore storage.BlobStore, thumbnailPool *avatar.ThumbnailPool, profileCache *cache.ProfileCache, profileRepository repository.ProfileRepository) AvatarService {
+	return &avatarService{
+		config:            config,
+		blobStore:         blobStore,
+		thumbnailPool:     thumbnailPool,
+		profileCache:      profileCache,
+		profileRepository: profileRepository,
+	}
+}
+
+// Загрузка нового аватара: проверка, генерация миниатюр, сохранение и замена старого
+func (service *avatarService) Upload(ctx context.Context, userId uuid.UUID, reader io.Reader) (*models.AvatarResponse, error) {
+	img, err := avatar.Decode(reader, service.config.StorageConfig.AvatarMaxBytes, service.config.StorageConfig.AvatarMaxPixels)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbnails, err := service.thumbnailPool.Generate(ctx, img, avatar.ThumbnailSizes)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = database.WithMaster(ctx)
+	profile, err := service.profileRepository.GetByUserId(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := avatar.ContentType(img.Format)
+	originalKey := avatar.OriginalKey(userId.String(), uuid.New().String(), img.Format)
+	keys := []string{originalKey}
+
+	err = service.blobStore.Put(ctx, originalKey, bytes.NewReader(img.Data), contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	for size, data := range thumbnails {
+		key := avatar.ThumbnailKey(originalKey, size)
+		keys = append(keys, key)
+		err = service.blobStore.Put(ctx, key, bytes.NewReader(data), contentType)
+		if err != nil {
+			service.deleteBlobs(ctx, keys)
+			return nil, err
+		}
+	}
+
+	err = service.profileRepository.UpdateAvatar(ctx, userId, originalKey)
+	if err != nil {
+		service.deleteBlobs(ctx, keys)
+		return nil, err
+	}
+
+	_ = service.profileCache.Invalidate(userId)
+
+	if profile.Avatar != "" {
+		service.deleteBlobs(ctx, service.avatarKeys(profile.Avatar))
+	}
+
+	return service.GetURLs(originalKey), nil
+}
+
+// Удаление аватара пользователя
+func (service *avatarService) Delete(ctx context.Context, userId uuid.UUID) error {
+	ctx = database.WithMaster(ctx)
+	profile, err := service.profileRepository.GetByUserId(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	if profile.Avatar == "" {
+		return nil
+	}
+
+	err = service.profileRepository.UpdateAvatar(ctx, userId, "")
+	if err != nil {
+		return err
+	}
+
+	_ = service.profileCache.Invalidate(userId)
+	service.deleteBlobs(ctx, service.avatarKeys(profile.Avatar))
+
+	return nil
+}
+
+// Ссылки на оригинал и миниатюры. Для пустого ключа возвращает nil
+func (service *avatarService) GetURLs(avatarKey string) *models.AvatarResponse {
+	if avatarKey == "" {
+		return nil
+	}
+
+	response := &models.AvatarResponse{
+		Original:   service.blobStore.URL(avatarKey),
+		Thumbnails: make(map[string]string, len(avatar.ThumbnailSizes)),
+	}
+
+	for _, size := range avatar.ThumbnailSizes {
+		response.Thumbnails[strconv.Itoa(size)] = service.blobStore.URL(avatar.ThumbnailKey(avatarKey, size))
+	}
+
+	return response
+}
+
+// Открытие файла из хранилища для отдачи клиенту
+func (service *avatarService) Open(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	return service.blobStore.Get(ctx, key)
+}
+
+func (service *avatarService) avatarKeys(avatarKey string) []string {
+	keys := []string{avatarKey}
+	for _, size := range avatar.ThumbnailSizes {
+		keys = append(keys, avatar.ThumbnailKey(avatarKey, size))
+	}
+
+	return keys
+}
+
+func (service *avatarService) deleteBlobs(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := service.blobStore.Delete(ctx, key); err != nil {
+			log.Printf("Не удалось удалить файл %s: %v", key, err)
+		}
+	}
+}
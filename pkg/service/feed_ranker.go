@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"math"
+	"social-network/pkg/models"
+	"social-network/pkg/repository"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	engagementHalfLife      = 24 * time.Hour      // За сутки оценка поста уменьшается вдвое
+	reactionWeight          = 1.0                 // Вес одной реакции
+	commentWeight           = 2.0                 // Вес одного комментария
+	closeFriendsPeriod      = 30 * 24 * time.Hour // Период, за который учитываются взаимодействия
+	closeFriendInteractions = 3                   // Минимум реакций и комментариев для близкого друга
+)
+
+// Стратегия ранжирования ленты. Получает окно постов ленты в хронологическом
+// порядке и возвращает их в порядке показа. rankedAt - момент, относительно
+// которого считается возраст постов: он одинаков для всех страниц одной выдачи
+type Ranker interface {
+	Mode() string
+	Rank(ctx context.Context, userId uuid.UUID, posts []*models.Post, rankedAt time.Time) ([]*models.Post, error)
+}
+
+type chronologicalRanker struct{}
+
+// Хронологический порядок: сначала новые посты
+func InitChronologicalRanker() Ranker {
+	return &chronologicalRanker{}
+}
+
+func (ranker *chronologicalRanker) Mode() string {
+	return models.FeedModeChronological
+}
+
+func (ranker *chronologicalRanker) Rank(ctx context.Context, userId uuid.UUID, posts []*models.Post, rankedAt time.Time) ([]*models.Post, error) {
+	sortChronological(posts)
+
+	return posts, nil
+}
+
+type engagementRanker struct {
+	engagementRepository repository.EngagementRepository
+}
+
+// Порядок по реакциям и комментариям: оценка поста (1 + реакции + 2 * комментарии)
+// уменьшается вдвое за каждые сутки с момента публикации
+func InitEngagementRanker(engagementRepository repository.EngagementRepository) Ranker {
+	return &engagementRanker{engagementRepository: engagementRepository}
+}
+
+func (ranker *engagementRanker) Mode() string {
+	return models.FeedModeEngagement
+}
+
+func (ranker *engagementRanker) Rank(ctx context.Context, userId uuid.UUID, posts []*models.Post, rankedAt time.Time) ([]*models.Post, error) {
+	postIds := make([]uuid.UUID, 0, len(posts))
+	for _, post := range posts {
+		postIds = append(postIds, post.Id)
+	}
+
+	engagements, err := ranker.engagementRepository.GetByPostIds(ctx, postIds)
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make(map[uuid.UUID]float64, len(posts))
+	for _, post := range posts {
+		engagement := engagements[post.Id]
+		weight := 1 + reactionWeight*float64(engagement.Reactions) + commentWeight*float64(engagement.Comments)
+
+		age := rankedAt.Sub(post.CreatedAt)
+		if age < 0 {
+			age = 0
+		}
+		scores[post.Id] = weight * math.Exp2(-float64(age)/float64(engagementHalfLife))
+	}
+
+	// При равных оценках сохраняется хронологический порядок
+	sortChronological(posts)
+	sort.SliceStable(posts, func(i, j int) bool {
+		return scores[posts[i].Id] > scores[posts[j].Id]
+	})
+
+	return posts, nil
+}
+
+type closeFriendsRanker struct {
+	engagementRepository repository.EngagementRepository
+}
+
+// Сначала посты близких друзей - авторов, на посты которых пользователь часто
+// реагировал и которые комментировал за последние 30 дней, затем остальные.
+// Внутри каждой группы порядок хронологический
+func InitCloseFriendsRanker(engagementRepository repository.EngagementRepository) Ranker {
+	return &closeFriendsRanker{engagementRepository: engagementRepository}
+}
+
+func (ranker *closeFriendsRanker) Mode() string {
+	return models.FeedModeCloseFriends
+}
+
+func (ranker *closeFriendsRanker) Rank(ctx context.Context, userId uuid.UUID, posts []*models.Post, rankedAt time.Time) ([]*models.Post, error) {
+	interactions, err := ranker.engagementRepository.GetAuthorInteractions(ctx, userId, rankedAt.Add(-closeFriendsPeriod))
+	if err != nil {
+		return nil, err
+	}
+
+	sortChronological(posts)
+	sort.SliceStable(posts, func(i, j int) bool {
+		return interactions[posts[i].UserId] >= closeFriendInteractions && interactions[posts[j].UserId] < closeFriendInteractions
+	})
+
+	return posts, nil
+}
+
+// Порядок ленты: по (created_at, id) по убыванию
+func sortChronological(posts []*models.Post) {
+	sort.SliceStable(posts, func(i, j int) bool {
+		if !posts[i].CreatedAt.Equal(posts[j].CreatedAt) {
+			return posts[i].CreatedAt.After(posts[j].CreatedAt)
+		}
+
+		return posts[i].Id.String() > posts[j].Id.String()
+	})
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"log"
+	"social-network/internal/config"
+	"social-network/pkg/database"
+	"social-network/pkg/models"
+	"social-network/pkg/repository"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	feedRebuildBatchSize         = 500             // Сколько пользователей обрабатывается между сохранениями прогресса
+	feedRebuildStaleAfter        = 5 * time.Minute // Задача без прогресса и heartbeat дольше считается остановленной
+	feedRebuildHeartbeatInterval = time.Minute     // Как часто выполняемая задача отмечает, что жива
+)
+
+// Пересборка и прогрев лент пользователей, например после очистки Redis, чтобы
+// ленты не собирались одновременно при первых запросах и не перегружали реплики
+type FeedRebuildService interface {
+	Start(ctx context.Context, request *models.StartFeedRebuildRequest) (*models.FeedRebuildJob, error)
+	Prepare(ctx context.Context, request *models.StartFeedRebuildRequest) (*models.FeedRebuildJob, error)
+	Run(ctx context.Context, job *models.FeedRebuildJob) error
+	GetJob(ctx context.Context, jobId uuid.UUID) (*models.FeedRebuildJob, error)
+	GetLatest(ctx context.Context) (*models.FeedRebuildJob, error)
+}
+
+type feedRebuildService struct {
+	config                *config.Config
+	userRepository        repository.UserRepository
+	feedRebuildRepository repository.FeedRebuildRepository
+	feedService           FeedService
+}
+
+// Инициализация сервиса пересборки лент
+func InitFeedRebuildService(config *config.Config, userRepository repository.UserRepository, feedRebuildRepository repository.FeedRebuildRepository, feedService FeedService) FeedRebuildService {
+	return &feedRebuildService{
+		config:                config,
+		userRepository:        userRepository,
+		feedRebuildRepository: feedRebuildRepository,
+		feedService:           feedService,
+	}
+}
+
+// Создание или продолжение задачи и ее выполнение в фоне
+func (service *feedRebuildService) Start(ctx context.Context, request *models.StartFeedRebuildRequest) (*models.FeedRebuildJob, error) {
+	job, err := service.Prepare(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	started := *job
+	go func() {
+		if err := service.Run(context.Background(), job); err != nil {
+			log.Printf("Пересборка лент %s завершилась с ошибкой: %v", job.Id, err)
+		}
+	}()
+
+	return &started, nil
+}
+
+// Задача для выполнения. С resume продолжается последняя незавершенная задача
+// (упавшая или остановившаяся вместе с экземпляром приложения) с ее параметрами;
+// если такой нет, создается новая
+func (service *feedRebuildService) Prepare(ctx context.Context, request *models.StartFeedRebuildRequest) (*models.FeedRebuildJob, error) {
+	ctx = database.WithMaster(ctx)
+
+	if request.Resume {
+		latest, err := service.feedRebuildRepository.GetLatest(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if latest != nil && latest.Status != models.FeedRebuildCompleted {
+			job, err := service.feedRebuildRepository.Claim(ctx, latest.Id, time.Now().Add(-feedRebuildStaleAfter))
+			if err != nil {
+				return nil, err
+			}
+			if job == nil {
+				return nil, repository.ErrFeedRebuildRunning
+			}
+
+			return job, nil
+		}
+	}
+
+	job := &models.FeedRebuildJob{
+		Id:         uuid.New(),
+		ActiveDays: request.ActiveDays,
+		Force:      request.Force,
+		Status:     models.FeedRebuildRunning,
+		CreatedAt:  time.Now().UTC(),
+	}
+
+	total, err := service.userRepository.CountActive(database.WithReplica(ctx), activeSince(job))
+	if err != nil {
+		return nil, err
+	}
+	job.Total = total
+
+	if err = service.feedRebuildRepository.Create(ctx, job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// Выполнение задачи пачками пользователей. Ленты пачки собираются не больше чем
+// в FEED_REBUILD_CONCURRENCY потоков, после пачки сохраняется прогресс. Пока задача
+// выполняется, heartbeat обновляет ее, чтобы долгую пачку не захватил другой
+// экземпляр. Ошибки сборки отдельных лент учитываются в Failed и задачу не прерывают
+func (service *feedRebuildService) Run(ctx context.Context, job *models.FeedRebuildJob) error {
+	masterCtx := database.WithMaster(ctx)
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(masterCtx)
+	defer stopHeartbeat()
+	go service.heartbeat(heartbeatCtx, job.Id)
+
+	replicaCtx := database.WithReplica(ctx)
+	since := activeSince(job)
+	after := uuid.Nil
+	if job.LastUserId != nil {
+		after = *job.LastUserId
+	}
+
+	log.Printf("Пересборка лент %s: обработано %d из %d", job.Id, job.Processed, job.Total)
+	for {
+		if ctx.Err() != nil {
+			return service.fail(job, ctx.Err())
+		}
+
+		userIds, err := service.userRepository.GetIdsAfter(replicaCtx, after, since, feedRebuildBatchSize)
+		if err != nil {
+			return service.fail(job, err)
+		}
+
+		if len(userIds) == 0 {
+			break
+		}
+
+		job.Failed += service.rebuildBatch(replicaCtx, userIds, job.Force)
+		job.Processed += len(userIds)
+		if job.Processed > job.Total {
+			// Пользователи, появившиеся после создания задачи
+			job.Total = job.Processed
+		}
+		after = userIds[len(userIds)-1]
+		job.LastUserId = &after
+
+		if err = service.feedRebuildRepository.SaveProgress(masterCtx, job); err != nil {
+			return service.fail(job, err)
+		}
+		log.Printf("Пересборка лент %s: обработано %d из %d, ошибок %d", job.Id, job.Processed, job.Total, job.Failed)
+	}
+
+	job.Status = models.FeedRebuildCompleted
+	if err := service.feedRebuildRepository.Finish(masterCtx, job); err != nil {
+		return err
+	}
+	log.Printf("Пересборка лент %s завершена: обработано %d, ошибок %d", job.Id, job.Processed, job.Failed)
+
+	return nil
+}
+
+// Периодическая отметка, что задача выполняется, до отмены контекста
+func (service *feedRebuildService) heartbeat(ctx context.Context, jobId uuid.UUID) {
+	ticker := time.NewTicker(feedRebuildHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := service.feedRebuildRepository.Heartbeat(ctx, jobId); err != nil && ctx.Err() == nil {
+			log.Printf("Не удалось обновить heartbeat пересборки лент %s: %v", jobId, err)
+		}
+	}
+}
+
+// Пересборка лент пачки пользователей; возвращает число неудачных
+func (service *feedRebuildService) rebuildBatch(ctx context.Context, userIds []uuid.UUID, force bool) int {
+	concurrency := service.config.FeedConfig.RebuildConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var failed int64
+	var wg sync.WaitGroup
+	userIdsChan := make(chan uuid.UUID)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for userId := range userIdsChan {
+				if err := service.feedService.RebuildUserFeed(ctx, userId, force); err != nil {
+					atomic.AddInt64(&failed, 1)
+					log.Printf("Не удалось пересобрать ленту пользователя %s: %v", userId, err)
+				}
+			}
+		}()
+	}
+
+	for _, userId := range userIds {
+		userIdsChan <- userId
+	}
+	close(userIdsChan)
+	wg.Wait()
+
+	return int(failed)
+}
+
+// Остановка задачи с ошибкой: ее можно продолжить с resume
+func (service *feedRebuildService) fail(job *models.FeedRebuildJob, cause error) error {
+	job.Status = models.FeedRebuildFailed
+	job.Error = cause.Error()
+	if err := service.feedRebuildRepository.Finish(database.WithMaster(context.Background()), job); err != nil {
+		log.Printf("Не удалось сохранить состояние пересборки лент %s: %v", job.Id, err)
+	}
+
+	return cause
+}
+
+func (service *feedRebuildService) GetJob(ctx context.Context, jobId uuid.UUID) (*models.FeedRebuildJob, error) {
+	return service.feedRebuildRepository.GetById(database.WithMaster(ctx), jobId)
+}
+
+func (service *feedRebuildService) GetLatest(ctx context.Context) (*models.FeedRebuildJob, error) {
+	return service.feedRebuildRepository.GetLatest(database.WithMaster(ctx))
+}
+
+// Начало периода активности пользователей задачи; нулевое время - все пользователи.
+// Отсчитывается от создания задачи, чтобы продолжение обходило тех же пользователей
+func activeSince(job *models.FeedRebuildJob) time.Time {
+	if job.ActiveDays <= 0 {
+		return time.Time{}
+	}
+
+	return job.CreatedAt.Add(-time.Duration(job.ActiveDays) * 24 * time.Hour)
+}
@@ -2,90 +2,345 @@ package service
 
 import (
 	"context"
+	"errors"
+	"log"
 	"social-network/internal/cache"
+	"social-network/internal/config"
 	"social-network/internal/feed"
 
 	"social-network/pkg/database"
 	"social-network/pkg/models"
 	"social-network/pkg/repository"
+	"time"
 
 	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
 )
 
 type FeedService interface {
-	GetFeed(ctx context.Context, userId uuid.UUID, limit, offset int) ([]*models.Post, error)
+	GetFeed(ctx context.Context, userId uuid.UUID, cursor *models.FeedCursor, limit int) ([]*models.Post, *models.FeedCursor, error)
 	AddPostToFeed(ctx context.Context, userId uuid.UUID, post *models.Post) error
 	DeletePostInFeeds(ctx context.Context, userId uuid.UUID, post *models.Post) error
 	UpdateUserFeedByAddedFriend(ctx context.Context, userId uuid.UUID, friendId uuid.UUID, isFriend bool) error
-	BuildUserFeed(ctx context.Context, userId uuid.UUID, limit, offset int) error
+	BuildUserFeed(ctx context.Context, userId uuid.UUID) error
+	RebuildUserFeed(ctx context.Context, userId uuid.UUID, force bool) error
 	GetFeedCountByUser(ctx context.Context, userId uuid.UUID) int64
+	HandleEvent(ctx context.Context, event *models.Event) error
+	GetPullAuthors(ctx context.Context, userId uuid.UUID) ([]uuid.UUID, error)
+	GetRankedFeed(ctx context.Context, userId uuid.UUID, mode string, cursor *models.RankedFeedCursor, limit int) ([]*models.Post, *models.RankedFeedCursor, error)
 }
 
+// Как часто запрос, ожидающий сборки ленты другим экземпляром, проверяет ее готовность
+const feedBuildPollInterval = 50 * time.Millisecond
+
+// Ленту пользователя в этот момент собирает другой запрос
+var errFeedBuildInProgress = errors.New("Лента пользователя уже собирается")
+
+// Время хранения порядка ранжированной ленты для постраничного чтения
+const rankedFeedTTL = 10 * time.Minute
+
 type feedService struct {
+	config               *config.Config
 	feedCache            feed.FeedCache
 	postRepository       repository.PostRepository
 	friendShipRepository repository.FriendShipRepository
+	moderationService    ModerationService
+	rankers              map[string]Ranker
+	// Одновременные сборки ленты одного пользователя в процессе выполняются один раз
+	builds singleflight.Group
 }
 
-// Инициализация сервиса по работе с лентами
-func InitFeedService(feedCache *feed.FeedCache, postRepository repository.PostRepository, friendShipRepository repository.FriendShipRepository) FeedService {
+// Инициализация сервиса по работе с лентами с доступными стратегиями ранжирования
+func InitFeedService(config *config.Config, feedCache *feed.FeedCache, postRepository repository.PostRepository, friendShipRepository repository.FriendShipRepository, moderationService ModerationService, rankers ...Ranker) FeedService {
+	rankersByMode := make(map[string]Ranker, len(rankers))
+	for _, ranker := range rankers {
+		rankersByMode[ranker.Mode()] = ranker
+	}
+
 	return &feedService{
+		config:               config,
 		feedCache:            *feedCache,
 		postRepository:       postRepository,
 		friendShipRepository: friendShipRepository,
+		moderationService:    moderationService,
+		rankers:              rankersByMode,
 	}
 }
 
-// Получение ленты постов пользователя userId
-func (feedService *feedService) GetFeed(ctx context.Context, userId uuid.UUID, limit, offset int) ([]*models.Post, error) {
+// Получение страницы ленты пользователя userId, начиная строго после курсора.
+// Возвращает посты и курсор следующей страницы (nil, если лента закончилась).
+// Кеш хранит окно из последних FeedSize постов ленты; страница за его границей
+// (или ее остаток) читается из БД по тому же keyset-порядку
+func (feedService *feedService) GetFeed(ctx context.Context, userId uuid.UUID, cursor *models.FeedCursor, limit int) ([]*models.Post, *models.FeedCursor, error) {
 	ctx = database.WithReplica(ctx)
-	feedKey := cache.FeedKey(userId.String())
-	exists, err := cache.Exists(feedKey)
+
+	// Лента не собрана, то собираем окно ленты из БД
+	err := feedService.ensureFeed(ctx, userId)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	// Отсутствует лента, то прогреваем кеш
-	if !exists {
-		err = feedService.BuildUserFeed(ctx, userId, limit, offset)
+	// Посты друзей, которым рассылка не делается, подмешиваются из их списков постов
+	var friendIds []uuid.UUID
+	friendsLoaded := false
+	hasPullAuthors, err := feedService.feedCache.HasPullAuthors()
+	if err != nil {
+		return nil, nil, err
+	}
+	var pullAuthorIds []uuid.UUID
+	if hasPullAuthors {
+		friendIds, err = feedService.friendShipRepository.GetFriendsByUserId(ctx, userId)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		friendsLoaded = true
+
+		pullAuthorIds, err = feedService.feedCache.GetPullAuthors(friendIds)
+		if err != nil {
+			return nil, nil, err
 		}
 	}
+
 	// Получаем посты из кеша
-	posts, err := feedService.feedCache.GetFeedByUserId(userId, limit, offset)
+	page, err := feedService.feedCache.GetFeedByUserId(userId, pullAuthorIds, cursor, limit)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	// Количество постов в ленте относительно limit и offset
-	countPosts := len(posts)
+	posts, err := feedService.resolvePosts(ctx, page)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	// Если постов недостаточно, то догружаем из БД
-	if countPosts < limit && (countPosts+offset) < 1000 {
-		friendIds, err := feedService.friendShipRepository.GetFriendsByUserId(ctx, userId)
-		if err != nil {
-			return posts, err
+	// Курсор берется до фильтрации, чтобы скрытые и удаленные посты не запрашивались повторно
+	count := len(page.Positions)
+	last := cursor
+	if count > 0 {
+		last = &page.Positions[count-1]
+	}
+
+	// Окно ленты в кеше закончилось, то догружаем из БД после последнего полученного.
+	// В кеш эти посты не пишутся: вне окна лента в кеше была бы с пропусками
+	if count < limit {
+		if !friendsLoaded {
+			friendIds, err = feedService.friendShipRepository.GetFriendsByUserId(ctx, userId)
+			if err != nil {
+				return nil, nil, err
+			}
 		}
 
-		// Последние посты в базе данных по выбранному пользователю
 		friendIds = append(friendIds, userId)
-		dbPosts, err := feedService.postRepository.GetListByUserIds(ctx, friendIds, limit-countPosts, offset+countPosts)
+		dbPosts, err := feedService.postRepository.GetListByUserIds(ctx, friendIds, last, limit-count)
 		if err != nil {
-			return posts, nil
+			return nil, nil, err
+		}
+
+		posts = append(posts, dbPosts...)
+		count += len(dbPosts)
+		if len(dbPosts) > 0 {
+			last = models.FeedCursorOf(dbPosts[len(dbPosts)-1])
+		}
+	}
+
+	var nextCursor *models.FeedCursor
+	if count == limit {
+		nextCursor = last
+	}
+
+	return feedService.filterHidden(userId, posts), nextCursor, nil
+}
+
+// Посты страницы из кеша в порядке ленты. Содержимое, вытесненное из кеша,
+// читается из БД и кешируется заново; посты, которых уже нет в БД, пропускаются
+func (feedService *feedService) resolvePosts(ctx context.Context, page *feed.CachedFeedPage) ([]*models.Post, error) {
+	var missingIds []uuid.UUID
+	for _, position := range page.Positions {
+		if page.Posts[position.Id] == nil {
+			missingIds = append(missingIds, position.Id)
+		}
+	}
+
+	if len(missingIds) > 0 {
+		dbPosts, err := feedService.postRepository.GetByIds(ctx, missingIds)
+		if err != nil {
+			return nil, err
 		}
 
-		// Обновляем кеш
 		for _, post := range dbPosts {
-			_ = feedService.feedCache.AddPostIntoUserFeed(userId, post)
+			page.Posts[post.Id] = post
 		}
+		_ = feedService.feedCache.CachePosts(dbPosts)
+	}
 
-		posts = append(posts, dbPosts...)
+	posts := make([]*models.Post, 0, len(page.Positions))
+	for _, position := range page.Positions {
+		if post := page.Posts[position.Id]; post != nil {
+			posts = append(posts, post)
+		}
 	}
 
 	return posts, nil
 }
 
+// Страница ленты, упорядоченной стратегией mode. Пересортировывается окно из
+// rankWindow последних постов, опубликованных до момента ранжирования первой
+// страницы. Порядок постов сохраняется в Redis на rankedFeedTTL, и следующие
+// страницы того же курсора берутся из него, поэтому новые реакции и удаления
+// не приводят к повторам и пропускам между страницами (удаленные посты только
+// выпадают из страницы). Если порядок истек, окно ранжируется заново
+func (feedService *feedService) GetRankedFeed(ctx context.Context, userId uuid.UUID, mode string, cursor *models.RankedFeedCursor, limit int) ([]*models.Post, *models.RankedFeedCursor, error) {
+	ranker, ok := feedService.rankers[mode]
+	if !ok {
+		return nil, nil, models.ErrUnknownFeedMode
+	}
+
+	if cursor == nil {
+		cursor = &models.RankedFeedCursor{RankedAt: time.Now().UTC()}
+	}
+	if cursor.Offset >= feedService.config.FeedConfig.RankWindow {
+		return nil, nil, nil
+	}
+
+	key := cache.RankedFeedKey(userId.String(), mode, cursor.RankedAt.UnixNano())
+	postIds, found, err := cache.GetRankedFeed(key)
+	if err != nil {
+		log.Printf("Не удалось прочитать порядок ранжированной ленты пользователя %s: %v", userId, err)
+	}
+
+	var ranked map[string]*models.Post
+	if !found {
+		posts, err := feedService.rankWindow(ctx, userId, ranker, cursor.RankedAt)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		postIds = make([]string, 0, len(posts))
+		ranked = make(map[string]*models.Post, len(posts))
+		for _, post := range posts {
+			postIds = append(postIds, post.Id.String())
+			ranked[post.Id.String()] = post
+		}
+
+		if err = cache.SetRankedFeed(key, postIds, rankedFeedTTL); err != nil {
+			log.Printf("Не удалось сохранить порядок ранжированной ленты пользователя %s: %v", userId, err)
+		}
+	}
+
+	if cursor.Offset >= len(postIds) {
+		return nil, nil, nil
+	}
+
+	end := cursor.Offset + limit
+	var nextCursor *models.RankedFeedCursor
+	if end < len(postIds) {
+		nextCursor = &models.RankedFeedCursor{RankedAt: cursor.RankedAt, Offset: end}
+	} else {
+		end = len(postIds)
+	}
+	postIds = postIds[cursor.Offset:end]
+
+	if ranked != nil {
+		posts := make([]*models.Post, 0, len(postIds))
+		for _, postId := range postIds {
+			posts = append(posts, ranked[postId])
+		}
+
+		return posts, nextCursor, nil
+	}
+
+	posts, err := feedService.loadRankedPosts(ctx, userId, postIds)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return posts, nextCursor, nil
+}
+
+// Ранжирование окна ленты: последние rankWindow постов, опубликованных не позже rankedAt
+func (feedService *feedService) rankWindow(ctx context.Context, userId uuid.UUID, ranker Ranker, rankedAt time.Time) ([]*models.Post, error) {
+	windowStart := &models.FeedCursor{CreatedAt: rankedAt, Id: uuid.Max}
+	window, _, err := feedService.GetFeed(ctx, userId, windowStart, feedService.config.FeedConfig.RankWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	return ranker.Rank(database.WithReplica(ctx), userId, window, rankedAt)
+}
+
+// Посты страницы по сохраненному порядку. Удаленные посты и посты авторов,
+// скрытых модератором, пропускаются
+func (feedService *feedService) loadRankedPosts(ctx context.Context, userId uuid.UUID, postIds []string) ([]*models.Post, error) {
+	ids := make([]uuid.UUID, 0, len(postIds))
+	for _, postId := range postIds {
+		id, err := uuid.Parse(postId)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	dbPosts, err := feedService.postRepository.GetByIds(database.WithReplica(ctx), ids)
+	if err != nil {
+		return nil, err
+	}
+
+	byId := make(map[uuid.UUID]*models.Post, len(dbPosts))
+	for _, post := range dbPosts {
+		byId[post.Id] = post
+	}
+
+	posts := make([]*models.Post, 0, len(ids))
+	for _, id := range ids {
+		if post := byId[id]; post != nil {
+			posts = append(posts, post)
+		}
+	}
+
+	return feedService.filterHidden(userId, posts), nil
+}
+
+// Друзья пользователя, посты которых не рассылаются по лентам, а подмешиваются при чтении
+func (feedService *feedService) GetPullAuthors(ctx context.Context, userId uuid.UUID) ([]uuid.UUID, error) {
+	hasPullAuthors, err := feedService.feedCache.HasPullAuthors()
+	if err != nil || !hasPullAuthors {
+		return nil, err
+	}
+
+	friendIds, err := feedService.friendShipRepository.GetFriendsByUserId(database.WithReplica(ctx), userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return feedService.feedCache.GetPullAuthors(friendIds)
+}
+
+// Исключение постов авторов, контент которых скрыт модератором от пользователя userId.
+// Посты могли попасть в ленты до введения ограничения
+func (feedService *feedService) filterHidden(userId uuid.UUID, posts []*models.Post) []*models.Post {
+	if len(posts) == 0 {
+		return posts
+	}
+
+	authorIds := make([]uuid.UUID, 0, len(posts))
+	for _, post := range posts {
+		authorIds = append(authorIds, post.UserId)
+	}
+
+	hidden := feedService.moderationService.HiddenAuthors(userId, authorIds)
+	if len(hidden) == 0 {
+		return posts
+	}
+
+	visible := make([]*models.Post, 0, len(posts))
+	for _, post := range posts {
+		if !hidden[post.UserId] {
+			visible = append(visible, post)
+		}
+	}
+
+	return visible
+}
+
 // Количество записей в ленте пользователя
 func (feedService *feedService) GetFeedCountByUser(ctx context.Context, userId uuid.UUID) int64 {
 	feedKey := cache.FeedKey(userId.String())
@@ -97,15 +352,28 @@ func (feedService *feedService) GetFeedCountByUser(ctx context.Context, userId u
 	return result
 }
 
-// Обновление кеша при добавлении/удалении пользователя (список друзей)
+// Обновление кеша при добавлении/удалении друга: собранные ленты обоих
+// пользователей пересобираются, чтобы в окне появились посты нового друга и
+// пропали посты бывшего. Разосланные в несобранную ленту посты удаляются,
+// она соберется при чтении
 func (feedService *feedService) UpdateUserFeedByAddedFriend(ctx context.Context, userId uuid.UUID, friendId uuid.UUID, isFriend bool) error {
-	err := feedService.feedCache.UpdateUserFeedByAddedFriend(userId, friendId, isFriend)
-	if err != nil {
-		return err
-	}
-
-	if isFriend {
-		err = feedService.feedCache.UpdateUserFeedByAddedFriend(friendId, userId, isFriend)
+	// Список друзей читается с мастера: реплика могла еще не получить изменение
+	ctx = database.WithMaster(ctx)
+
+	for _, id := range []uuid.UUID{userId, friendId} {
+		// Если ленту собирает другой запрос, он мог прочитать старый список друзей:
+		// ошибка возвращается, чтобы событие было обработано повторно
+		err := feedService.buildLocked(ctx, id, false, func() error {
+			materialized, err := feedService.feedCache.IsMaterialized(id)
+			if err != nil {
+				return err
+			}
+			if !materialized {
+				return cache.Del(cache.FeedKey(id.String()))
+			}
+
+			return feedService.BuildUserFeed(ctx, id)
+		})
 		if err != nil {
 			return err
 		}
@@ -123,6 +391,11 @@ func (feedService *feedService) AddPostToFeed(ctx context.Context, userId uuid.U
 		return err
 	}
 
+	// Посты заблокированных и теневых авторов в ленты друзей не рассылаются
+	if feedService.moderationService.GetState(userId) != models.ModerationActive {
+		return nil
+	}
+
 	// Получаем список друзей
 	friendIds, err := feedService.friendShipRepository.GetFriendsByUserId(ctx, userId)
 	if err != nil {
@@ -133,8 +406,8 @@ func (feedService *feedService) AddPostToFeed(ctx context.Context, userId uuid.U
 		return nil
 	}
 
-	// Добавляем пост в ленты друзей
-	err = feedService.feedCache.AddPostToFriendFeeds(userId, post, friendIds)
+	// Добавляем пост в ленты друзей, если их не больше порога рассылки
+	err = feedService.feedCache.FanOut(post, friendIds)
 	if err != nil {
 		return err
 	}
@@ -156,37 +429,236 @@ func (feedService *feedService) DeletePostInFeeds(ctx context.Context, userId uu
 		return err
 	}
 
+	// Ошибки по отдельным лентам не прерывают удаление из остальных, но возвращаются,
+	// чтобы событие было обработано повторно
+	var errs []error
 	for _, friendId := range friendIds {
 		err = feedService.feedCache.DeletePostFromFeed(friendId, post)
 		if err != nil {
-			// Логгирование данных
+			errs = append(errs, err)
+		}
+	}
+
+	err = feedService.feedCache.DeletePost(post)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Сборка ленты из БД: окно из последних FeedSize постов заменяет ленту в кеше.
+// Посты читаются с мастера: WarmUpCache удаляет из ленты посты старше loadedAt,
+// которых нет в выборке, и отставшая реплика привела бы к потере уже разосланных постов
+func (feedService *feedService) BuildUserFeed(ctx context.Context, userId uuid.UUID) error {
+	ctx = database.WithMaster(ctx)
+	loadedAt := time.Now()
+	posts, err := feedService.loadFeedPosts(ctx, userId, feed.FeedSize)
+	if err != nil {
+		return err
+	}
+
+	if err = feedService.feedCache.WarmUpCache(userId, posts, loadedAt); err != nil {
+		return err
+	}
+
+	return cache.Set(cache.FeedFreshKey(userId.String()), 1, feedService.config.FeedConfig.RevalidateAfter)
+}
+
+// Пересборка ленты пользователя из БД. Без force собранная лента не пересобирается.
+// Если ленту в этот момент собирает другой запрос, пересборка пропускается
+func (feedService *feedService) RebuildUserFeed(ctx context.Context, userId uuid.UUID, force bool) error {
+	ctx = database.WithMaster(ctx)
+
+	err := feedService.buildLocked(ctx, userId, false, func() error {
+		if !force {
+			materialized, err := feedService.feedCache.IsMaterialized(userId)
+			if err != nil || materialized {
+				return err
+			}
 		}
+
+		return feedService.BuildUserFeed(ctx, userId)
+	})
+	if err == errFeedBuildInProgress {
+		return nil
 	}
 
-	err = feedService.feedCache.DeletePost(post.Id)
+	return err
+}
+
+// Сборка ленты пользователя перед чтением, если она не собрана. Несобранную ленту
+// во всем кластере собирает один запрос, остальные дожидаются его результата.
+// Устаревшая лента отдается сразу и пересобирается в фоне (stale-while-revalidate)
+func (feedService *feedService) ensureFeed(ctx context.Context, userId uuid.UUID) error {
+	materialized, err := feedService.feedCache.IsMaterialized(userId)
 	if err != nil {
 		return err
 	}
 
+	if materialized {
+		fresh, err := cache.Exists(cache.FeedFreshKey(userId.String()))
+		if err == nil && !fresh {
+			go feedService.revalidate(userId)
+		}
+
+		return nil
+	}
+
+	// Сборка не должна прерываться отменой запроса, который ее начал: ее результат ждут другие
+	buildCtx := context.WithoutCancel(ctx)
+	_, err, _ = feedService.builds.Do(userId.String(), func() (interface{}, error) {
+		return nil, feedService.buildLocked(buildCtx, userId, true, func() error {
+			// Лента могла быть собрана, пока ее собирал другой экземпляр
+			materialized, err := feedService.feedCache.IsMaterialized(userId)
+			if err != nil || materialized {
+				return err
+			}
+
+			return feedService.BuildUserFeed(buildCtx, userId)
+		})
+	})
+
+	return err
+}
+
+// Фоновая пересборка устаревшей ленты. Повторные вызовы, пока пересборка идет, пропускаются
+func (feedService *feedService) revalidate(userId uuid.UUID) {
+	_, _, _ = feedService.builds.Do("revalidate:"+userId.String(), func() (interface{}, error) {
+		ctx := database.WithMaster(context.Background())
+		err := feedService.buildLocked(ctx, userId, false, func() error {
+			return feedService.BuildUserFeed(ctx, userId)
+		})
+		if err != nil && err != errFeedBuildInProgress {
+			log.Printf("Не удалось обновить ленту пользователя %s: %v", userId, err)
+		}
+
+		return nil, err
+	})
+}
+
+// Выполнение build под блокировкой сборки ленты в Redis, чтобы ленту пользователя
+// одновременно собирал один экземпляр. Если блокировка занята, при wait запрос
+// ждет, пока лента будет собрана или блокировка освободится (не дольше
+// FEED_BUILD_WAIT_TIMEOUT), иначе возвращается errFeedBuildInProgress. Без Redis
+// лента собирается без блокировки
+func (feedService *feedService) buildLocked(ctx context.Context, userId uuid.UUID, wait bool, build func() error) error {
+	lockKey := cache.FeedBuildLockKey(userId.String())
+	token := uuid.NewString()
+	acquired, err := cache.AcquireLock(lockKey, token, feedService.config.FeedConfig.BuildLockTTL)
+	if err != nil {
+		return build()
+	}
+
+	if acquired {
+		defer cache.ReleaseLock(lockKey, token)
+
+		return build()
+	}
+
+	if !wait {
+		return errFeedBuildInProgress
+	}
+
+	deadline := time.Now().Add(feedService.config.FeedConfig.BuildWaitTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(feedBuildPollInterval):
+		}
+
+		// Лента собрана либо сборка завершилась с ошибкой
+		materialized, err := feedService.feedCache.IsMaterialized(userId)
+		if err != nil || materialized {
+			return err
+		}
+		locked, err := cache.Exists(lockKey)
+		if err != nil || !locked {
+			return err
+		}
+	}
+
+	// Сборка на другом экземпляре не успела: страница дочитывается из БД
 	return nil
 }
 
-// Строим и кешируем ленту постов
-func (feedService *feedService) BuildUserFeed(ctx context.Context, userId uuid.UUID, limit, offset int) error {
+// Последние limit постов пользователя и его друзей из БД
+func (feedService *feedService) loadFeedPosts(ctx context.Context, userId uuid.UUID, limit int) ([]*models.Post, error) {
 	// Получаем список друзей
 	friendIds, err := feedService.friendShipRepository.GetFriendsByUserId(ctx, userId)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Последние посты в базе данных по выбранному пользователю
 	friendIds = append(friendIds, userId)
-	posts, err := feedService.postRepository.GetListByUserIds(ctx, friendIds, limit, offset)
-	if err != nil {
+
+	return feedService.postRepository.GetListByUserIds(ctx, friendIds, nil, limit)
+}
+
+// Рассылка созданного поста. События обрабатываются несколькими потребителями с
+// повторами, поэтому создание может обработаться после удаления того же поста:
+// пост, которого уже нет в БД, не рассылается, а если его удалили во время
+// рассылки, он удаляется из лент повторно
+func (feedService *feedService) handlePostCreated(ctx context.Context, post *models.Post) error {
+	exists, err := feedService.postExists(ctx, post.Id)
+	if err != nil || !exists {
 		return err
 	}
 
-	err = feedService.feedCache.WarmUpCache(userId, posts)
+	if err = feedService.AddPostToFeed(ctx, post.UserId, post); err != nil {
+		return err
+	}
 
-	return err
+	exists, err = feedService.postExists(ctx, post.Id)
+	if err != nil || exists {
+		return err
+	}
+
+	return feedService.DeletePostInFeeds(ctx, post.UserId, post)
+}
+
+// Есть ли пост в БД. Читается с мастера: событие могло опередить реплику
+func (feedService *feedService) postExists(ctx context.Context, postId uuid.UUID) (bool, error) {
+	posts, err := feedService.postRepository.GetByIds(database.WithMaster(ctx), []uuid.UUID{postId})
+
+	return len(posts) > 0, err
+}
+
+// Обработка события очереди: обновление лент после изменения постов и друзей
+// и очистка кеша удаленного аккаунта.
+// Обработчики идемпотентны, повторная доставка события ленты не портит
+func (feedService *feedService) HandleEvent(ctx context.Context, event *models.Event) error {
+	switch event.Type {
+	case models.EventPostCreated, models.EventPostDeleted:
+		var post models.Post
+		if err := event.Decode(&post); err != nil {
+			return err
+		}
+		if event.Type == models.EventPostCreated {
+			return feedService.handlePostCreated(ctx, &post)
+		}
+
+		return feedService.DeletePostInFeeds(ctx, post.UserId, &post)
+	case models.EventFriendAdded, models.EventFriendRemoved:
+		var friendEvent models.FriendEvent
+		if err := event.Decode(&friendEvent); err != nil {
+			return err
+		}
+
+		return feedService.UpdateUserFeedByAddedFriend(ctx, friendEvent.UserId, friendEvent.FriendId, event.Type == models.EventFriendAdded)
+	case models.EventAccountDeleted:
+		var accountEvent models.AccountDeletedEvent
+		if err := event.Decode(&accountEvent); err != nil {
+			return err
+		}
+
+		return feedService.feedCache.PurgeUser(accountEvent.UserId, accountEvent.PostIds, accountEvent.FriendIds)
+	}
+
+	// Неизвестное событие повторная обработка не исправит
+	log.Printf("Неизвестный тип события %s (%s)", event.Type, event.Id)
+
+	return nil
 }
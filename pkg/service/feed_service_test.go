@@ -0,0 +1,594 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"social-network/internal/cache"
+	"social-network/internal/config"
+	"social-network/internal/feed"
+	"social-network/pkg/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	propertyUsers     = 6 // Пользователи сценария; читатель - первый
+	propertyThreshold = 2 // Порог рассылки: авторы с тремя и более друзьями подмешиваются при чтении
+)
+
+// Посты в памяти с той же keyset-выборкой, что и в БД
+type memoryPostRepository struct {
+	posts map[uuid.UUID]*models.Post
+}
+
+func (repository *memoryPostRepository) AddPost(ctx context.Context, post *models.Post) error {
+	repository.posts[post.Id] = post
+	return nil
+}
+
+func (repository *memoryPostRepository) GetById(ctx context.Context, postId uuid.UUID) (*models.Post, error) {
+	post, ok := repository.posts[postId]
+	if !ok {
+		return nil, fmt.Errorf("Пост не найден")
+	}
+
+	return post, nil
+}
+
+func (repository *memoryPostRepository) GetByIds(ctx context.Context, postIds []uuid.UUID) ([]*models.Post, error) {
+	var posts []*models.Post
+	for _, postId := range postIds {
+		if post, ok := repository.posts[postId]; ok {
+			posts = append(posts, post)
+		}
+	}
+
+	return posts, nil
+}
+
+func (repository *memoryPostRepository) DeletePost(ctx context.Context, postId, userId uuid.UUID) error {
+	delete(repository.posts, postId)
+	return nil
+}
+
+func (repository *memoryPostRepository) GetListByUserId(ctx context.Context, userId uuid.UUID, limit, offset int) ([]*models.Post, error) {
+	posts, err := repository.GetListByUserIds(ctx, []uuid.UUID{userId}, nil, offset+limit)
+	if err != nil || offset >= len(posts) {
+		return nil, err
+	}
+
+	return posts[offset:], nil
+}
+
+func (repository *memoryPostRepository) GetListByUserIds(ctx context.Context, userIds []uuid.UUID, cursor *models.FeedCursor, limit int) ([]*models.Post, error) {
+	authors := make(map[uuid.UUID]bool, len(userIds))
+	for _, userId := range userIds {
+		authors[userId] = true
+	}
+
+	var posts []*models.Post
+	for _, post := range repository.posts {
+		if authors[post.UserId] && (cursor == nil || feedAfter(post, cursor)) {
+			posts = append(posts, post)
+		}
+	}
+	sortChronological(posts)
+	if len(posts) > limit {
+		posts = posts[:limit]
+	}
+
+	return posts, nil
+}
+
+func (repository *memoryPostRepository) GetIdsByUserId(ctx context.Context, userId uuid.UUID) ([]uuid.UUID, error) {
+	var postIds []uuid.UUID
+	for _, post := range repository.posts {
+		if post.UserId == userId {
+			postIds = append(postIds, post.Id)
+		}
+	}
+
+	return postIds, nil
+}
+
+// Идет ли пост после курсора: (created_at, id) < курсора
+func feedAfter(post *models.Post, cursor *models.FeedCursor) bool {
+	if !post.CreatedAt.Equal(cursor.CreatedAt) {
+		return post.CreatedAt.Before(cursor.CreatedAt)
+	}
+
+	return post.Id.String() < cursor.Id.String()
+}
+
+// Симметричная дружба в памяти
+type memoryFriendShipRepository struct {
+	friends map[uuid.UUID]map[uuid.UUID]bool
+}
+
+func (repository *memoryFriendShipRepository) Add(ctx context.Context, userId uuid.UUID, friendId uuid.UUID) error {
+	for _, pair := range [][2]uuid.UUID{{userId, friendId}, {friendId, userId}} {
+		if repository.friends[pair[0]] == nil {
+			repository.friends[pair[0]] = make(map[uuid.UUID]bool)
+		}
+		repository.friends[pair[0]][pair[1]] = true
+	}
+
+	return nil
+}
+
+func (repository *memoryFriendShipRepository) Delete(ctx context.Context, userId uuid.UUID, friendId uuid.UUID) error {
+	delete(repository.friends[userId], friendId)
+	delete(repository.friends[friendId], userId)
+
+	return nil
+}
+
+func (repository *memoryFriendShipRepository) GetFriendsByUserId(ctx context.Context, userId uuid.UUID) ([]uuid.UUID, error) {
+	var friendIds []uuid.UUID
+	for friendId := range repository.friends[userId] {
+		friendIds = append(friendIds, friendId)
+	}
+
+	return friendIds, nil
+}
+
+func (repository *memoryFriendShipRepository) GetListByUserId(ctx context.Context, userId uuid.UUID) ([]*models.FriendShip, error) {
+	return nil, nil
+}
+
+// Модерация без ограничений
+type activeModerationService struct{}
+
+func (service *activeModerationService) SetState(ctx context.Context, actorId, userId uuid.UUID, request *models.ModerationRequest, ip string) (*models.ModerationAction, error) {
+	return nil, nil
+}
+
+func (service *activeModerationService) GetModeration(ctx context.Context, userId uuid.UUID) (*models.ModerationResponse, error) {
+	return nil, nil
+}
+
+func (service *activeModerationService) CheckLoginAllowed(ctx context.Context, userId uuid.UUID) error {
+	return nil
+}
+
+func (service *activeModerationService) GetState(userId uuid.UUID) models.ModerationState {
+	return models.ModerationActive
+}
+
+func (service *activeModerationService) HiddenAuthors(viewerId uuid.UUID, authorIds []uuid.UUID) map[uuid.UUID]bool {
+	return nil
+}
+
+func (service *activeModerationService) SyncCache(ctx context.Context) error {
+	return nil
+}
+
+// Сценарий задается зерном, чтобы упавший случай воспроизводился по выводу quick
+type feedScenario struct {
+	Seed int64
+}
+
+func (feedScenario) Generate(random *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(feedScenario{Seed: random.Int63()})
+}
+
+// Состояние сценария: сервис лент поверх Redis в памяти и БД в памяти
+type feedHarness struct {
+	random   *rand.Rand
+	server   *miniredis.Miniredis
+	service  FeedService
+	posts    *memoryPostRepository
+	friends  *memoryFriendShipRepository
+	userIds  []uuid.UUID
+	start    time.Time
+	lastTime time.Time
+}
+
+func newFeedHarness(server *miniredis.Miniredis, seed int64) *feedHarness {
+	server.FlushAll()
+
+	cnf := &config.Config{FeedConfig: config.FeedConfig{
+		FanOutThreshold:  propertyThreshold,
+		RankWindow:       200,
+		BuildLockTTL:     10 * time.Second,
+		BuildWaitTimeout: time.Second,
+		RevalidateAfter:  time.Hour,
+	}}
+	posts := &memoryPostRepository{posts: make(map[uuid.UUID]*models.Post)}
+	friends := &memoryFriendShipRepository{friends: make(map[uuid.UUID]map[uuid.UUID]bool)}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	harness := &feedHarness{
+		random:   rand.New(rand.NewSource(seed)),
+		server:   server,
+		service:  InitFeedService(cnf, feed.NewFeedCache(propertyThreshold), posts, friends, &activeModerationService{}),
+		posts:    posts,
+		friends:  friends,
+		start:    start,
+		lastTime: start,
+	}
+	for i := 0; i < propertyUsers; i++ {
+		harness.userIds = append(harness.userIds, harness.newId())
+	}
+
+	// Начальные друзья: у части пользователей друзей больше порога рассылки
+	for i := range harness.userIds {
+		for j := i + 1; j < len(harness.userIds); j++ {
+			if harness.random.Intn(2) == 0 {
+				_ = friends.Add(context.Background(), harness.userIds[i], harness.userIds[j])
+			}
+		}
+	}
+
+	return harness
+}
+
+// Время нового поста с точностью БД (микросекунды). Посты часто публикуются
+// в одну микросекунду, иногда - с опозданием, задним числом
+func (harness *feedHarness) nextTime() time.Time {
+	if harness.random.Intn(10) == 0 {
+		delay := harness.random.Int63n(int64(harness.lastTime.Sub(harness.start)) + 1)
+		return harness.lastTime.Add(-time.Duration(delay)).Truncate(time.Microsecond)
+	}
+
+	harness.lastTime = harness.lastTime.Add(time.Duration(harness.random.Intn(3)) * time.Microsecond)
+
+	return harness.lastTime
+}
+
+// Идентификаторы тоже зависят только от зерна
+func (harness *feedHarness) newId() uuid.UUID {
+	return uuid.Must(uuid.NewRandomFromReader(harness.random))
+}
+
+func (harness *feedHarness) newPost(authorId uuid.UUID) *models.Post {
+	post := &models.Post{
+		Id:        harness.newId(),
+		UserId:    authorId,
+		Title:     "title",
+		Content:   "content",
+		CreatedAt: harness.nextTime(),
+	}
+	harness.posts.posts[post.Id] = post
+
+	return post
+}
+
+func (harness *feedHarness) randomUser() uuid.UUID {
+	return harness.userIds[harness.random.Intn(len(harness.userIds))]
+}
+
+func (harness *feedHarness) randomPost() *models.Post {
+	if len(harness.posts.posts) == 0 {
+		return nil
+	}
+
+	// Порядок обхода map случаен, но не зависит от зерна
+	postIds := make([]string, 0, len(harness.posts.posts))
+	for postId := range harness.posts.posts {
+		postIds = append(postIds, postId.String())
+	}
+	sort.Strings(postIds)
+
+	return harness.posts.posts[uuid.MustParse(postIds[harness.random.Intn(len(postIds))])]
+}
+
+// Лента пользователя по данным БД: его посты и посты друзей в порядке ленты
+func (harness *feedHarness) expectedFeed(userId uuid.UUID) []*models.Post {
+	friendIds, _ := harness.friends.GetFriendsByUserId(context.Background(), userId)
+	posts, _ := harness.posts.GetListByUserIds(context.Background(), append(friendIds, userId), nil, len(harness.posts.posts))
+
+	return posts
+}
+
+// Случайный шаг сценария; возвращает описание нарушенного свойства
+func (harness *feedHarness) step() error {
+	ctx := context.Background()
+
+	switch op := harness.random.Intn(100); {
+	case op < 40:
+		// Публикация поста и обработка события
+		post := harness.newPost(harness.randomUser())
+		return harness.service.AddPostToFeed(ctx, post.UserId, post)
+	case op < 45:
+		// Посты, опубликованные до потери кеша Redis
+		for i := harness.random.Intn(feed.FeedSize + feed.FeedSize/2); i > 0; i-- {
+			harness.newPost(harness.randomUser())
+		}
+		harness.server.FlushAll()
+	case op < 55:
+		post := harness.randomPost()
+		if post == nil {
+			return nil
+		}
+		delete(harness.posts.posts, post.Id)
+		return harness.service.DeletePostInFeeds(ctx, post.UserId, post)
+	case op < 58:
+		harness.server.FlushAll()
+	case op < 63:
+		// Вытеснение содержимого постов из кеша
+		for _, key := range harness.server.Keys() {
+			if len(key) > 5 && key[:5] == "post:" && harness.random.Intn(2) == 0 {
+				harness.server.Del(key)
+			}
+		}
+	case op < 75:
+		userId, friendId := harness.randomUser(), harness.randomUser()
+		if userId == friendId {
+			return nil
+		}
+		isFriend := !harness.friends.friends[userId][friendId]
+		if isFriend {
+			_ = harness.friends.Add(ctx, userId, friendId)
+		} else {
+			_ = harness.friends.Delete(ctx, userId, friendId)
+		}
+		return harness.service.UpdateUserFeedByAddedFriend(ctx, userId, friendId, isFriend)
+	default:
+		return harness.checkRead(harness.randomUser())
+	}
+
+	return nil
+}
+
+// Постраничное чтение ленты случайными страницами совпадает с лентой по БД:
+// без пропусков и повторов. Несобранная лента при первом чтении собирается
+// ровно из последних min(FeedSize, N) постов
+func (harness *feedHarness) checkRead(userId uuid.UUID) error {
+	ctx := context.Background()
+	expected := harness.expectedFeed(userId)
+	cold := !harness.server.Exists(cache.FeedCompleteKey(userId.String()))
+
+	var got []*models.Post
+	var cursor *models.FeedCursor
+	for page := 0; ; page++ {
+		limit := 1 + harness.random.Intn(60)
+		posts, next, err := harness.service.GetFeed(ctx, userId, cursor, limit)
+		if err != nil {
+			return err
+		}
+
+		if page == 0 && cold {
+			if err = harness.checkWindow(userId, expected); err != nil {
+				return err
+			}
+		}
+
+		if len(posts) > limit {
+			return fmt.Errorf("страница из %d постов при limit %d", len(posts), limit)
+		}
+		if next != nil && len(posts) != limit {
+			return fmt.Errorf("неполная страница %d из %d с курсором следующей", len(posts), limit)
+		}
+		got = append(got, posts...)
+
+		if next == nil {
+			break
+		}
+		if len(got) > len(expected) {
+			return fmt.Errorf("получено %d постов, в ленте %d", len(got), len(expected))
+		}
+		cursor = next
+	}
+
+	if len(got) != len(expected) {
+		return fmt.Errorf("получено %d постов, в ленте %d", len(got), len(expected))
+	}
+	for i := range expected {
+		if got[i].Id != expected[i].Id {
+			return fmt.Errorf("пост %d: получен %s, ожидался %s", i, got[i].Id, expected[i].Id)
+		}
+	}
+
+	return nil
+}
+
+// Собранная лента в кеше - ровно окно из последних постов
+func (harness *feedHarness) checkWindow(userId uuid.UUID, expected []*models.Post) error {
+	window := expected
+	if len(window) > feed.FeedSize {
+		window = window[:feed.FeedSize]
+	}
+
+	var members []string
+	if harness.server.Exists(cache.FeedKey(userId.String())) {
+		var err error
+		members, err = harness.server.ZMembers(cache.FeedKey(userId.String()))
+		if err != nil {
+			return err
+		}
+	}
+	if len(members) != len(window) {
+		return fmt.Errorf("в собранной ленте %d постов вместо %d", len(members), len(window))
+	}
+
+	for i, post := range window {
+		// ZMembers возвращает элементы по возрастанию
+		if members[len(members)-1-i] != post.Id.String() {
+			return fmt.Errorf("пост %d собранной ленты: %s вместо %s", i, members[len(members)-1-i], post.Id)
+		}
+	}
+
+	return nil
+}
+
+func TestFeedPaginationProperty(t *testing.T) {
+	server := miniredis.RunT(t)
+	port, err := strconv.Atoi(server.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cnf := &config.Config{RedisConfig: config.RedisConfig{RedisHost: server.Host(), RedisPort: port}}
+	if err = cache.InitRedis(cnf); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = cache.Close() })
+
+	steps := 50
+	maxCount := 15
+	if testing.Short() {
+		steps, maxCount = 30, 5
+	}
+
+	property := func(scenario feedScenario) bool {
+		harness := newFeedHarness(server, scenario.Seed)
+		for i := 0; i < steps; i++ {
+			if err := harness.step(); err != nil {
+				t.Logf("зерно %d, шаг %d: %v", scenario.Seed, i, err)
+				return false
+			}
+		}
+
+		// В конце лента каждого пользователя читается полностью
+		for _, userId := range harness.userIds {
+			if err := harness.checkRead(userId); err != nil {
+				t.Logf("зерно %d, итоговое чтение: %v", scenario.Seed, err)
+				return false
+			}
+		}
+
+		return true
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: maxCount}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ранжирование, порядок которого меняется при каждом вызове, как при новых
+// реакциях между запросами страниц
+type shufflingRanker struct {
+	random *rand.Rand
+}
+
+func (ranker *shufflingRanker) Mode() string {
+	return "shuffling"
+}
+
+func (ranker *shufflingRanker) Rank(ctx context.Context, userId uuid.UUID, posts []*models.Post, rankedAt time.Time) ([]*models.Post, error) {
+	ranked := append([]*models.Post(nil), posts...)
+	ranker.random.Shuffle(len(ranked), func(i, j int) { ranked[i], ranked[j] = ranked[j], ranked[i] })
+
+	return ranked, nil
+}
+
+// Страницы ранжированной ленты одного курсора читаются из сохраненного порядка:
+// без повторов и пропусков, даже если оценки постов изменились
+func TestRankedFeedPagesKeepOrder(t *testing.T) {
+	server := miniredis.RunT(t)
+	port, err := strconv.Atoi(server.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cnf := &config.Config{
+		RedisConfig: config.RedisConfig{RedisHost: server.Host(), RedisPort: port},
+		FeedConfig: config.FeedConfig{
+			FanOutThreshold:  propertyThreshold,
+			RankWindow:       200,
+			BuildLockTTL:     10 * time.Second,
+			BuildWaitTimeout: time.Second,
+			RevalidateAfter:  time.Hour,
+		},
+	}
+	if err = cache.InitRedis(cnf); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = cache.Close() })
+
+	userId := uuid.New()
+	posts := &memoryPostRepository{posts: make(map[uuid.UUID]*models.Post)}
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Microsecond)
+	for i := 0; i < 20; i++ {
+		post := &models.Post{Id: uuid.New(), UserId: userId, Title: "title", Content: "content", CreatedAt: start.Add(time.Duration(i) * time.Second)}
+		posts.posts[post.Id] = post
+	}
+
+	ranker := &shufflingRanker{random: rand.New(rand.NewSource(1))}
+	feedService := InitFeedService(cnf, feed.NewFeedCache(propertyThreshold), posts,
+		&memoryFriendShipRepository{friends: make(map[uuid.UUID]map[uuid.UUID]bool)}, &activeModerationService{}, ranker)
+
+	seen := make(map[uuid.UUID]bool)
+	var cursor *models.RankedFeedCursor
+	for {
+		page, next, err := feedService.GetRankedFeed(context.Background(), userId, ranker.Mode(), cursor, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, post := range page {
+			if seen[post.Id] {
+				t.Fatalf("пост %s повторился на следующей странице", post.Id)
+			}
+			seen[post.Id] = true
+		}
+
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+
+	if len(seen) != len(posts.posts) {
+		t.Errorf("получено %d постов из %d", len(seen), len(posts.posts))
+	}
+}
+
+// Событие удаления аккаунта убирает его посты из лент друзей и удаляет кеш постов
+func TestAccountDeletedEventPurgesFeeds(t *testing.T) {
+	server := miniredis.RunT(t)
+	port, err := strconv.Atoi(server.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cnf := &config.Config{RedisConfig: config.RedisConfig{RedisHost: server.Host(), RedisPort: port}}
+	if err = cache.InitRedis(cnf); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = cache.Close() })
+
+	userId, friendId, postId, otherPostId := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	friendFeed := cache.FeedKey(friendId.String())
+	if _, err = server.ZAdd(friendFeed, 1, postId.String()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = server.ZAdd(friendFeed, 2, otherPostId.String()); err != nil {
+		t.Fatal(err)
+	}
+	if err = server.Set(cache.PostKey(postId.String()), "{}"); err != nil {
+		t.Fatal(err)
+	}
+
+	feedService := InitFeedService(cnf, feed.NewFeedCache(propertyThreshold), &memoryPostRepository{posts: make(map[uuid.UUID]*models.Post)},
+		&memoryFriendShipRepository{friends: make(map[uuid.UUID]map[uuid.UUID]bool)}, &activeModerationService{})
+
+	event, err := models.NewEvent(models.EventAccountDeleted, &models.AccountDeletedEvent{UserId: userId, PostIds: []uuid.UUID{postId}, FriendIds: []uuid.UUID{friendId}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = feedService.HandleEvent(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	members, err := server.ZMembers(friendFeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0] != otherPostId.String() {
+		t.Errorf("лента друга после удаления аккаунта: %v", members)
+	}
+	if server.Exists(cache.PostKey(postId.String())) {
+		t.Error("пост удаленного аккаунта остался в кеше")
+	}
+}
@@ -18,12 +18,11 @@ type FriendShipService interface {
 type friendShipService struct {
 	userRepository   repository.UserRepository
 	friendRepository repository.FriendShipRepository
-	feedService      FeedService
 }
 
-// Инициализация сервиса добавления/удаления друзей
-func InitFriendShipService(userRepository repository.UserRepository, friendRepository repository.FriendShipRepository, feedService FeedService) FriendShipService {
-	return &friendShipService{userRepository: userRepository, friendRepository: friendRepository, feedService: feedService}
+// Инициализация сервиса добавления/удаления друзей. Ленты обновляются по событиям outbox
+func InitFriendShipService(userRepository repository.UserRepository, friendRepository repository.FriendShipRepository) FriendShipService {
+	return &friendShipService{userRepository: userRepository, friendRepository: friendRepository}
 }
 
 // Добавление пользователя в список друзей
@@ -42,19 +41,7 @@ func (service *friendShipService) AddFiend(ctx context.Context, userId uuid.UUID
 	}
 
 	ctx = database.WithMaster(ctx)
-	err = service.friendRepository.Add(ctx, userId, friendId)
-	if err != nil {
-		return err
-	}
-
-	go func() {
-		err := service.feedService.UpdateUserFeedByAddedFriend(ctx, userId, friendId, true)
-		if err != nil {
-			// Логгируем ошибку
-		}
-	}()
-
-	return nil
+	return service.friendRepository.Add(ctx, userId, friendId)
 }
 
 // Удаление пользователя из списка друзей
@@ -64,19 +51,7 @@ func (service *friendShipService) Delete(ctx context.Context, userId uuid.UUID,
 		return fmt.Errorf("Вы не можете удалить себя из списка друзей")
 	}
 
-	err := service.friendRepository.Delete(ctx, userId, friendId)
-	if err != nil {
-		return err
-	}
-
-	go func() {
-		err := service.feedService.UpdateUserFeedByAddedFriend(ctx, userId, friendId, false)
-		if err != nil {
-			// Логгируем ошибку
-		}
-	}()
-
-	return nil
+	return service.friendRepository.Delete(ctx, userId, friendId)
 }
 
 // Список друзей
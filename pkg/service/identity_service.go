@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"social-network/internal/notify"
+	"social-network/internal/security"
+	"social-network/pkg/database"
+	"social-network/pkg/models"
+	"social-network/pkg/repository"
+	"social-network/pkg/utils"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	verificationCodeLength      = 6
+	verificationCodeTTL         = 15 * time.Minute
+	verificationCodeMaxAttempts = 5
+	// Пауза между отправками кода и лимит отправок на идентификатор за сутки
+	verificationCodeCooldown = time.Minute
+	verificationCodeMaxSends = 5
+	verificationCodeWindow   = 24 * time.Hour
+	// Лимит отправок кодов одному пользователю на все его идентификаторы за сутки
+	verificationUserMaxSends = 10
+)
+
+type IdentityService interface {
+	AddIdentity(ctx context.Context, userId uuid.UUID, request *models.AddIdentityRequest) (*models.LoginIdentity, error)
+	ResendCode(ctx context.Context, userId, identityId uuid.UUID) error
+	Verify(ctx context.Context, userId, identityId uuid.UUID, code string) error
+	GetIdentities(ctx context.Context, userId uuid.UUID) ([]*models.LoginIdentity, error)
+	DeleteIdentity(ctx context.Context, userId, identityId uuid.UUID) error
+}
+
+type identityService struct {
+	identityRepository repository.IdentityRepository
+	notifier           notify.Notifier
+	sendLimiter        *security.RateLimiter
+}
+
+// Инициализация сервиса идентификаторов для входа (email, телефон)
+func InitIdentityService(identityRepository repository.IdentityRepository, notifier notify.Notifier) IdentityService {
+	return &identityService{
+		identityRepository: identityRepository,
+		notifier:           notifier,
+		sendLimiter:        security.NewRateLimiter("verification_send", verificationUserMaxSends, verificationCodeWindow),
+	}
+}
+
+// Привязка email/телефона и отправка кода подтверждения
+func (service *identityService) AddIdentity(ctx context.Context, userId uuid.UUID, request *models.AddIdentityRequest) (*models.LoginIdentity, error) {
+	value, err := normalizeIdentity(request.Kind, request.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = database.WithMaster(ctx)
+	existing, err := service.identityRepository.GetVerified(ctx, request.Kind, value)
+	if err == nil {
+		if existing.UserId == userId {
+			return nil, repository.ErrIdentityExists
+		}
+		return nil, repository.ErrIdentityTaken
+	}
+
+	err = service.sendLimiter.Allow(ctx, userId.String())
+	if err != nil {
+		return nil, err
+	}
+
+	identity := models.LoginIdentity{
+		Id:     uuid.New(),
+		UserId: userId,
+		Kind:   request.Kind,
+		Value:  value,
+	}
+
+	err = service.identityRepository.Create(ctx, &identity)
+	if err != nil {
+		return nil, err
+	}
+
+	err = service.sendCode(ctx, &identity)
+	if err != nil {
+		return nil, err
+	}
+
+	return &identity, nil
+}
+
+// Повторная отправка кода подтверждения
+func (service *identityService) ResendCode(ctx context.Context, userId, identityId uuid.UUID) error {
+	ctx = database.WithMaster(ctx)
+	identity, err := service.getOwnIdentity(ctx, userId, identityId)
+	if err != nil {
+		return err
+	}
+
+	if identity.IsVerified() {
+		return fmt.Errorf("Идентификатор уже подтвержден")
+	}
+
+	err = service.sendLimiter.Allow(ctx, userId.String())
+	if err != nil {
+		return err
+	}
+
+	return service.sendCode(ctx, identity)
+}
+
+// Подтверждение идентификатора кодом
+func (service *identityService) Verify(ctx context.Context, userId, identityId uuid.UUID, code string) error {
+	ctx = database.WithMaster(ctx)
+	identity, err := service.getOwnIdentity(ctx, userId, identityId)
+	if err != nil {
+		return err
+	}
+
+	if identity.IsVerified() {
+		return nil
+	}
+
+	// Попытка учитывается до сравнения кода, в том числе для верного кода
+	verification, err := service.identityRepository.UseAttempt(ctx, identityId, verificationCodeMaxAttempts)
+	if err != nil {
+		return err
+	}
+
+	if time.Now().After(verification.ExpiresAt) {
+		return fmt.Errorf("Срок действия кода истек, запросите новый код")
+	}
+
+	if !utils.CheckSecret(code, verification.CodeHash) {
+		return fmt.Errorf("Код подтверждения указан неверно")
+	}
+
+	return service.identityRepository.MarkVerified(ctx, identityId)
+}
+
+func (service *identityService) GetIdentities(ctx context.Context, userId uuid.UUID) ([]*models.LoginIdentity, error) {
+	ctx = database.WithMaster(ctx)
+
+	return service.identityRepository.GetListByUserId(ctx, userId)
+}
+
+func (service *identityService) DeleteIdentity(ctx context.Context, userId, identityId uuid.UUID) error {
+	ctx = database.WithMaster(ctx)
+
+	return service.identityRepository.Delete(ctx, identityId, userId)
+}
+
+func (service *identityService) getOwnIdentity(ctx context.Context, userId, identityId uuid.UUID) (*models.LoginIdentity, error) {
+	identity, err := service.identityRepository.GetById(ctx, identityId)
+	if err != nil {
+		return nil, err
+	}
+
+	if identity.UserId != userId {
+		return nil, fmt.Errorf("Идентификатор не найден")
+	}
+
+	return identity, nil
+}
+
+// Генерация, сохранение (в виде хеша) и отправка кода подтверждения
+func (service *identityService) sendCode(ctx context.Context, identity *models.LoginIdentity) error {
+	code, err := utils.GenerateNumericCode(verificationCodeLength)
+	if err != nil {
+		return err
+	}
+
+	err = service.identityRepository.SaveCode(ctx, &models.VerificationCode{
+		IdentityId: identity.Id,
+		CodeHash:   utils.HashSecret(code),
+		ExpiresAt:  time.Now().UTC().Add(verificationCodeTTL),
+	}, repository.VerificationLimits{
+		Cooldown: verificationCodeCooldown,
+		MaxSends: verificationCodeMaxSends,
+		Window:   verificationCodeWindow,
+	})
+	if err != nil {
+		return err
+	}
+
+	return service.notifier.Send(ctx, &notify.Message{
+		Channel: string(identity.Kind),
+		To:      identity.Value,
+		Subject: "Код подтверждения",
+		Body:    fmt.Sprintf("Ваш код подтверждения: %s. Код действует %d минут.", code, int(verificationCodeTTL.Minutes())),
+	})
+}
+
+// Проверка и нормализация значения идентификатора по его типу
+func normalizeIdentity(kind models.IdentityKind, value string) (string, error) {
+	switch kind {
+	case models.IdentityEmail:
+		return utils.NormalizeEmail(value)
+	case models.IdentityPhone:
+		return utils.NormalizePhone(value)
+	default:
+		return "", fmt.Errorf("Тип идентификатора должен быть email или phone")
+	}
+}
@@ -0,0 +1,275 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"social-network/internal/cache"
+	"social-network/pkg/database"
+	"social-network/pkg/models"
+	"social-network/pkg/repository"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
+)
+
+const maxModerationReasonLength = 1000
+
+// Вход запрещен: аккаунт заблокирован модератором
+type SuspendedError struct {
+	Reason    string
+	ExpiresAt *time.Time
+}
+
+func (err *SuspendedError) Error() string {
+	if err.ExpiresAt == nil {
+		return fmt.Sprintf("Аккаунт заблокирован: %s", err.Reason)
+	}
+
+	return fmt.Sprintf("Аккаунт заблокирован до %s: %s", err.ExpiresAt.Format(time.RFC3339), err.Reason)
+}
+
+var ErrCannotModerateSelf = errors.New("Нельзя изменить состояние собственного аккаунта")
+
+type ModerationService interface {
+	SetState(ctx context.Context, actorId, userId uuid.UUID, request *models.ModerationRequest, ip string) (*models.ModerationAction, error)
+	GetModeration(ctx context.Context, userId uuid.UUID) (*models.ModerationResponse, error)
+	CheckLoginAllowed(ctx context.Context, userId uuid.UUID) error
+	GetState(userId uuid.UUID) models.ModerationState
+	HiddenAuthors(viewerId uuid.UUID, authorIds []uuid.UUID) map[uuid.UUID]bool
+	SyncCache(ctx context.Context) error
+}
+
+type moderationService struct {
+	moderationRepository repository.ModerationRepository
+	auditRepository      repository.AuditRepository
+	syncs                singleflight.Group
+}
+
+// Инициализация сервиса модерации пользователей. Действующие ограничения дублируются
+// в Redis (ключ живет до окончания срока), чтобы проверять их на каждом запросе;
+// источник истины - БД
+func InitModerationService(moderationRepository repository.ModerationRepository, auditRepository repository.AuditRepository) ModerationService {
+	return &moderationService{
+		moderationRepository: moderationRepository,
+		auditRepository:      auditRepository,
+	}
+}
+
+// Изменение состояния пользователя модератором. Для ограничений обязательны причина и срок
+func (service *moderationService) SetState(ctx context.Context, actorId, userId uuid.UUID, request *models.ModerationRequest, ip string) (*models.ModerationAction, error) {
+	if actorId == userId {
+		return nil, ErrCannotModerateSelf
+	}
+
+	if !request.State.IsValid() {
+		return nil, fmt.Errorf("Недопустимое состояние: %s", request.State)
+	}
+
+	reason := strings.TrimSpace(request.Reason)
+	if reason == "" || len(reason) > maxModerationReasonLength {
+		return nil, fmt.Errorf("Причина обязательна и должна быть не длиннее %d символов", maxModerationReasonLength)
+	}
+
+	now := time.Now().UTC()
+	action := models.ModerationAction{
+		Id:      uuid.New(),
+		UserId:  userId,
+		State:   request.State,
+		Reason:  reason,
+		ActorId: actorId,
+	}
+
+	if request.State != models.ModerationActive {
+		expiresAt := request.ExpiresAt.UTC()
+		if !expiresAt.After(now) {
+			return nil, fmt.Errorf("Срок ограничения должен быть в будущем")
+		}
+		action.ExpiresAt = &expiresAt
+	}
+
+	ctx = database.WithMaster(ctx)
+	err := service.moderationRepository.Add(ctx, &action)
+	if err != nil {
+		return nil, err
+	}
+
+	// Без записи в кеш отметка о синхронизации неверна: сбрасываем ее, чтобы
+	// следующее чтение взяло ограничения из БД
+	err = service.cacheState(&action, now)
+	if err != nil {
+		log.Printf("Не удалось сохранить состояние пользователя %s в кеше: %v", userId, err)
+		if err = cache.ClearModerationSynced(); err != nil {
+			log.Printf("Не удалось сбросить отметку о синхронизации ограничений: %v", err)
+		}
+	}
+
+	details := map[string]interface{}{
+		"state":  action.State,
+		"reason": action.Reason,
+	}
+	if action.ExpiresAt != nil {
+		details["expires_at"] = action.ExpiresAt
+	}
+
+	err = service.auditRepository.Add(ctx, &models.AuditEvent{
+		Event:   models.AuditModerationChanged,
+		UserId:  userId,
+		ActorId: actorId,
+		IP:      ip,
+		Details: details,
+	})
+	if err != nil {
+		log.Printf("Не удалось записать событие %s в журнал аудита: %v", models.AuditModerationChanged, err)
+	}
+
+	return &action, nil
+}
+
+func (service *moderationService) GetModeration(ctx context.Context, userId uuid.UUID) (*models.ModerationResponse, error) {
+	ctx = database.WithMaster(ctx)
+	current, err := service.moderationRepository.GetCurrent(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := service.moderationRepository.GetHistory(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ModerationResponse{
+		UserId:  userId.String(),
+		State:   current.StateAt(time.Now().UTC()),
+		Current: current,
+		History: history,
+	}, nil
+}
+
+// Проверка при входе (по БД): заблокированным пользователям вход запрещен
+func (service *moderationService) CheckLoginAllowed(ctx context.Context, userId uuid.UUID) error {
+	current, err := service.moderationRepository.GetCurrent(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	if current.StateAt(time.Now().UTC()) == models.ModerationSuspended {
+		return &SuspendedError{Reason: current.Reason, ExpiresAt: current.ExpiresAt}
+	}
+
+	return nil
+}
+
+// Действующее состояние пользователя
+func (service *moderationService) GetState(userId uuid.UUID) models.ModerationState {
+	state, ok := service.getStates([]uuid.UUID{userId})[userId]
+	if !ok {
+		return models.ModerationActive
+	}
+
+	return state
+}
+
+// Авторы, контент которых скрыт от зрителя viewerId
+func (service *moderationService) HiddenAuthors(viewerId uuid.UUID, authorIds []uuid.UUID) map[uuid.UUID]bool {
+	hidden := make(map[uuid.UUID]bool)
+	states := service.getStates(authorIds)
+	for _, authorId := range authorIds {
+		state, ok := states[authorId]
+		if ok && !state.ContentVisibleTo(authorId == viewerId) {
+			hidden[authorId] = true
+		}
+	}
+
+	return hidden
+}
+
+// Ограничения пользователей userIds; пользователи без ограничений в ответ не попадают.
+// Ограничения берутся из Redis, пока в нем есть отметка о синхронизации с БД. Без
+// нее (после очистки Redis) или при недоступности Redis ограничения читаются из БД,
+// и кеш заполняется заново
+func (service *moderationService) getStates(userIds []uuid.UUID) map[uuid.UUID]models.ModerationState {
+	ids := make([]string, len(userIds))
+	for i, userId := range userIds {
+		ids[i] = userId.String()
+	}
+
+	states := make(map[uuid.UUID]models.ModerationState)
+	cached, synced, err := cache.GetModerationStates(ids)
+	if err == nil && synced {
+		for _, userId := range userIds {
+			if state, ok := cached[userId.String()]; ok {
+				states[userId] = models.ModerationState(state)
+			}
+		}
+
+		return states
+	}
+
+	restricted, err := service.syncCache(context.Background())
+	if err != nil {
+		log.Printf("Не удалось восстановить ограничения пользователей в кеше: %v", err)
+	}
+	for _, userId := range userIds {
+		if state, ok := restricted[userId]; ok {
+			states[userId] = state
+		}
+	}
+
+	return states
+}
+
+// Восстановление действующих ограничений в Redis (при запуске приложения и после
+// очистки Redis)
+func (service *moderationService) SyncCache(ctx context.Context) error {
+	_, err := service.syncCache(ctx)
+
+	return err
+}
+
+// Загрузка действующих ограничений из БД и их запись в Redis с отметкой о
+// синхронизации. Одновременные загрузки выполняются один раз. Ограничения
+// возвращаются, даже если записать их в Redis не удалось
+func (service *moderationService) syncCache(ctx context.Context) (map[uuid.UUID]models.ModerationState, error) {
+	result, err, _ := service.syncs.Do("sync", func() (interface{}, error) {
+		now := time.Now().UTC()
+		actions, err := service.moderationRepository.GetRestricted(database.WithMaster(ctx), now)
+		if err != nil {
+			return nil, err
+		}
+
+		states := make(map[uuid.UUID]models.ModerationState, len(actions))
+		for _, action := range actions {
+			states[action.UserId] = action.StateAt(now)
+		}
+
+		for _, action := range actions {
+			if err = service.cacheState(action, now); err != nil {
+				return states, err
+			}
+		}
+
+		return states, cache.MarkModerationSynced()
+	})
+
+	states, _ := result.(map[uuid.UUID]models.ModerationState)
+
+	return states, err
+}
+
+func (service *moderationService) cacheState(action *models.ModerationAction, now time.Time) error {
+	state := action.StateAt(now)
+	if state == models.ModerationActive {
+		return cache.ClearModerationState(action.UserId.String())
+	}
+
+	var ttl time.Duration
+	if action.ExpiresAt != nil {
+		ttl = action.ExpiresAt.Sub(now)
+	}
+
+	return cache.SetModerationState(action.UserId.String(), string(state), ttl)
+}
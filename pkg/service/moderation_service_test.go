@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"social-network/internal/cache"
+	"social-network/internal/config"
+	"social-network/pkg/models"
+	"social-network/pkg/repository"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+)
+
+// Действующие ограничения в памяти вместо таблицы moderation_actions
+type memoryModerationRepository struct {
+	repository.ModerationRepository
+	actions []*models.ModerationAction
+}
+
+func (repository *memoryModerationRepository) GetRestricted(ctx context.Context, now time.Time) ([]*models.ModerationAction, error) {
+	var restricted []*models.ModerationAction
+	for _, action := range repository.actions {
+		if action.StateAt(now) != models.ModerationActive {
+			restricted = append(restricted, action)
+		}
+	}
+
+	return restricted, nil
+}
+
+// Ограничения действуют и после потери кеша в Redis
+func TestModerationStateAfterRedisFlush(t *testing.T) {
+	server := miniredis.RunT(t)
+	port, err := strconv.Atoi(server.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cnf := &config.Config{RedisConfig: config.RedisConfig{RedisHost: server.Host(), RedisPort: port}}
+	if err = cache.InitRedis(cnf); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = cache.Close() })
+
+	suspendedId, shadowBannedId, activeId := uuid.New(), uuid.New(), uuid.New()
+	moderationRepository := &memoryModerationRepository{actions: []*models.ModerationAction{
+		{Id: uuid.New(), UserId: suspendedId, State: models.ModerationSuspended},
+		{Id: uuid.New(), UserId: shadowBannedId, State: models.ModerationShadowBanned},
+	}}
+	moderationService := InitModerationService(moderationRepository, nil)
+
+	check := func(stage string) {
+		t.Helper()
+		if state := moderationService.GetState(suspendedId); state != models.ModerationSuspended {
+			t.Errorf("%s: состояние заблокированного пользователя %s", stage, state)
+		}
+		if state := moderationService.GetState(activeId); state != models.ModerationActive {
+			t.Errorf("%s: состояние пользователя без ограничений %s", stage, state)
+		}
+
+		hidden := moderationService.HiddenAuthors(activeId, []uuid.UUID{suspendedId, shadowBannedId, activeId})
+		if !hidden[suspendedId] || !hidden[shadowBannedId] || hidden[activeId] {
+			t.Errorf("%s: скрыты авторы %v", stage, hidden)
+		}
+	}
+
+	if err = moderationService.SyncCache(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	check("кеш заполнен")
+
+	server.FlushAll()
+	check("после очистки Redis")
+	if !server.Exists(cache.ModerationKey(suspendedId.String())) {
+		t.Error("после очистки Redis ограничения не восстановлены в кеше")
+	}
+
+	server.Close()
+	check("Redis недоступен")
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"social-network/internal/cache"
+	"social-network/internal/config"
+	"social-network/pkg/database"
+	"social-network/pkg/models"
+	"social-network/pkg/repository"
+	"social-network/pkg/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	maxMentionsPerPost      = 10               // Уведомления получают не больше 10 упомянутых
+	notificationsBatchSize  = 1000             // Сколько событий журнала читается за раз
+	streamConnectionTimeout = 30 * time.Second // Без продления место потока освобождается
+)
+
+var (
+	ErrInvalidEventId = errors.New("Некорректный Last-Event-ID")
+	ErrTooManyStreams = errors.New("Превышено число одновременных подключений")
+)
+
+// Идентификатор записи Redis stream и идентификатор, предшествующий любой записи
+var streamIdPattern = regexp.MustCompile(`^[0-9]+-[0-9]+$`)
+
+const notificationsStartingId = "0-0"
+
+type NotificationService interface {
+	HandleEvent(ctx context.Context, event *models.Event) error
+	GetAfter(userId uuid.UUID, lastId string) ([]*models.Notification, error)
+	GetLastId(userId uuid.UUID) (string, error)
+	AcquireStream(userId uuid.UUID) error
+	RefreshStream(userId uuid.UUID)
+	ReleaseStream(userId uuid.UUID)
+}
+
+type notificationService struct {
+	config            *config.Config
+	userRepository    repository.UserRepository
+	moderationService ModerationService
+}
+
+// Инициализация сервиса уведомлений пользователей
+func InitNotificationService(config *config.Config, userRepository repository.UserRepository, moderationService ModerationService) NotificationService {
+	return &notificationService{config: config, userRepository: userRepository, moderationService: moderationService}
+}
+
+// Обработка события очереди: заявки в друзья и упоминания в постах.
+// Уведомления о новых постах в ленте пишутся при рассылке поста
+func (service *notificationService) HandleEvent(ctx context.Context, event *models.Event) error {
+	switch event.Type {
+	case models.EventFriendAdded:
+		var friendEvent models.FriendEvent
+		if err := event.Decode(&friendEvent); err != nil {
+			return err
+		}
+
+		return service.notify([]uuid.UUID{friendEvent.FriendId}, models.NotificationFriendRequest, &models.FriendRequestNotification{UserId: friendEvent.UserId})
+	case models.EventPostCreated:
+		var post models.Post
+		if err := event.Decode(&post); err != nil {
+			return err
+		}
+
+		return service.notifyMentions(ctx, &post)
+	}
+
+	return nil
+}
+
+// Уведомления упомянутым в посте пользователям. Упоминания в скрытом модератором
+// контенте не рассылаются
+func (service *notificationService) notifyMentions(ctx context.Context, post *models.Post) error {
+	if service.moderationService.GetState(post.UserId) != models.ModerationActive {
+		return nil
+	}
+
+	usernames := utils.ExtractMentions(post.Title+"\n"+post.Content, maxMentionsPerPost)
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	ctx = database.WithReplica(ctx)
+	var userIds []uuid.UUID
+	for _, username := range usernames {
+		user, err := service.userRepository.GetUserByUsername(ctx, username)
+		if err != nil || user == nil || user.Id == post.UserId {
+			continue
+		}
+		userIds = append(userIds, user.Id)
+	}
+
+	return service.notify(userIds, models.NotificationMention, post)
+}
+
+// Запись события в журналы пользователей userIds
+func (service *notificationService) notify(userIds []uuid.UUID, eventType string, payload interface{}) error {
+	if len(userIds) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	pipe := cache.Pipeline()
+	for _, userId := range userIds {
+		cache.AddNotification(pipe, userId.String(), eventType, data)
+	}
+	_, err = pipe.Exec(context.Background())
+
+	return err
+}
+
+// События журнала после lastId. Если часть из них уже вытеснена из журнала,
+// первым возвращается событие reset с идентификатором последней записи
+func (service *notificationService) GetAfter(userId uuid.UUID, lastId string) ([]*models.Notification, error) {
+	if !streamIdPattern.MatchString(lastId) {
+		return nil, ErrInvalidEventId
+	}
+
+	firstId, latestId, err := cache.GetNotificationsBounds(userId.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if lastId == notificationsStartingId {
+		lastId = ""
+	}
+	if latestId == "" || (lastId != "" && compareStreamIds(lastId, latestId) >= 0) {
+		return nil, nil
+	}
+	if lastId != "" && compareStreamIds(lastId, firstId) < 0 {
+		return []*models.Notification{{Id: latestId, Type: models.NotificationReset, Data: json.RawMessage("{}")}}, nil
+	}
+
+	from := lastId
+	if from == "" {
+		from = "-"
+	}
+
+	var notifications []*models.Notification
+	for {
+		messages, err := cache.GetNotificationsFrom(userId.String(), from, notificationsBatchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, message := range messages {
+			if message.ID == lastId {
+				continue
+			}
+			notifications = append(notifications, toNotification(message))
+			lastId = message.ID
+		}
+
+		if len(messages) < notificationsBatchSize {
+			return notifications, nil
+		}
+		from = lastId
+	}
+}
+
+// Идентификатор последнего события журнала; начальный, если журнал пуст
+func (service *notificationService) GetLastId(userId uuid.UUID) (string, error) {
+	_, latestId, err := cache.GetNotificationsBounds(userId.String())
+	if err != nil {
+		return "", err
+	}
+	if latestId == "" {
+		return notificationsStartingId, nil
+	}
+
+	return latestId, nil
+}
+
+// Место для нового потока событий пользователя
+func (service *notificationService) AcquireStream(userId uuid.UUID) error {
+	acquired, err := cache.AcquireStreamConnection(userId.String(), int64(service.config.StreamConfig.MaxConnectionsPerUser), streamConnectionTimeout)
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return ErrTooManyStreams
+	}
+
+	return nil
+}
+
+// Продление мест открытых потоков; вызывается чаще streamConnectionTimeout
+func (service *notificationService) RefreshStream(userId uuid.UUID) {
+	_ = cache.RefreshStreamConnections(userId.String(), streamConnectionTimeout)
+}
+
+func (service *notificationService) ReleaseStream(userId uuid.UUID) {
+	_ = cache.ReleaseStreamConnection(userId.String())
+}
+
+func toNotification(message redis.XMessage) *models.Notification {
+	notification := &models.Notification{Id: message.ID}
+	notification.Type, _ = message.Values["type"].(string)
+	data, _ := message.Values["data"].(string)
+	notification.Data = json.RawMessage(data)
+
+	return notification
+}
+
+// Сравнение идентификаторов записей Redis stream вида "<мс>-<номер>"
+func compareStreamIds(a, b string) int {
+	aMs, aSeq := parseStreamId(a)
+	bMs, bSeq := parseStreamId(b)
+	switch {
+	case aMs < bMs, aMs == bMs && aSeq < bSeq:
+		return -1
+	case aMs == bMs && aSeq == bSeq:
+		return 0
+	}
+
+	return 1
+}
+
+func parseStreamId(id string) (uint64, uint64) {
+	ms, seq, _ := strings.Cut(id, "-")
+	msValue, _ := strconv.ParseUint(ms, 10, 64)
+	seqValue, _ := strconv.ParseUint(seq, 10, 64)
+
+	return msValue, seqValue
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"log"
+	"social-network/internal/config"
+	"social-network/internal/queue"
+	"social-network/pkg/database"
+	"social-network/pkg/models"
+	"social-network/pkg/repository"
+	"time"
+)
+
+// Как часто удаляются доставленные события
+const outboxCleanupInterval = time.Hour
+
+// Публикация событий из outbox в очередь - единственный источник событий,
+// по которым обновляются ленты
+type OutboxRelay interface {
+	Run(ctx context.Context)
+}
+
+type outboxRelay struct {
+	config           *config.Config
+	outboxRepository repository.OutboxRepository
+	broker           queue.Broker
+}
+
+// Инициализация публикации событий outbox
+func InitOutboxRelay(config *config.Config, outboxRepository repository.OutboxRepository, broker queue.Broker) OutboxRelay {
+	return &outboxRelay{config: config, outboxRepository: outboxRepository, broker: broker}
+}
+
+// Публикация до отмены ctx. Пока в outbox есть события, пачки публикуются
+// без пауз, иначе outbox опрашивается раз в OUTBOX_POLL_INTERVAL.
+// Событие может быть опубликовано повторно, если процесс остановится до
+// отметки о доставке: обработчики очереди пропускают повторы по Id
+func (relay *outboxRelay) Run(ctx context.Context) {
+	ctx = database.WithMaster(ctx)
+	batchSize := relay.config.OutboxConfig.BatchSize
+	var cleanedAt time.Time
+
+	for {
+		published, err := relay.outboxRepository.PublishPending(ctx, batchSize, func(event *models.Event) error {
+			return relay.broker.Publish(ctx, event)
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Ошибка публикации событий outbox: %v", err)
+		}
+
+		if time.Since(cleanedAt) >= outboxCleanupInterval {
+			cleanedAt = time.Now()
+			_, err := relay.outboxRepository.DeleteDelivered(ctx, time.Now().UTC().Add(-relay.config.OutboxConfig.Retention))
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Ошибка очистки outbox: %v", err)
+			}
+		}
+
+		if err == nil && published == batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(relay.config.OutboxConfig.PollInterval):
+		}
+	}
+}
@@ -13,22 +13,27 @@ import (
 
 type PostService interface {
 	AddPost(ctx context.Context, userId uuid.UUID, postRequest *models.CreatePostRequest) error
-	GetById(ctx context.Context, postId uuid.UUID) (*models.Post, error)
+	GetById(ctx context.Context, viewerId, postId uuid.UUID) (*models.Post, error)
 	DeletePost(ctx context.Context, postId, userId uuid.UUID) error
-	GetFeed(ctx context.Context, userId uuid.UUID, limit, offset int) ([]*models.Post, error)
+	GetFeed(ctx context.Context, userId uuid.UUID, mode, cursor string, limit int) (*models.FeedResponse, error)
 	GetFeedCount(ctx context.Context, userId uuid.UUID) int64
+	AddReaction(ctx context.Context, userId, postId uuid.UUID) error
+	DeleteReaction(ctx context.Context, userId, postId uuid.UUID) error
+	AddComment(ctx context.Context, userId, postId uuid.UUID, commentRequest *models.CreateCommentRequest) (*models.Comment, error)
+	GetComments(ctx context.Context, viewerId, postId uuid.UUID, limit, offset int) ([]*models.Comment, error)
 }
 
 type postService struct {
 	postRepository       repository.PostRepository
 	userRepository       repository.UserRepository
-	friendShipRepository repository.FriendShipRepository
+	engagementRepository repository.EngagementRepository
 	feedService          FeedService
+	moderationService    ModerationService
 }
 
 // Инициализация сервиса постов
-func InitPostService(postRepository repository.PostRepository, userRepository repository.UserRepository, friendShipRepository repository.FriendShipRepository, feedService FeedService) PostService {
-	return &postService{postRepository: postRepository, userRepository: userRepository, feedService: feedService}
+func InitPostService(postRepository repository.PostRepository, userRepository repository.UserRepository, engagementRepository repository.EngagementRepository, feedService FeedService, moderationService ModerationService) PostService {
+	return &postService{postRepository: postRepository, userRepository: userRepository, engagementRepository: engagementRepository, feedService: feedService, moderationService: moderationService}
 }
 
 // Создание поста
@@ -57,26 +62,25 @@ func (service *postService) AddPost(ctx context.Context, userId uuid.UUID, postR
 		IsPublic: true,
 	}
 
-	err = service.postRepository.AddPost(ctx, &post)
+	// Ленты обновляются по событию, записанному в outbox вместе с постом
+	return service.postRepository.AddPost(ctx, &post)
+}
+
+// Получение поста по Id. Посты заблокированных авторов скрыты от всех,
+// теневых - от всех, кроме автора
+func (service *postService) GetById(ctx context.Context, viewerId, postId uuid.UUID) (*models.Post, error) {
+	ctx = database.WithReplica(ctx)
+	post, err := service.postRepository.GetById(ctx, postId)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Добавляем пост в кеш в потоке
-	go func() {
-		err := service.feedService.AddPostToFeed(ctx, post.UserId, &post)
-		if err != nil {
-			// Логгируем ошибку добавления поста в кеш
-		}
-	}()
-
-	return nil
-}
+	state := service.moderationService.GetState(post.UserId)
+	if !state.ContentVisibleTo(post.UserId == viewerId) {
+		return nil, fmt.Errorf("Пост не найден")
+	}
 
-// Получение поста по Id
-func (service *postService) GetById(ctx context.Context, postId uuid.UUID) (*models.Post, error) {
-	ctx = database.WithReplica(ctx)
-	return service.postRepository.GetById(ctx, postId)
+	return post, nil
 }
 
 // Удаление поста
@@ -95,29 +99,47 @@ func (service *postService) DeletePost(ctx context.Context, postId, userId uuid.
 		return fmt.Errorf("Вы не являетесь автором поста")
 	}
 
-	err = service.postRepository.DeletePost(ctx, postId, userId)
-	if err != nil {
-		return err
+	return service.postRepository.DeletePost(ctx, postId, userId)
+}
+
+// Лента постов в режиме mode. Хронологическая лента листается по курсору
+// без ограничений, остальные режимы - в пределах окна ранжирования
+func (service *postService) GetFeed(ctx context.Context, userId uuid.UUID, mode, cursor string, limit int) (*models.FeedResponse, error) {
+	if mode == "" {
+		mode = models.FeedModeChronological
 	}
 
-	go func() {
-		err := service.feedService.DeletePostInFeeds(ctx, post.UserId, post)
+	var posts []*models.Post
+	var nextCursor string
+	if mode == models.FeedModeChronological {
+		feedCursor, err := models.DecodeFeedCursor(cursor)
 		if err != nil {
-			// Логгируем ошибку удаления поста
+			return nil, err
 		}
-	}()
 
-	return nil
-}
+		page, next, err := service.feedService.GetFeed(ctx, userId, feedCursor, limit)
+		if err != nil {
+			return nil, err
+		}
+		posts, nextCursor = page, next.Encode()
+	} else {
+		rankedCursor, err := models.DecodeRankedFeedCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
 
-// Лента постов
-func (service *postService) GetFeed(ctx context.Context, userId uuid.UUID, limit, offset int) ([]*models.Post, error) {
-	posts, err := service.feedService.GetFeed(ctx, userId, limit, offset)
-	if err != nil {
-		return nil, err
+		page, next, err := service.feedService.GetRankedFeed(ctx, userId, mode, rankedCursor, limit)
+		if err != nil {
+			return nil, err
+		}
+		posts, nextCursor = page, next.Encode()
+	}
+
+	if posts == nil {
+		posts = []*models.Post{}
 	}
 
-	return posts, nil
+	return &models.FeedResponse{Mode: mode, Posts: posts, NextCursor: nextCursor}, nil
 }
 
 // Количество постов в ленте
@@ -126,3 +148,68 @@ func (service *postService) GetFeedCount(ctx context.Context, userId uuid.UUID)
 
 	return result
 }
+
+// Реакция на пост, доступный пользователю
+func (service *postService) AddReaction(ctx context.Context, userId, postId uuid.UUID) error {
+	if _, err := service.GetById(ctx, userId, postId); err != nil {
+		return err
+	}
+
+	return service.engagementRepository.AddReaction(database.WithMaster(ctx), postId, userId)
+}
+
+func (service *postService) DeleteReaction(ctx context.Context, userId, postId uuid.UUID) error {
+	return service.engagementRepository.DeleteReaction(database.WithMaster(ctx), postId, userId)
+}
+
+// Комментарий к посту, доступному пользователю
+func (service *postService) AddComment(ctx context.Context, userId, postId uuid.UUID, commentRequest *models.CreateCommentRequest) (*models.Comment, error) {
+	err := utils.ValidateComment(commentRequest.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = service.GetById(ctx, userId, postId); err != nil {
+		return nil, err
+	}
+
+	comment := &models.Comment{
+		Id:      uuid.New(),
+		PostId:  postId,
+		UserId:  userId,
+		Content: commentRequest.Content,
+	}
+	if err = service.engagementRepository.AddComment(database.WithMaster(ctx), comment); err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// Комментарии к посту, доступному пользователю. Комментарии авторов, контент
+// которых скрыт модератором, не показываются
+func (service *postService) GetComments(ctx context.Context, viewerId, postId uuid.UUID, limit, offset int) ([]*models.Comment, error) {
+	if _, err := service.GetById(ctx, viewerId, postId); err != nil {
+		return nil, err
+	}
+
+	comments, err := service.engagementRepository.GetComments(database.WithReplica(ctx), postId, limit, offset)
+	if err != nil || len(comments) == 0 {
+		return comments, err
+	}
+
+	authorIds := make([]uuid.UUID, 0, len(comments))
+	for _, comment := range comments {
+		authorIds = append(authorIds, comment.UserId)
+	}
+
+	hidden := service.moderationService.HiddenAuthors(viewerId, authorIds)
+	visible := make([]*models.Comment, 0, len(comments))
+	for _, comment := range comments {
+		if !hidden[comment.UserId] {
+			visible = append(visible, comment)
+		}
+	}
+
+	return visible, nil
+}
@@ -2,38 +2,322 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"social-network/internal/cache"
 	"social-network/pkg/database"
 	"social-network/pkg/models"
 	"social-network/pkg/repository"
+	"social-network/pkg/utils"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const (
+	// Максимальное количество анкет в одном пакетном запросе
+	MaxBatchProfiles = 100
+	// Минимальный интервал между сменами имени пользователя
+	UsernameChangeCooldown = 30 * 24 * time.Hour
+	// Сколько прежнее имя перенаправляет на новое и недоступно другим
+	UsernameRedirectPeriod = 90 * 24 * time.Hour
+)
+
 type ProfileService interface {
-	GetById(ctx context.Context, userId uuid.UUID) (*models.Profile, error)
-	SearchProfile(ctx context.Context, firstName, lastName string, limit, offset int) ([]*models.Profile, error)
+	GetById(ctx context.Context, viewerId, userId uuid.UUID) (*models.Profile, error)
+	GetByIds(ctx context.Context, viewerId uuid.UUID, userIds []uuid.UUID) (map[uuid.UUID]*models.Profile, error)
+	GetByUsername(ctx context.Context, viewerId uuid.UUID, username string) (*models.Profile, string, error)
+	ChangeUsername(ctx context.Context, userId uuid.UUID, username string) error
+	SearchProfile(ctx context.Context, viewerId uuid.UUID, firstName, lastName string, limit, offset int) ([]*models.Profile, error)
+	UpdateProfile(ctx context.Context, userId uuid.UUID, request *models.UpdateProfileRequest, version time.Time) (*models.Profile, error)
+	GetPrivacySettings(ctx context.Context, userId uuid.UUID) (*models.PrivacySettings, error)
+	UpdatePrivacySettings(ctx context.Context, userId uuid.UUID, request *models.UpdatePrivacyRequest) (*models.PrivacySettings, error)
 }
 
 type profileService struct {
-	repository repository.ProfileRepository
+	profileCache         *cache.ProfileCache
+	repository           repository.ProfileRepository
+	privacyRepository    repository.PrivacyRepository
+	friendShipRepository repository.FriendShipRepository
+	userRepository       repository.UserRepository
 }
 
-func InitProfileService(profileRepository repository.ProfileRepository) ProfileService {
-	return &profileService{repository: profileRepository}
+func InitProfileService(profileCache *cache.ProfileCache, profileRepository repository.ProfileRepository, privacyRepository repository.PrivacyRepository, friendShipRepository repository.FriendShipRepository, userRepository repository.UserRepository) ProfileService {
+	return &profileService{
+		profileCache:         profileCache,
+		repository:           profileRepository,
+		privacyRepository:    privacyRepository,
+		friendShipRepository: friendShipRepository,
+		userRepository:       userRepository,
+	}
 }
 
-func (service *profileService) GetById(ctx context.Context, userId uuid.UUID) (*models.Profile, error) {
+// Анкета пользователя userId с учетом настроек приватности. viewerId = uuid.Nil - анонимный зритель
+func (service *profileService) GetById(ctx context.Context, viewerId, userId uuid.UUID) (*models.Profile, error) {
 	ctx = database.WithReplica(ctx)
 
-	return service.repository.GetByUserId(ctx, userId)
+	profile, err := service.profileCache.Get(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = service.applyPrivacy(ctx, viewerId, []*models.Profile{profile})
+	if err != nil {
+		return nil, err
+	}
+
+	return profile, nil
 }
-func (service *profileService) SearchProfile(ctx context.Context, firstName, lastName string, limit, offset int) ([]*models.Profile, error) {
+
+// Анкеты нескольких пользователей с учетом настроек приватности; отсутствующие анкеты пропускаются
+func (service *profileService) GetByIds(ctx context.Context, viewerId uuid.UUID, userIds []uuid.UUID) (map[uuid.UUID]*models.Profile, error) {
+	if len(userIds) > MaxBatchProfiles {
+		return nil, fmt.Errorf("Можно запросить не более %d анкет", MaxBatchProfiles)
+	}
+
+	ctx = database.WithReplica(ctx)
+
+	profiles, err := service.profileCache.GetMany(ctx, userIds)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*models.Profile, 0, len(profiles))
+	for _, profile := range profiles {
+		list = append(list, profile)
+	}
+
+	err = service.applyPrivacy(ctx, viewerId, list)
+	if err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+// Анкета по имени пользователя. Для прежнего имени в период перенаправления
+// анкета не возвращается, а возвращается актуальное имя для редиректа. Перенаправление
+// ищется, только если пользователя с таким именем нет; ошибки БД возвращаются как есть
+func (service *profileService) GetByUsername(ctx context.Context, viewerId uuid.UUID, username string) (*models.Profile, string, error) {
+	ctx = database.WithReplica(ctx)
+
+	user, err := service.userRepository.GetUserByUsername(ctx, username)
+	if err == nil {
+		profile, err := service.GetById(ctx, viewerId, user.Id)
+		return profile, "", err
+	}
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		return nil, "", err
+	}
+
+	userId, err := service.userRepository.GetUsernameRedirect(ctx, username)
+	if err != nil {
+		return nil, "", err
+	}
+
+	user, err = service.userRepository.GetUserById(ctx, userId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return nil, user.Username, nil
+}
+
+// Смена имени пользователя с ограничением частоты
+func (service *profileService) ChangeUsername(ctx context.Context, userId uuid.UUID, username string) error {
+	err := utils.ValidateUsername(username)
+	if err != nil {
+		return err
+	}
+
+	ctx = database.WithMaster(ctx)
+	user, err := service.userRepository.GetUserById(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	if user.Username == username {
+		return nil
+	}
+
+	// Смена регистра собственного имени не ограничивается
+	if !strings.EqualFold(user.Username, username) && !user.UsernameChangedAt.IsZero() {
+		nextChange := user.UsernameChangedAt.Add(UsernameChangeCooldown)
+		if time.Now().Before(nextChange) {
+			return fmt.Errorf("Имя пользователя можно будет сменить после %s", nextChange.Format("2006-01-02 15:04"))
+		}
+	}
+
+	available, err := service.userRepository.IsUsernameAvailable(ctx, username, userId)
+	if err != nil {
+		return err
+	}
+	if !available {
+		return repository.ErrUsernameTaken
+	}
+
+	err = service.userRepository.ChangeUsername(ctx, userId, username, time.Now().Add(UsernameRedirectPeriod))
+	if err != nil {
+		return err
+	}
+
+	_ = service.profileCache.Invalidate(userId)
+
+	return nil
+}
+
+func (service *profileService) SearchProfile(ctx context.Context, viewerId uuid.UUID, firstName, lastName string, limit, offset int) ([]*models.Profile, error) {
 	if firstName == "" || lastName == "" {
 		return nil, fmt.Errorf("Не переданы обязательные параметры")
 	}
 
 	ctx = database.WithReplica(ctx)
 
-	return service.repository.SearchProfiles(ctx, firstName, lastName, limit, offset)
+	profiles, err := service.repository.SearchProfiles(ctx, viewerId, firstName, lastName, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	err = service.applyPrivacy(ctx, viewerId, profiles)
+	if err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+// Частичное обновление анкеты, если ее версия совпадает с version
+func (service *profileService) UpdateProfile(ctx context.Context, userId uuid.UUID, request *models.UpdateProfileRequest, version time.Time) (*models.Profile, error) {
+	err := utils.ValidateUpdateProfileRequest(request.FirstName, request.LastName, request.Birthdate, request.Gender, request.Biography, request.City)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = database.WithMaster(ctx)
+	profile, err := service.repository.GetByUserId(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !version.Equal(profile.UpdatedAt) {
+		return nil, repository.ErrProfileVersionConflict
+	}
+
+	if request.FirstName != nil {
+		profile.FirstName = *request.FirstName
+	}
+	if request.LastName != nil {
+		profile.LastName = *request.LastName
+	}
+	if request.Birthdate != nil {
+		profile.Birthdate, _ = utils.ParseBirthdate(*request.Birthdate)
+	}
+	if request.Gender != nil {
+		profile.Gender = *request.Gender
+	}
+	if request.Biography != nil {
+		profile.Biography = *request.Biography
+	}
+	if request.City != nil {
+		profile.City = *request.City
+	}
+
+	err = service.repository.Update(ctx, profile, version)
+	if err != nil {
+		return nil, err
+	}
+
+	// Сбрасываем закешированную анкету
+	_ = service.profileCache.Invalidate(userId)
+
+	return profile, nil
+}
+
+// Настройки приватности пользователя
+func (service *profileService) GetPrivacySettings(ctx context.Context, userId uuid.UUID) (*models.PrivacySettings, error) {
+	ctx = database.WithMaster(ctx)
+
+	return service.privacyRepository.GetByUserId(ctx, userId)
+}
+
+// Частичное обновление настроек приватности
+func (service *profileService) UpdatePrivacySettings(ctx context.Context, userId uuid.UUID, request *models.UpdatePrivacyRequest) (*models.PrivacySettings, error) {
+	for _, level := range []*models.PrivacyLevel{request.Birthdate, request.City, request.Biography} {
+		if level != nil && !level.IsValid() {
+			return nil, fmt.Errorf("Уровень видимости должен быть одним из: everyone, friends, nobody")
+		}
+	}
+
+	ctx = database.WithMaster(ctx)
+	settings, err := service.privacyRepository.GetByUserId(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Birthdate != nil {
+		settings.Birthdate = *request.Birthdate
+	}
+	if request.City != nil {
+		settings.City = *request.City
+	}
+	if request.Biography != nil {
+		settings.Biography = *request.Biography
+	}
+	if request.Searchable != nil {
+		settings.Searchable = *request.Searchable
+	}
+
+	err = service.privacyRepository.Save(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// Скрываем поля анкет, которые зрителю viewerId видеть не положено
+func (service *profileService) applyPrivacy(ctx context.Context, viewerId uuid.UUID, profiles []*models.Profile) error {
+	if len(profiles) == 0 {
+		return nil
+	}
+
+	userIds := make([]uuid.UUID, 0, len(profiles))
+	for _, profile := range profiles {
+		userIds = append(userIds, profile.UserId)
+	}
+
+	settings, err := service.privacyRepository.GetByUserIds(ctx, userIds)
+	if err != nil {
+		return err
+	}
+
+	friends := make(map[uuid.UUID]bool)
+	if viewerId != uuid.Nil {
+		friendIds, err := service.friendShipRepository.GetFriendsByUserId(ctx, viewerId)
+		if err != nil {
+			return err
+		}
+		for _, friendId := range friendIds {
+			friends[friendId] = true
+		}
+	}
+
+	for _, profile := range profiles {
+		privacy := settings[profile.UserId]
+		isOwner := viewerId != uuid.Nil && viewerId == profile.UserId
+		isFriend := friends[profile.UserId]
+
+		if !privacy.Birthdate.VisibleTo(isOwner, isFriend) {
+			profile.Birthdate = time.Time{}
+		}
+		if !privacy.City.VisibleTo(isOwner, isFriend) {
+			profile.City = ""
+		}
+		if !privacy.Biography.VisibleTo(isOwner, isFriend) {
+			profile.Biography = ""
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"social-network/pkg/database"
+	"social-network/pkg/models"
+	"social-network/pkg/repository"
+
+	"github.com/google/uuid"
+)
+
+type RoleService interface {
+	GetRoles(ctx context.Context, userId uuid.UUID) ([]string, error)
+	SetRoles(ctx context.Context, actorId, userId uuid.UUID, roles []string, ip string) ([]string, error)
+	EnsureAdmins(ctx context.Context, userIds []string) error
+}
+
+type roleService struct {
+	roleRepository  repository.RoleRepository
+	userRepository  repository.UserRepository
+	auditRepository repository.AuditRepository
+	sessionService  SessionService
+}
+
+// Инициализация сервиса ролей. Роли попадают в токен доступа при его выпуске,
+// поэтому новые роли вступают в силу при следующем входе или обновлении токена,
+// а при снятии роли все выпущенные токены пользователя отзываются
+func InitRoleService(roleRepository repository.RoleRepository, userRepository repository.UserRepository, auditRepository repository.AuditRepository, sessionService SessionService) RoleService {
+	return &roleService{
+		roleRepository:  roleRepository,
+		userRepository:  userRepository,
+		auditRepository: auditRepository,
+		sessionService:  sessionService,
+	}
+}
+
+func (service *roleService) GetRoles(ctx context.Context, userId uuid.UUID) ([]string, error) {
+	return service.roleRepository.GetByUserId(database.WithMaster(ctx), userId)
+}
+
+// Установка полного набора ролей пользователя. Каждое назначение и снятие
+// записывается в журнал аудита
+func (service *roleService) SetRoles(ctx context.Context, actorId, userId uuid.UUID, roles []string, ip string) ([]string, error) {
+	for _, role := range roles {
+		if !models.IsValidRole(role) {
+			return nil, fmt.Errorf("Неизвестная роль: %s", role)
+		}
+	}
+
+	if actorId == userId && !slices.Contains(roles, models.RoleAdmin) {
+		return nil, fmt.Errorf("Нельзя снять роль администратора с самого себя")
+	}
+
+	ctx = database.WithMaster(ctx)
+	_, err := service.userRepository.GetUserById(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := service.roleRepository.GetByUserId(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, role := range roles {
+		if slices.Contains(current, role) {
+			continue
+		}
+
+		granted, err := service.roleRepository.Grant(ctx, userId, role, actorId)
+		if err != nil {
+			return nil, err
+		}
+		if granted {
+			service.audit(ctx, models.AuditRoleGranted, actorId, userId, role, ip)
+		}
+	}
+
+	anyRevoked := false
+	for _, role := range current {
+		if slices.Contains(roles, role) {
+			continue
+		}
+
+		revoked, err := service.roleRepository.Revoke(ctx, userId, role)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			anyRevoked = true
+			service.audit(ctx, models.AuditRoleRevoked, actorId, userId, role, ip)
+		}
+	}
+
+	// Снятая роль остается в уже выпущенных токенах до истечения их срока
+	if anyRevoked {
+		err = service.sessionService.RevokeTokens(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return service.roleRepository.GetByUserId(ctx, userId)
+}
+
+// Назначение роли администратора пользователям из конфигурации (первичная настройка)
+func (service *roleService) EnsureAdmins(ctx context.Context, userIds []string) error {
+	ctx = database.WithMaster(ctx)
+	for _, value := range userIds {
+		userId, err := uuid.Parse(value)
+		if err != nil {
+			return fmt.Errorf("Некорректный идентификатор администратора %q", value)
+		}
+
+		granted, err := service.roleRepository.Grant(ctx, userId, models.RoleAdmin, uuid.Nil)
+		if err != nil {
+			return err
+		}
+		if granted {
+			service.audit(ctx, models.AuditRoleGranted, uuid.Nil, userId, models.RoleAdmin, "")
+		}
+	}
+
+	return nil
+}
+
+func (service *roleService) audit(ctx context.Context, event string, actorId, userId uuid.UUID, role, ip string) {
+	err := service.auditRepository.Add(ctx, &models.AuditEvent{
+		Event:   event,
+		UserId:  userId,
+		ActorId: actorId,
+		IP:      ip,
+		Details: map[string]interface{}{"role": role},
+	})
+	if err != nil {
+		log.Printf("Не удалось записать событие %s в журнал аудита: %v", event, err)
+	}
+}
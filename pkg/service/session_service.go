@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"log"
+	"social-network/internal/cache"
+	"social-network/pkg/database"
+	"social-network/pkg/models"
+	"social-network/pkg/repository"
+	"social-network/pkg/utils"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// Время последней активности сессии обновляется в БД не чаще этого интервала
+	sessionTouchInterval = 5 * time.Minute
+	// Сколько кешируется отметка о том, что сессия не отозвана
+	sessionActiveCacheTTL = time.Minute
+	// Как часто из БД удаляются сессии с истекшими токенами
+	sessionCleanupInterval = time.Hour
+	maxUserAgentLength     = 512
+)
+
+type SessionService interface {
+	Create(ctx context.Context, userId uuid.UUID, userAgent, ip string) (*models.Session, error)
+	GetSessions(ctx context.Context, userId uuid.UUID) ([]*models.Session, error)
+	Revoke(ctx context.Context, userId, sessionId uuid.UUID) error
+	RevokeOthers(ctx context.Context, userId, currentSessionId uuid.UUID) error
+	IsRevoked(ctx context.Context, sessionId uuid.UUID) bool
+	RevokeTokens(ctx context.Context, userId uuid.UUID) error
+	IsTokenRevoked(ctx context.Context, userId uuid.UUID, issuedAt time.Time) bool
+	Touch(sessionId uuid.UUID, ip string)
+	Extend(ctx context.Context, sessionId uuid.UUID) error
+	RunCleanupWorker(ctx context.Context)
+}
+
+type sessionService struct {
+	sessionRepository repository.SessionRepository
+	userRepository    repository.UserRepository
+}
+
+// Инициализация сервиса сессий (входов пользователя с устройств)
+func InitSessionService(sessionRepository repository.SessionRepository, userRepository repository.UserRepository) SessionService {
+	return &sessionService{sessionRepository: sessionRepository, userRepository: userRepository}
+}
+
+func (service *sessionService) Create(ctx context.Context, userId uuid.UUID, userAgent, ip string) (*models.Session, error) {
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	session := models.Session{
+		Id:        uuid.New(),
+		UserId:    userId,
+		UserAgent: userAgent,
+		IP:        ip,
+		CreatedAt: time.Now().UTC(),
+	}
+	// Сессия истекает вместе с последним выпущенным для нее токеном
+	session.ExpiresAt = session.CreatedAt.Add(utils.TokenTTL)
+
+	err := service.sessionRepository.Create(database.WithMaster(ctx), &session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (service *sessionService) GetSessions(ctx context.Context, userId uuid.UUID) ([]*models.Session, error) {
+	return service.sessionRepository.GetActiveByUserId(database.WithMaster(ctx), userId)
+}
+
+func (service *sessionService) Revoke(ctx context.Context, userId, sessionId uuid.UUID) error {
+	err := service.sessionRepository.Revoke(database.WithMaster(ctx), userId, sessionId)
+	if err != nil {
+		return err
+	}
+
+	return cache.RevokeSession(sessionId.String(), utils.TokenTTL)
+}
+
+// Завершение всех сессий пользователя, кроме текущей (uuid.Nil - завершение всех)
+func (service *sessionService) RevokeOthers(ctx context.Context, userId, currentSessionId uuid.UUID) error {
+	ids, err := service.sessionRepository.RevokeAll(database.WithMaster(ctx), userId, currentSessionId)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err = cache.RevokeSession(id.String(), utils.TokenTTL)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Проверка отзыва сессии. Redis - только кеш состояния из таблицы sessions: без
+// отметки в кеше (после очистки или вытеснения) или при недоступности Redis
+// состояние читается из БД, а если недоступна и она, сессия считается отозванной
+func (service *sessionService) IsRevoked(ctx context.Context, sessionId uuid.UUID) bool {
+	revoked, cached, err := cache.GetSessionRevoked(sessionId.String())
+	if err == nil && cached {
+		return revoked
+	}
+
+	// Отзыв пишется в мастер, реплика могла его еще не получить
+	revoked, err = service.sessionRepository.IsRevoked(database.WithMaster(ctx), sessionId)
+	if err != nil {
+		log.Printf("Не удалось проверить отзыв сессии %s: %v", sessionId, err)
+		return true
+	}
+
+	if revoked {
+		_ = cache.RevokeSession(sessionId.String(), utils.TokenTTL)
+	} else {
+		_ = cache.MarkSessionActive(sessionId.String(), sessionActiveCacheTTL)
+	}
+
+	return revoked
+}
+
+// Отзыв всех выданных пользователю токенов (после смены или сброса пароля).
+// Момент отзыва хранится в БД, Redis - его кеш. Точность - секунда, как у
+// времени выпуска токена: токен, выпущенный сразу после отзыва, действует
+func (service *sessionService) RevokeTokens(ctx context.Context, userId uuid.UUID) error {
+	at := time.Now().UTC().Truncate(time.Second)
+	err := service.userRepository.RevokeTokens(database.WithMaster(ctx), userId, at)
+	if err != nil {
+		return err
+	}
+
+	return cache.SetTokensRevokedAt(userId.String(), at, utils.TokenTTL)
+}
+
+// Отозван ли токен пользователя, выпущенный в issuedAt. Как и для сессий, без
+// значения в кеше или при недоступности Redis момент отзыва читается из БД, а при
+// ошибке БД токен считается отозванным
+func (service *sessionService) IsTokenRevoked(ctx context.Context, userId uuid.UUID, issuedAt time.Time) bool {
+	revokedAt, cached, err := cache.GetTokensRevokedAt(userId.String())
+	if err != nil || !cached {
+		revokedAt, err = service.userRepository.GetTokensRevokedAt(database.WithMaster(ctx), userId)
+		if err != nil {
+			log.Printf("Не удалось проверить отзыв токенов пользователя %s: %v", userId, err)
+			return true
+		}
+
+		_ = cache.SetTokensRevokedAt(userId.String(), revokedAt, sessionActiveCacheTTL)
+	}
+
+	return issuedAt.Before(revokedAt)
+}
+
+// Обновление времени последней активности сессии, не чаще sessionTouchInterval
+func (service *sessionService) Touch(sessionId uuid.UUID, ip string) {
+	touch, err := cache.ShouldTouchSession(sessionId.String(), sessionTouchInterval)
+	if err != nil || !touch {
+		return
+	}
+
+	go func() {
+		ctx := database.WithMaster(context.Background())
+		err := service.sessionRepository.Touch(ctx, sessionId, ip, time.Now().UTC())
+		if err != nil {
+			log.Printf("Не удалось обновить время активности сессии %s: %v", sessionId, err)
+		}
+	}()
+}
+
+// Продление сессии на срок нового токена
+func (service *sessionService) Extend(ctx context.Context, sessionId uuid.UUID) error {
+	return service.sessionRepository.Extend(database.WithMaster(ctx), sessionId, time.Now().UTC().Add(utils.TokenTTL))
+}
+
+// Периодическое удаление сессий с истекшими токенами до отмены контекста
+func (service *sessionService) RunCleanupWorker(ctx context.Context) {
+	ticker := time.NewTicker(sessionCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := service.sessionRepository.DeleteExpired(database.WithMaster(ctx), time.Now().UTC())
+		if err != nil {
+			log.Printf("Ошибка удаления истекших сессий: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Удалено истекших сессий: %d", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"social-network/internal/config"
+	"social-network/pkg/database"
+	"social-network/pkg/models"
+	"social-network/pkg/repository"
+	"social-network/pkg/utils"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Количество одноразовых кодов восстановления, выдаваемых при включении 2FA
+const recoveryCodesCount = 10
+
+var (
+	ErrTwoFactorNotSetUp    = errors.New("Двухфакторная аутентификация не подключена")
+	ErrInvalidTwoFactorCode = errors.New("Код подтверждения указан неверно")
+)
+
+var totpCodePattern = regexp.MustCompile(`^\d{6}$`)
+
+type TwoFactorService interface {
+	Setup(ctx context.Context, userId uuid.UUID) (*models.TwoFactorSetupResponse, error)
+	Enable(ctx context.Context, userId uuid.UUID, code string) ([]string, error)
+	Disable(ctx context.Context, userId uuid.UUID, password, code string) error
+	IsEnabled(ctx context.Context, userId uuid.UUID) (bool, error)
+	Verify(ctx context.Context, userId uuid.UUID, code string) error
+}
+
+type twoFactorService struct {
+	config              *config.Config
+	twoFactorRepository repository.TwoFactorRepository
+	userRepository      repository.UserRepository
+	auditRepository     repository.AuditRepository
+}
+
+// Инициализация сервиса двухфакторной аутентификации (TOTP, RFC 6238)
+func InitTwoFactorService(config *config.Config, twoFactorRepository repository.TwoFactorRepository, userRepository repository.UserRepository, auditRepository repository.AuditRepository) TwoFactorService {
+	return &twoFactorService{
+		config:              config,
+		twoFactorRepository: twoFactorRepository,
+		userRepository:      userRepository,
+		auditRepository:     auditRepository,
+	}
+}
+
+// Начало подключения: новый секрет и URI для QR-кода. До подтверждения кодом
+// двухфакторная аутентификация при входе не требуется
+func (service *twoFactorService) Setup(ctx context.Context, userId uuid.UUID) (*models.TwoFactorSetupResponse, error) {
+	ctx = database.WithMaster(ctx)
+	user, err := service.userRepository.GetUserById(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := utils.EncryptSecret(secret, service.config.TwoFactorConfig.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	err = service.twoFactorRepository.SavePending(ctx, userId, encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	account := user.Username
+	if account == "" {
+		account = user.Id.String()
+	}
+
+	return &models.TwoFactorSetupResponse{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(secret, service.config.TwoFactorConfig.Issuer, account),
+	}, nil
+}
+
+// Подтверждение подключения кодом из приложения. Возвращает коды восстановления,
+// которые показываются пользователю один раз
+func (service *twoFactorService) Enable(ctx context.Context, userId uuid.UUID, code string) ([]string, error) {
+	ctx = database.WithMaster(ctx)
+	twoFactor, err := service.twoFactorRepository.Get(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor == nil {
+		return nil, ErrTwoFactorNotSetUp
+	}
+	if twoFactor.IsEnabled() {
+		return nil, repository.ErrTwoFactorEnabled
+	}
+
+	secret, err := utils.DecryptSecret(twoFactor.Secret, service.config.TwoFactorConfig.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	step, ok := utils.ValidateTOTP(secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes := make([]string, recoveryCodesCount)
+	hashes := make([]string, recoveryCodesCount)
+	for i := range codes {
+		token, err := utils.GenerateRandomToken(5)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = token[:5] + "-" + token[5:]
+		hashes[i] = utils.HashSecretWithKey(token, service.config.TwoFactorConfig.RecoveryCodeKey)
+	}
+
+	err = service.twoFactorRepository.Enable(ctx, userId, step, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	service.audit(ctx, models.AuditTwoFactorEnabled, userId)
+
+	return codes, nil
+}
+
+// Отключение после повторной аутентификации: пароль и код TOTP или код восстановления
+func (service *twoFactorService) Disable(ctx context.Context, userId uuid.UUID, password, code string) error {
+	ctx = database.WithMaster(ctx)
+	user, err := service.userRepository.GetUserById(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	if !utils.CheckPassword(password, user.Password) {
+		return fmt.Errorf("Текущий пароль указан неверно")
+	}
+
+	err = service.Verify(ctx, userId, code)
+	if err != nil {
+		return err
+	}
+
+	err = service.twoFactorRepository.Delete(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	service.audit(ctx, models.AuditTwoFactorDisabled, userId)
+
+	return nil
+}
+
+func (service *twoFactorService) IsEnabled(ctx context.Context, userId uuid.UUID) (bool, error) {
+	twoFactor, err := service.twoFactorRepository.Get(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+
+	return twoFactor != nil && twoFactor.IsEnabled(), nil
+}
+
+// Проверка второго фактора. Код TOTP принимается один раз, код восстановления
+// после использования погашается
+func (service *twoFactorService) Verify(ctx context.Context, userId uuid.UUID, code string) error {
+	ctx = database.WithMaster(ctx)
+	twoFactor, err := service.twoFactorRepository.Get(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if twoFactor == nil || !twoFactor.IsEnabled() {
+		return ErrTwoFactorNotSetUp
+	}
+
+	code = strings.TrimSpace(code)
+	if totpCodePattern.MatchString(code) {
+		secret, err := utils.DecryptSecret(twoFactor.Secret, service.config.TwoFactorConfig.EncryptionKey)
+		if err != nil {
+			return err
+		}
+
+		step, ok := utils.ValidateTOTP(secret, code, time.Now())
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+
+		used, err := service.twoFactorRepository.UseStep(ctx, userId, step)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidTwoFactorCode
+		}
+
+		return nil
+	}
+
+	recoveryCode := strings.ToLower(strings.ReplaceAll(code, "-", ""))
+	used, err := service.twoFactorRepository.UseRecoveryCode(ctx, userId, utils.HashSecretWithKey(recoveryCode, service.config.TwoFactorConfig.RecoveryCodeKey))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+func (service *twoFactorService) audit(ctx context.Context, event string, userId uuid.UUID) {
+	err := service.auditRepository.Add(ctx, &models.AuditEvent{
+		Event:   event,
+		UserId:  userId,
+		ActorId: userId,
+	})
+	if err != nil {
+		log.Printf("Не удалось записать событие %s в журнал аудита: %v", event, err)
+	}
+}
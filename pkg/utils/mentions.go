@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Упоминание: "@" и имя пользователя, перед "@" не может стоять буква, цифра или "@"
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_.@])@([A-Za-z][A-Za-z0-9_.]{2,31})`)
+
+// Имена упомянутых в тексте пользователей без повторов (без учета регистра), не более limit
+func ExtractMentions(text string, limit int) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		// Точка в конце имени - конец предложения
+		username := strings.TrimRight(match[1], ".")
+		key := strings.ToLower(username)
+		if len(username) < 3 || seen[key] {
+			continue
+		}
+		seen[key] = true
+		usernames = append(usernames, username)
+		if len(usernames) >= limit {
+			break
+		}
+	}
+
+	return usernames
+}
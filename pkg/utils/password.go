@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"social-network/internal/config"
+)
+
+// Формат хеша argon2id (PHC): $argon2id$v=19$m=<KiB>,t=<итерации>,p=<потоки>$<соль>$<хеш>.
+// Хеши bcrypt ($2a$, $2b$, $2y$) продолжают проверяться и обновляются при входе
+const argon2idPrefix = "$argon2id$"
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+func HashPassword(password string, cfg *config.Config) (string, error) {
+	if cfg.PasswordConfig.Algorithm == config.PasswordBcrypt {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), cfg.PasswordConfig.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+
+		return string(hashed), nil
+	}
+
+	params := currentArgon2Params(cfg)
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, params.memory, params.iterations, params.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func CheckPassword(password, hashPassword string) bool {
+	if !strings.HasPrefix(hashPassword, argon2idPrefix) {
+		err := bcrypt.CompareHashAndPassword([]byte(hashPassword), []byte(password))
+
+		return err == nil
+	}
+
+	params, salt, key, err := decodeArgon2Hash(hashPassword)
+	if err != nil {
+		return false
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, candidate) == 1
+}
+
+// Нужно ли пересчитать хеш: другой алгоритм или устаревшие параметры
+func PasswordNeedsRehash(hashPassword string, cfg *config.Config) bool {
+	if cfg.PasswordConfig.Algorithm == config.PasswordBcrypt {
+		cost, err := bcrypt.Cost([]byte(hashPassword))
+
+		return err != nil || cost != cfg.PasswordConfig.BcryptCost
+	}
+
+	if !strings.HasPrefix(hashPassword, argon2idPrefix) {
+		return true
+	}
+
+	params, _, _, err := decodeArgon2Hash(hashPassword)
+	if err != nil {
+		return true
+	}
+
+	return params != currentArgon2Params(cfg)
+}
+
+func currentArgon2Params(cfg *config.Config) argon2Params {
+	return argon2Params{
+		memory:      cfg.PasswordConfig.Argon2Memory,
+		iterations:  cfg.PasswordConfig.Argon2Iterations,
+		parallelism: cfg.PasswordConfig.Argon2Parallelism,
+	}
+}
+
+func decodeArgon2Hash(hash string) (argon2Params, []byte, []byte, error) {
+	var (
+		params  argon2Params
+		version int
+	)
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", соль, хеш
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, fmt.Errorf("Некорректный формат хеша пароля")
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("Неподдерживаемая версия argon2")
+	}
+
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism)
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("Некорректные параметры хеша пароля")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("Некорректный хеш пароля")
+	}
+
+	return params, salt, key, nil
+}
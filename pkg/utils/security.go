@@ -2,44 +2,184 @@ package utils
 
 import (
 	"fmt"
-
-	"golang.org/x/crypto/bcrypt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
-func HashPassword(password string) (string, error) {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
+func ValidateRegisterRequest(firstName, lastName, password, gender, biography, city string) error {
+	if err := ValidateFirstName(firstName); err != nil {
+		return err
+	}
+	if err := ValidateLastName(lastName); err != nil {
+		return err
+	}
+	if err := ValidatePassword(password); err != nil {
+		return err
+	}
+	if err := ValidateGender(gender); err != nil {
+		return err
+	}
+	if err := ValidateBiography(biography); err != nil {
+		return err
+	}
+	if err := ValidateCity(city); err != nil {
+		return err
 	}
 
-	return string(hashed), nil
+	return nil
 }
 
-func CheckPassword(password, hashPassword string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashPassword), []byte(password))
+// Валидация частичного обновления анкеты: проверяются только переданные поля
+func ValidateUpdateProfileRequest(firstName, lastName, birthdate, gender, biography, city *string) error {
+	if firstName != nil {
+		if err := ValidateFirstName(*firstName); err != nil {
+			return err
+		}
+	}
+	if lastName != nil {
+		if err := ValidateLastName(*lastName); err != nil {
+			return err
+		}
+	}
+	if birthdate != nil {
+		if _, err := ParseBirthdate(*birthdate); err != nil {
+			return err
+		}
+	}
+	if gender != nil {
+		if err := ValidateGender(*gender); err != nil {
+			return err
+		}
+	}
+	if biography != nil {
+		if err := ValidateBiography(*biography); err != nil {
+			return err
+		}
+	}
+	if city != nil {
+		if err := ValidateCity(*city); err != nil {
+			return err
+		}
+	}
 
-	return err == nil
+	return nil
 }
 
-func ValidateRegisterRequest(firstName, lastName, password, gender, biography, city string) error {
+func ValidateFirstName(firstName string) error {
 	if firstName == "" || len(firstName) < 2 {
 		return fmt.Errorf("Укажити фамилию")
 	}
+	if len(firstName) > 100 {
+		return fmt.Errorf("Фамилия длиннее 100 символов")
+	}
+
+	return nil
+}
+
+func ValidateLastName(lastName string) error {
 	if lastName == "" || len(lastName) < 2 {
 		return fmt.Errorf("Укажите имя")
 	}
+	if len(lastName) > 100 {
+		return fmt.Errorf("Имя длиннее 100 символов")
+	}
+
+	return nil
+}
+
+func ValidatePassword(password string) error {
 	if password == "" || len(password) < 6 {
 		return fmt.Errorf("Пароль менее 6 символов")
 	}
+
+	return nil
+}
+
+func ValidateGender(gender string) error {
 	if gender == "" {
 		return fmt.Errorf("Укажите пол")
 	}
+	if len(gender) > 20 {
+		return fmt.Errorf("Пол указан некорректно")
+	}
+
+	return nil
+}
+
+func ValidateBiography(biography string) error {
 	if biography == "" {
 		return fmt.Errorf("Напишите о себе")
 	}
+
+	return nil
+}
+
+func ValidateCity(city string) error {
 	if city == "" {
 		return fmt.Errorf("Укажите город")
 	}
+	if len(city) > 100 {
+		return fmt.Errorf("Название города длиннее 100 символов")
+	}
+
+	return nil
+}
+
+// Имя пользователя: 3-32 символа, латиница, цифры, "_" и ".", начинается с буквы
+var usernamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.]{2,31}$`)
+
+func ValidateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("Имя пользователя должно содержать от 3 до 32 символов: латинские буквы, цифры, \"_\" и \".\", и начинаться с буквы")
+	}
+
+	return nil
+}
+
+var (
+	emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{9,14}$`)
+)
+
+// Приведение email к нижнему регистру с проверкой формата
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if len(email) > 255 || !emailPattern.MatchString(email) {
+		return "", fmt.Errorf("Email указан некорректно")
+	}
+
+	return email, nil
+}
+
+// Приведение телефона к формату E.164: +<код страны><номер>
+func NormalizePhone(phone string) (string, error) {
+	phone = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(strings.TrimSpace(phone))
+	if !phonePattern.MatchString(phone) {
+		return "", fmt.Errorf("Телефон должен быть указан в международном формате, например +79991234567")
+	}
+
+	return phone, nil
+}
+
+// Разбор даты рождения в формате ГГГГ-ММ-ДД
+func ParseBirthdate(birthdate string) (time.Time, error) {
+	parsed, err := time.Parse("2006-01-02", birthdate)
+	if err != nil || parsed.After(time.Now()) {
+		return time.Time{}, fmt.Errorf("Дата рождения указана некорректно")
+	}
+
+	return parsed, nil
+}
+
+func ValidateComment(content string) error {
+	if len(strings.TrimSpace(content)) == 0 {
+		return fmt.Errorf("Отсутствует текст комментария")
+	}
+	if utf8.RuneCountInString(content) > 2000 {
+		return fmt.Errorf("Комментарий длиннее 2000 символов")
+	}
 
 	return nil
 }
@@ -10,20 +10,55 @@ import (
 	"social-network/internal/config"
 )
 
+// Срок действия токена доступа
+const TokenTTL = 24 * time.Hour
+
+// Срок действия промежуточного токена второго фактора
+const ChallengeTokenTTL = 5 * time.Minute
+
+const (
+	subjectAccessToken    = "access_token"
+	subjectChallengeToken = "2fa_challenge"
+)
+
 type Claims struct {
 	UserID uuid.UUID `json:"user_id"`
+	// Сессия, к которой привязан токен доступа
+	SessionID uuid.UUID `json:"sid,omitempty"`
+	// Роли пользователя на момент выпуска токена
+	Roles []string `json:"roles,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID uuid.UUID, cfg *config.Config) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+func GenerateToken(userID, sessionID uuid.UUID, roles []string, cfg *config.Config) (string, error) {
+	return signToken(userID, sessionID, roles, subjectAccessToken, TokenTTL, cfg)
+}
+
+// Промежуточный токен, выдаваемый после проверки пароля при включенной
+// двухфакторной аутентификации; для доступа к API не подходит
+func GenerateChallengeToken(userID uuid.UUID, cfg *config.Config) (string, error) {
+	return signToken(userID, uuid.Nil, nil, subjectChallengeToken, ChallengeTokenTTL, cfg)
+}
+
+func ValidateToken(tokenString string, cfg *config.Config) (*Claims, error) {
+	return parseToken(tokenString, subjectAccessToken, cfg)
+}
+
+func ValidateChallengeToken(tokenString string, cfg *config.Config) (*Claims, error) {
+	return parseToken(tokenString, subjectChallengeToken, cfg)
+}
+
+func signToken(userID, sessionID uuid.UUID, roles []string, subject string, ttl time.Duration, cfg *config.Config) (string, error) {
+	expirationTime := time.Now().Add(ttl)
 
 	claims := &Claims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
+		Roles:     roles,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Subject:   "access_token",
+			Subject:   subject,
 		},
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -31,7 +66,7 @@ func GenerateToken(userID uuid.UUID, cfg *config.Config) (string, error) {
 	return token.SignedString([]byte(cfg.ServerConfig.JwtSecret))
 }
 
-func ValidateToken(tokenString string, cfg *config.Config) (*Claims, error) {
+func parseToken(tokenString, subject string, cfg *config.Config) (*Claims, error) {
 	claims := &Claims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
@@ -46,5 +81,9 @@ func ValidateToken(tokenString string, cfg *config.Config) (*Claims, error) {
 		return nil, jwt.ErrSignatureInvalid
 	}
 
+	if claims.Subject != subject {
+		return nil, fmt.Errorf("Токен не валидный")
+	}
+
 	return claims, nil
 }